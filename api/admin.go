@@ -0,0 +1,235 @@
+// This file contains the admin-api, which lets operators inspect and manage the
+// StreamSuppliers and Streams of this server. It is structured like api.go.
+// All paths start with com.AdminPrefix. The handlers are only reachable with
+// config.Admin.Token (see com.AdminHandler)
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	com "github.com/theMomax/notypo-backend/communication"
+	"github.com/theMomax/notypo-backend/streams"
+)
+
+// admin-paths
+const (
+	PathAdminSuppliers     = com.AdminPrefix + "/suppliers"
+	PathAdminCloseSupplier = com.AdminPrefix + "/suppliers/{supplier_id}"
+	PathAdminStreams       = com.AdminPrefix + "/streams"
+	PathAdminCloseStream   = com.AdminPrefix + "/streams/{stream_id}"
+	PathAdminDrainMode     = com.AdminPrefix + "/drain"
+)
+
+// registerAdmin registers the admin-api-functions specified in this file
+func registerAdmin() {
+	com.AdminHandle(http.MethodGet, PathAdminSuppliers, adminSuppliers).Tag(tagAdmin).
+		Summary("Lists all Streams.").
+		Describe("Lists all Streams in the order they were created, including those created at other servers sharing the same registry-backend. "+
+			"The query parameter `state` (pending, active or draining) lists only Streams in that state, `limit` at most that many Streams.").
+		Responds(http.StatusOK, "The registered Streams.").
+		Responds(http.StatusBadRequest, "The query parameters are invalid.")
+	com.AdminHandle(http.MethodDelete, PathAdminCloseSupplier, adminCloseSupplier).Tag(tagAdmin).
+		Summary("Force-closes a Stream.").
+		Describe("Deletes the Stream right away and closes all connections this server opened to it. "+
+			"Connections opened by other servers sharing the same registry-backend are closed, when they time out.").
+		Param("supplier_id", "`StreamSupplierID`").
+		Responds(http.StatusOK, "The Stream was deleted.").
+		Responds(http.StatusBadRequest, "The given id is not an integer.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.")
+	com.AdminHandle(http.MethodGet, PathAdminStreams, adminStreams).Tag(tagAdmin).
+		Summary("Lists all connections opened by this server.").
+		Describe("Lists all connections opened by this server in the order they were opened.").
+		Responds(http.StatusOK, "The open connections.")
+	com.AdminHandle(http.MethodDelete, PathAdminCloseStream, adminCloseStream).Tag(tagAdmin).
+		Summary("Force-closes a connection.").
+		Describe("Closes the connection as `DELETE "+PathCloseStreamConnection+"` does, but reports unknown connections.").
+		Param("stream_id", paramStream).
+		Responds(http.StatusOK, "The connection was closed.").
+		Responds(http.StatusBadRequest, "The given id is not an integer.").
+		Responds(http.StatusNotFound, "There is no connection with the given id.")
+	com.AdminHandle(http.MethodGet, PathAdminDrainMode, drainMode).Tag(tagAdmin).
+		Summary("Tells, whether the server is in drain mode.").
+		Responds(http.StatusOK, "The server's drain mode.")
+	com.AdminHandle(http.MethodPut, PathAdminDrainMode, setDrainMode).Tag(tagAdmin).
+		Summary("Enables or disables the drain mode.").
+		Describe("Enabling the drain mode prepares the server for a shutdown: New Streams are refused with 503, "+
+			"while the existing Streams and connections continue to work until they are deleted or time out. "+
+			"The drain mode only affects this server, even if it shares its registry-backend with other servers.").
+		Responds(http.StatusOK, "The drain mode was set.")
+}
+
+// -----------------------------------------------------------------------------
+// GET PathAdminSuppliers
+// -----------------------------------------------------------------------------
+
+// AdminSupplierResponse (response) extends a SupplierResponse by the
+// StreamSupplier's age in seconds
+type AdminSupplierResponse struct {
+	*SupplierResponse
+	Age int64 `json:"age"`
+}
+
+// AdminSuppliersQuery (query) narrows down the StreamSuppliers listed at
+// PathAdminSuppliers. Zero values list all StreamSuppliers
+type AdminSuppliersQuery struct {
+	State SupplierState `query:"state"`
+	Limit int           `query:"limit" validate:"min=0"`
+}
+
+// SupplierState (query) is the state of a StreamSupplier as reported by
+// SupplierResponse
+type SupplierState string
+
+// supplierStates are the SupplierStates, in which StreamSuppliers are listed
+var supplierStates = []SupplierState{"", "pending", "active", "draining"}
+
+// Validate returns an error, if the SupplierState is unknown
+func (s SupplierState) Validate() error {
+	for _, known := range supplierStates {
+		if s == known {
+			return nil
+		}
+	}
+	return errors.New("must be one of pending, active, draining")
+}
+
+// adminSuppliers responds with all registered StreamSuppliers, including those
+// registered by other servers sharing the same registry-backend, in the order
+// they were registered. They are narrowed down by the AdminSuppliersQuery
+func adminSuppliers(ctx *com.Context, req interface{}) (res []AdminSupplierResponse, err error) {
+	var q AdminSuppliersQuery
+	err = ctx.BindQuery(&q)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := streams.Suppliers()
+	if err != nil {
+		return nil, failure(err)
+	}
+	suppliers := make([]AdminSupplierResponse, 0, len(infos))
+	for _, info := range infos {
+		if q.Limit > 0 && len(suppliers) == q.Limit {
+			break
+		}
+		if q.State != "" && string(q.State) != info.State.String() {
+			continue
+		}
+		suppliers = append(suppliers, AdminSupplierResponse{
+			SupplierResponse: supplierResponse(info),
+			Age:              int64(info.Age / time.Second),
+		})
+	}
+	return suppliers, nil
+}
+
+// -----------------------------------------------------------------------------
+// DELETE PathAdminCloseSupplier
+// -----------------------------------------------------------------------------
+
+// adminCloseSupplier deletes the StreamSupplier and closes all Streams opened
+// from it, just like deleteSupplier. Unlike deleteSupplier it only accepts
+// StreamSupplierIDs
+func adminCloseSupplier(ctx *com.Context, req interface{}) (res interface{}, err error) {
+	id, err := strconv.ParseInt(ctx.Params["supplier_id"], 10, 64)
+	if err != nil {
+		return nil, invalidID("supplier_id")
+	}
+	err = streams.Unregister(id)
+	if err != nil {
+		return nil, failure(err)
+	}
+	return nil, nil
+}
+
+// -----------------------------------------------------------------------------
+// GET PathAdminStreams
+// -----------------------------------------------------------------------------
+
+// AdminStreamResponse (response) describes a Stream opened by this server.
+// Type is the type of the Stream's source as used in metrics (e.g. random).
+// Client is the ip of the client, whose quota the Stream counts towards. Age is
+// the time in seconds since the Stream was opened and Delivered the number of
+// Characters the Stream generated so far. IdleDeadline is omitted, if the
+// Stream doesn't time out due to inactivity
+type AdminStreamResponse struct {
+	ID           int64      `json:"id"`
+	SupplierID   int64      `json:"supplier_id"`
+	Type         string     `json:"type"`
+	Client       string     `json:"client"`
+	Opened       time.Time  `json:"opened"`
+	Age          int64      `json:"age"`
+	Deadline     time.Time  `json:"deadline"`
+	IdleDeadline *time.Time `json:"idle_deadline,omitempty"`
+	Delivered    uint64     `json:"delivered"`
+}
+
+// adminStreams responds with all Streams opened by this server in the order
+// they were opened
+func adminStreams(ctx *com.Context, req interface{}) (res []AdminStreamResponse, err error) {
+	infos := streams.Streams()
+	res = make([]AdminStreamResponse, len(infos))
+	for i, info := range infos {
+		res[i] = AdminStreamResponse{
+			ID:         info.ID,
+			SupplierID: info.SupplierID,
+			Type:       info.Type,
+			Client:     info.Client,
+			Opened:     info.Opened.UTC(),
+			Age:        int64(info.Age / time.Second),
+			Deadline:   info.Deadline.UTC(),
+			Delivered:  info.Delivered,
+		}
+		if !info.IdleDeadline.IsZero() {
+			idle := info.IdleDeadline.UTC()
+			res[i].IdleDeadline = &idle
+		}
+	}
+	return res, nil
+}
+
+// -----------------------------------------------------------------------------
+// DELETE PathAdminCloseStream
+// -----------------------------------------------------------------------------
+
+// adminCloseStream closes the Stream. Unlike closeStream it reports unknown
+// Streams
+func adminCloseStream(ctx *com.Context, req interface{}) (res interface{}, err error) {
+	id, err := strconv.ParseInt(ctx.Params["stream_id"], 10, 64)
+	if err != nil {
+		return nil, invalidID("stream_id")
+	}
+	err = streams.Close(id)
+	if err != nil {
+		return nil, failure(err)
+	}
+	return nil, nil
+}
+
+// -----------------------------------------------------------------------------
+// GET PathAdminDrainMode
+// -----------------------------------------------------------------------------
+
+// DrainMode (request/response) tells, whether the server is in drain mode.
+// While it is enabled, new StreamSuppliers are refused with
+// http.StatusServiceUnavailable, but the registered StreamSuppliers and opened
+// Streams continue to work
+type DrainMode struct {
+	Enabled bool `json:"enabled"`
+}
+
+func drainMode(ctx *com.Context, req interface{}) (res *DrainMode, err error) {
+	return &DrainMode{Enabled: streams.DrainMode()}, nil
+}
+
+// -----------------------------------------------------------------------------
+// PUT PathAdminDrainMode
+// -----------------------------------------------------------------------------
+
+func setDrainMode(ctx *com.Context, req DrainMode) (res com.NoResponse, err error) {
+	streams.SetDrainMode(req.Enabled)
+	return com.NoResponse{}, nil
+}
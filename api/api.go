@@ -5,13 +5,20 @@
 // as they are registered in the Serve function. The public constants and types
 // relevant to the operation are declared right above the actual function. The
 // private ones and further dependencies right below. The actual api is
-// documented externally using swagger. The comments in this document provide a
+// documented by the OpenAPI document served at PathOpenAPI, which is generated
+// from the registered operations. The comments in this document provide a
 // developers-view
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	com "github.com/theMomax/notypo-backend/communication"
 	"github.com/theMomax/notypo-backend/config"
@@ -26,25 +33,172 @@ const (
 	PathVersion                    = "/version"
 	PathStreamOptions              = "/stream"
 	PathCreateStream               = "/stream"
-	PathOpenStreamConnection       = "/stream/{id}"
-	PathCloseStreamConnection      = "/stream/{id}"
-	PathEstablishWebsocketToStream = "/stream/websocket/{id}"
+	PathOpenStreamConnection       = "/stream/{supplier_id}"
+	PathShareCode                  = "/stream/{supplier_id}/code"
+	PathStreamConnection           = "/stream/connection/{stream_id}"
+	PathSupplierInfo               = "/supplier/{supplier_id}"
+	PathSupplierKeepAlive          = "/supplier/{supplier_id}/keepalive"
+	PathDeleteSupplier             = "/supplier/{supplier_id}"
+	PathCloseStreamConnection      = "/stream/{stream_id}"
+	PathEstablishWebsocketToStream = "/stream/websocket/{stream_id}"
+	PathPrometheusMetrics          = "/metrics"
+	PathOpenAPI                    = "/openapi.json"
 )
 
-// Serve starts the webserver which implements the api specified in this file
-func Serve() {
-	com.Serve()
+// tags of the operations in the OpenAPI document
+const (
+	tagVersioning = "versioning"
+	tagStreams    = "stream management"
+	tagMonitoring = "monitoring"
+	tagAdmin      = "administration"
+)
+
+// descriptions of the path-parameters in the OpenAPI document
+const (
+	paramSupplier = "`StreamID`, `StreamToken` or `ShareCode`"
+	paramStream   = "`StreamConnectionID`"
+)
+
+// Serve starts the webserver which implements the api specified in this file.
+// It blocks until the webserver fails or Shutdown is called
+func Serve() error {
+	return com.Serve()
+}
+
+// Shutdown gracefully shuts down the webserver started by Serve. Open
+// websocket-connections are given until ctx is done to close
+func Shutdown(ctx context.Context) error {
+	return com.Shutdown(ctx)
+}
+
+// OpenAPI returns the OpenAPI document of the api in JSON format. It only
+// contains the operations registered so far (see Register)
+func OpenAPI() ([]byte, error) {
+	return com.OpenAPI(info())
+}
+
+// info describes the api in the OpenAPI document
+func info() com.Info {
+	return com.Info{
+		Title:   "notypo streaming-api",
+		Version: config.Version,
+		Description: "The REST and Websocket api of the [notypo-game](https://www.github.com/theMomax/notypo). " +
+			"All errors are explained by a `Problem` (see RFC 7807) with the `Content-Type` `application/problem+json`. " +
+			"This api allows CORS from a configurable list of URLs. " +
+			"Request bodies may be encoded in any of the listed formats. Bodies without `Content-Type` are treated as JSON. " +
+			"A body must contain a single value. If the server runs in strict mode, unknown fields are rejected with 400. " +
+			"Responses are encoded in the format preferred by the `Accept` header, which defaults to JSON. Problems are always encoded as JSON. " +
+			"Each response carries the request's id in the `X-Request-ID` header. " +
+			"Clients may send their own id in that header to correlate requests with the server's logs.",
+		Tags: map[string]string{
+			tagVersioning: "Information about the server's build.",
+			tagStreams: "These operations are used to manage Streams. A Stream is defined by its Source, which is responsible for the Stream's content. " +
+				"Each connection to a Stream delivers the exact same content in the exact same order. Two Streams created from the same Source may have a different content. " +
+				"A Stream is deleted, when a configurable amount of time has passed since the last connection to the Stream had been established, or when the last connection to the Stream is closed. " +
+				"If not closed by the client, a connection is closed by the server after a configurable lifetime, or after a configurable idle-timeout, if the client doesn't request any values. " +
+				"Both durations can be overridden when creating the Stream.",
+			tagMonitoring: "The server's metrics.",
+			tagAdmin: "These operations let operators inspect and manage the Streams and connections of a running server. They require the admin-token. " +
+				"Depending on the server's configuration, they are served by the api's server or by a separate server. In both cases, their paths start with `/admin`.",
+		},
+	}
 }
 
 // Register registers the api-functions specified in this file at the
-// http/websocket communication-unit
+// http/websocket communication-unit. Each operation is documented for the
+// OpenAPI document
 func Register() {
-	com.Get(PathVersion, version)
-	com.Get(PathStreamOptions, streamOptions)
-	com.Post(PathCreateStream, createStream)
-	com.Get(PathOpenStreamConnection, openStream)
-	com.Delete(PathCloseStreamConnection, closeStream)
-	com.Stream(PathEstablishWebsocketToStream, getStream)
+	com.Handle(http.MethodGet, PathVersion, version).Tag(tagVersioning).
+		Summary("Shows information about version and build-time.").
+		Responds(http.StatusOK, "This build is a valid production-build.").
+		Responds(http.StatusServiceUnavailable, "This build is a test- or development-build.")
+	com.Handle(http.MethodGet, PathStreamOptions, streamOptions).Tag(tagStreams).
+		Summary("Provides a list of types of Streams.").
+		Responds(http.StatusOK, "The returned list contains all `types` of Streams implemented by this api-version.")
+	com.Handle(http.MethodPost, PathCreateStream, createStream).Tag(tagStreams).
+		Summary("Creates a Stream.").
+		Describe("Creates a Stream, that fulfills the given requirements. This initialization defines the structure of the Stream's values. "+
+			"The client should keep this in mind, when requesting the Stream's content at `GET "+PathEstablishWebsocketToStream+"`. "+
+			"The Stream's values are `BasicCharacter`s for all `type`s.").
+		Responds(http.StatusOK, "The Stream has been created successfully. If the server runs in token-mode, a `StreamSupplierToken` is returned instead of the `StreamSupplierID`.",
+			StreamSupplierID(nil), StreamSupplierToken(nil)).
+		Responds(http.StatusBadRequest, "The given description is invalid, e.g. its `type` is unknown or its charset is empty or contains a character twice, "+
+			"or `lifetime` or `idle_timeout` is out of the server's bounds. All invalid fields are listed in the Problem's `errors`.").
+		Responds(http.StatusRequestEntityTooLarge, "The request's body or the given charset exceeds the configured maximum size.").
+		Responds(http.StatusTooManyRequests, "The server or the client has registered the configured maximum number of Streams.").
+		Responds(http.StatusNotImplemented, "The server doesn't implement the requested `type`.").
+		Responds(http.StatusServiceUnavailable, "The server is in drain mode and doesn't accept new Streams.")
+	com.Handle(http.MethodGet, PathOpenStreamConnection, openStream).Tag(tagStreams).
+		Summary("Opens a connection to a Stream.").
+		Describe("Opens a connection to a Stream, which streams the Stream's content from its beginning to the end, or until the connection is closed.").
+		Param("supplier_id", paramSupplier).
+		Responds(http.StatusOK, "The requested Stream was found. The connection has been opened.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.").
+		Responds(http.StatusGone, "The requested Stream timed out. It doesn't accept new connections, but the connections opened before stay open.").
+		Responds(http.StatusTooManyRequests, "The server, the Stream or the client has opened the configured maximum number of connections.")
+	com.Handle(http.MethodGet, PathShareCode, shareCode).Tag(tagStreams).
+		Summary("Provides the ShareCode of a Stream.").
+		Describe("Provides a short, human-friendly code, that can be read aloud and used instead of the `StreamSupplierID`. "+
+			"Share-codes are case-insensitive and become available again, when the Stream is deleted.").
+		Param("supplier_id", paramSupplier).
+		Responds(http.StatusOK, "The requested Stream was found.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.")
+	com.Handle(http.MethodGet, PathStreamConnection, streamConnection).Tag(tagStreams).
+		Summary("Tells, when a connection to a Stream is closed.").
+		Describe("Provides the connection's deadline and idle-deadline. Requesting this information doesn't count as activity.").
+		Param("stream_id", paramStream).
+		Responds(http.StatusOK, "The described connection is open.").
+		Responds(http.StatusBadRequest, "The given id is not an integer.").
+		Responds(http.StatusNotFound, "There is no open connection with the given id.")
+	com.Handle(http.MethodGet, PathSupplierInfo, supplierInfo).Tag(tagStreams).
+		Summary("Describes a Stream.").
+		Describe("Provides the Stream's description, its settings, when it expires and how many connections are open.").
+		Param("supplier_id", paramSupplier).
+		Responds(http.StatusOK, "The requested Stream was found.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.")
+	com.Handle(http.MethodPut, PathSupplierKeepAlive, keepAlive).Tag(tagStreams).
+		Summary("Postpones the expiry of a Stream.").
+		Describe("Resets the time, after which the Stream is deleted, as if a connection was opened.").
+		Param("supplier_id", paramSupplier).
+		Responds(http.StatusOK, "The Stream's expiry was postponed.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.").
+		Responds(http.StatusGone, "The requested Stream timed out. It doesn't accept new connections, but the connections opened before stay open.")
+	com.Handle(http.MethodDelete, PathDeleteSupplier, deleteSupplier).Tag(tagStreams).
+		Summary("Deletes a Stream.").
+		Describe("Deletes the Stream right away and closes all connections to it. "+
+			"If the server runs in token-mode, the `StreamSupplierToken` stays valid, i.e. the Stream is recreated, when the token is used again.").
+		Param("supplier_id", paramSupplier).
+		Responds(http.StatusOK, "The Stream was deleted.").
+		Responds(http.StatusNotFound, "The requested Stream doesn't exist.")
+	com.Handle(http.MethodDelete, PathCloseStreamConnection, closeStream).Tag(tagStreams).
+		Summary("Closes a connection to a Stream.").
+		Describe("Closes a connection to a Stream, if the connection exists. If this connection is the only connection to the regarded Stream, the Stream is deleted.").
+		Param("stream_id", paramStream).
+		Responds(http.StatusOK, "The described connection was either closed, or it didn't exist.").
+		Responds(http.StatusBadRequest, "The given id is not an integer.")
+	com.Stream(PathEstablishWebsocketToStream, getStream).Tag(tagStreams).
+		Summary("Establishes a websocket-connection, which enables the client to read the Stream's values.").
+		Describe("The server can't just send with a fixed bandwidth, since the required speed depends on the client. "+
+			"Thus, the client must send messages containing a positive integer `amount` in order to request the transfer of `amount` values from the Stream to the client. "+
+			"This communication may be asynchronous. All messages are encoded as JSON, unless the client requests another of the listed subprotocols. "+
+			"Then, they are sent as binary messages in the respective format. "+
+			"The websocket-connection may be closed by the client without preceding notification. "+
+			"The server will close the connection, when the connection's deadline or idle-deadline (see `GET "+PathStreamConnection+"`) has passed, "+
+			"if the client requests more values at once than configured (close code 1009), if the server shuts down (close code 1001), "+
+			"or if the connection was closed by timeout or due to a client's request.").
+		Param("stream_id", paramStream).
+		Messages(BasicCharacter(0)).
+		Responds(http.StatusSwitchingProtocols, "There is a connection with the given id. A websocket-connection will be established.").
+		Responds(http.StatusBadRequest, "The given id is not an integer.").
+		Responds(http.StatusNotFound, "There is no connection with the given id.")
+	com.Prometheus(PathPrometheusMetrics).Tag(tagMonitoring).
+		Summary("Provides the server's metrics in Prometheus format.").
+		Describe("Provides the server's metrics in the Prometheus text exposition format, amongst others the number of Streams and connections by `type`, " +
+			"the number of created Streams, the number of deleted Streams by reason (`timeout`, `closed` or `deleted`), the number of delivered values, " +
+			"the duration of websocket-connections, the latency of the REST-operations by route and how often each `limit` was hit.")
+	com.Spec(PathOpenAPI, info()).Tag(tagMonitoring).
+		Summary("Provides this document.")
+	registerAdmin()
 }
 
 // -----------------------------------------------------------------------------
@@ -58,15 +212,15 @@ type VersionResponse struct {
 	BuildTime string `json:"build_time"`
 }
 
-func version(params map[string]string) (status int, res *VersionResponse) {
+func version(ctx *com.Context, req interface{}) (res *VersionResponse, err error) {
 	if config.IsTest {
-		return http.StatusServiceUnavailable, nil
+		return nil, com.NewProblem(http.StatusServiceUnavailable, "", "")
 	}
-	return http.StatusOK, &VersionResponse{
+	return &VersionResponse{
 		Version:   config.Version,
 		GitCommit: config.GitCommit,
 		BuildTime: config.BuildTime,
-	}
+	}, nil
 }
 
 // -----------------------------------------------------------------------------
@@ -86,14 +240,39 @@ const (
 // StreamSourceType is a code for a specific type of streams.StreamSource
 type StreamSourceType string
 
+// streamSourceTypes are all known StreamSourceTypes, including those, that
+// aren't implemented by this api-version
+var streamSourceTypes = []StreamSourceType{Random, Dictionary}
+
+// Enum returns all known StreamSourceTypes
+func (t StreamSourceType) Enum() []interface{} {
+	types := make([]interface{}, len(streamSourceTypes))
+	for i, known := range streamSourceTypes {
+		types[i] = known
+	}
+	return types
+}
+
+// Validate returns an error, if the StreamSourceType is unknown
+func (t StreamSourceType) Validate() error {
+	names := make([]string, len(streamSourceTypes))
+	for i, known := range streamSourceTypes {
+		if t == known {
+			return nil
+		}
+		names[i] = string(known)
+	}
+	return errors.New("must be one of " + strings.Join(names, ", "))
+}
+
 // StreamOptionsResponse is a list of all StreamSourceTypes implemented by this
 // api-version
 type StreamOptionsResponse []StreamSourceType
 
-func streamOptions(params map[string]string) (status int, res StreamOptionsResponse) {
-	return http.StatusOK, StreamOptionsResponse{
+func streamOptions(ctx *com.Context, req interface{}) (res StreamOptionsResponse, err error) {
+	return StreamOptionsResponse{
 		Random,
-	}
+	}, nil
 }
 
 // -----------------------------------------------------------------------------
@@ -104,16 +283,35 @@ func streamOptions(params map[string]string) (status int, res StreamOptionsRespo
 type BasicCharacter rune
 
 // StreamSupplierDescription (request) specifies the type and properties of a
-// StreamSupplier
+// StreamSupplier. Lifetime and IdleTimeout optionally override
+// config.StreamBase.StreamTimeout and config.StreamBase.IdleTimeout in seconds
+// for the StreamSupplier's Streams. The charset must consist of distinct,
+// printable characters
 type StreamSupplierDescription struct {
-	Type    StreamSourceType `json:"type"`
-	Charset []BasicCharacter `json:"charset"`
+	Type        StreamSourceType `json:"type" validate:"required"`
+	Charset     []BasicCharacter `json:"charset" validate:"required,unique"`
+	Lifetime    int64            `json:"lifetime,omitempty" validate:"min=0"`
+	IdleTimeout int64            `json:"idle_timeout,omitempty" validate:"min=0"`
 }
 
 // StreamSupplierID (response)
 type StreamSupplierID *int64
 
-func createStream(req *StreamSupplierDescription, params map[string]string) (status int, res StreamSupplierID) {
+// StreamSupplierToken (response) replaces the StreamSupplierID, if
+// config.Token is enabled. It is a signed token, that encodes the
+// StreamSupplier's description. Thus, any server sharing the same key can
+// resolve it. The connection opened via a token is only known to the server,
+// that opened it
+type StreamSupplierToken *string
+
+// createStream responds with a StreamSupplierID or a StreamSupplierToken
+// depending on config.Token. The StreamSupplier counts towards the requesting
+// client's quota. Tokens don't, since the StreamSupplier is only registered,
+// when the token is resolved. Then, only the global limit applies. Timeouts out of the bounds in config.StreamBase result in
+// http.StatusBadRequest. Invalid descriptions are rejected before createStream
+// is called. StreamSourceTypes, that aren't implemented, result in
+// http.StatusNotImplemented
+func createStream(ctx *com.Context, req StreamSupplierDescription) (res interface{}, err error) {
 	var source streams.StreamSource
 	switch req.Type {
 	case Random:
@@ -123,14 +321,90 @@ func createStream(req *StreamSupplierDescription, params map[string]string) (sta
 		}
 		source = streams.NewRandomCharStreamSource(charset)
 	default:
-		return http.StatusNotImplemented, nil
+		return nil, com.NewProblem(http.StatusNotImplemented, ProblemUnsupportedType, "streams of type "+string(req.Type)+" can't be created").
+			WithField("type", "must be one of the types listed at "+PathStreamOptions)
 	}
-	if source == nil {
-		return http.StatusBadRequest, nil
+	timeouts := streams.Timeouts{
+		Lifetime: time.Duration(req.Lifetime) * time.Second,
+		Idle:     time.Duration(req.IdleTimeout) * time.Second,
+	}
+	if config.Token.Enabled {
+		// StreamSuppliers are registered lazily, when the token is resolved
+		if streams.DrainMode() {
+			return nil, failure(streams.ErrDrainMode)
+		}
+		err := streams.CheckTimeouts(timeouts)
+		if err == nil {
+			err = streams.CheckSource(source)
+		}
+		if err != nil {
+			return nil, failure(err)
+		}
+		token, err := streams.Token(source, timeouts, []byte(config.Token.Key))
+		if err != nil {
+			return nil, failure(err)
+		}
+		return StreamSupplierToken(&token), nil
+	}
+	id, err := streams.RegisterAs(ctx.Client, source, timeouts)
+	if err != nil {
+		return nil, failure(err)
+	}
+	return StreamSupplierID(&id), nil
+}
+
+// problem types (see com.Problem)
+const (
+	ProblemInvalidID        = "urn:notypo:problem:invalid-id"
+	ProblemUnsupportedType  = "urn:notypo:problem:unsupported-type"
+	ProblemInvalidTimeouts  = "urn:notypo:problem:invalid-timeouts"
+	ProblemNoSuchSupplier   = "urn:notypo:problem:no-such-supplier"
+	ProblemNoSuchStream     = "urn:notypo:problem:no-such-stream"
+	ProblemSupplierDraining = "urn:notypo:problem:supplier-draining"
+	ProblemDrainMode        = "urn:notypo:problem:drain-mode"
+	ProblemLimitExceeded    = "urn:notypo:problem:limit-exceeded"
+)
+
+// failure maps an error returned by the streams package to the according
+// Problem. Exceeded limits result in http.StatusTooManyRequests
+// (http.StatusRequestEntityTooLarge for the charset's size), unknown or closed
+// StreamSuppliers in http.StatusNotFound, Draining ones in http.StatusGone and
+// drain mode in http.StatusServiceUnavailable. Unexpected errors aren't
+// explained to the client
+func failure(err error) *com.Problem {
+	var stateErr *streams.StateError
+	var limitErr *streams.LimitError
+	var timeoutErr *streams.TimeoutError
+	var p *com.Problem
+	switch {
+	case errors.As(err, &timeoutErr):
+		p = com.NewProblem(http.StatusBadRequest, ProblemInvalidTimeouts, "the requested timeouts are out of bounds").
+			WithField(timeoutErr.Timeout, timeoutErr.Error())
+	case err == streams.ErrNoSuchSupplier:
+		p = com.NewProblem(http.StatusNotFound, ProblemNoSuchSupplier, err.Error())
+	case err == streams.ErrNoSuchStream:
+		p = com.NewProblem(http.StatusNotFound, ProblemNoSuchStream, err.Error())
+	case err == streams.ErrDrainMode:
+		p = com.NewProblem(http.StatusServiceUnavailable, ProblemDrainMode, err.Error())
+	case errors.As(err, &stateErr) && stateErr.State == streams.Draining:
+		p = com.NewProblem(http.StatusGone, ProblemSupplierDraining, err.Error())
+	case errors.As(err, &stateErr):
+		p = com.NewProblem(http.StatusNotFound, ProblemNoSuchSupplier, err.Error())
+	case errors.As(err, &limitErr) && limitErr.Limit == streams.LimitCharsetSize:
+		p = com.NewProblem(http.StatusRequestEntityTooLarge, ProblemLimitExceeded, err.Error()).
+			WithField("charset", "must contain at most "+strconv.Itoa(limitErr.Max)+" characters")
+	case errors.As(err, &limitErr):
+		p = com.NewProblem(http.StatusTooManyRequests, ProblemLimitExceeded, err.Error())
+	default:
+		p = com.NewProblem(http.StatusInternalServerError, "", "")
 	}
-	id := streams.Register(source)
-	res = &id
-	return http.StatusOK, res
+	return p.WithCause(err)
+}
+
+// invalidID explains, that the given path-parameter is not a valid id
+func invalidID(param string) *com.Problem {
+	return com.NewProblem(http.StatusBadRequest, ProblemInvalidID, "the "+param+" is invalid").
+		WithField(param, "must be an integer")
 }
 
 // Rune returns the character as a rune
@@ -138,6 +412,15 @@ func (c BasicCharacter) Rune() rune {
 	return rune(c)
 }
 
+// Validate returns an error, if the character isn't a printable unicode
+// character
+func (c BasicCharacter) Validate() error {
+	if !utf8.ValidRune(rune(c)) || !unicode.IsPrint(rune(c)) {
+		return errors.New("must be a printable character")
+	}
+	return nil
+}
+
 // -----------------------------------------------------------------------------
 // GET PathOpenStreamConnection
 // -----------------------------------------------------------------------------
@@ -145,37 +428,214 @@ func (c BasicCharacter) Rune() rune {
 // StreamID (response)
 type StreamID *int64
 
-func openStream(params map[string]string) (status int, res StreamID) {
-	id, err := strconv.ParseInt(params["id"], 10, 64)
+// openStream responds with a StreamID. The Stream counts towards the requesting
+// client's quota
+func openStream(ctx *com.Context, req interface{}) (res StreamID, err error) {
+	id, err := supplierID(ctx.Params["supplier_id"])
 	if err != nil {
-		return http.StatusBadRequest, nil
+		return nil, failure(err)
 	}
-	streamID, err := streams.Open(id)
+	streamID, err := streams.OpenAs(ctx.Client, id)
 	if err != nil {
-		return http.StatusNotFound, nil
+		return nil, failure(err)
 	}
-	return http.StatusOK, &streamID
+	return StreamID(&streamID), nil
+}
+
+// supplierID interprets the given path-parameter as a StreamSupplierID, a
+// ShareCode or a StreamSupplierToken and returns the according
+// StreamSupplierID. It returns streams.ErrNoSuchSupplier, if the parameter is
+// neither of them
+func supplierID(param string) (id int64, err error) {
+	id, err = strconv.ParseInt(param, 10, 64)
+	if err == nil {
+		return id, nil
+	}
+	id, ok := streams.Resolve(param)
+	if ok {
+		return id, nil
+	}
+	if !config.Token.Enabled {
+		return 0, streams.ErrNoSuchSupplier
+	}
+	id, err = streams.ResolveToken(param, []byte(config.Token.Key))
+	if err == streams.ErrInvalidToken {
+		return 0, streams.ErrNoSuchSupplier
+	}
+	return id, err
+}
+
+// -----------------------------------------------------------------------------
+// GET PathShareCode
+// -----------------------------------------------------------------------------
+
+// ShareCode (response) is a human-friendly alternative to a StreamSupplierID
+// (e.g. brave-otter-42). It can be used anywhere a StreamSupplierID is expected
+type ShareCode *string
+
+func shareCode(ctx *com.Context, req interface{}) (res ShareCode, err error) {
+	id, err := supplierID(ctx.Params["supplier_id"])
+	if err != nil {
+		return nil, failure(err)
+	}
+	code, ok := streams.ShareCode(id)
+	if !ok {
+		return nil, failure(streams.ErrNoSuchSupplier)
+	}
+	return &code, nil
+}
+
+// -----------------------------------------------------------------------------
+// GET PathStreamConnection
+// -----------------------------------------------------------------------------
+
+// StreamConnectionResponse (response) tells the client, when a Stream's
+// connection is closed. The connection is closed at Deadline, no matter its
+// activity, or at IdleDeadline, if no streams.Characters are requested until
+// then. Each request postpones the IdleDeadline by IdleTimeout seconds. If
+// IdleTimeout is zero, the connection doesn't time out due to inactivity and
+// IdleDeadline is omitted
+type StreamConnectionResponse struct {
+	ID           int64      `json:"id"`
+	Deadline     time.Time  `json:"deadline"`
+	IdleTimeout  int64      `json:"idle_timeout"`
+	IdleDeadline *time.Time `json:"idle_deadline,omitempty"`
+}
+
+func streamConnection(ctx *com.Context, req interface{}) (res *StreamConnectionResponse, err error) {
+	id, err := strconv.ParseInt(ctx.Params["stream_id"], 10, 64)
+	if err != nil {
+		return nil, invalidID("stream_id")
+	}
+	stream, ok := streams.Get(id)
+	if !ok {
+		return nil, failure(streams.ErrNoSuchStream)
+	}
+	res = &StreamConnectionResponse{
+		ID:          id,
+		Deadline:    stream.Deadline().UTC(),
+		IdleTimeout: int64(stream.IdleTimeout() / time.Second),
+	}
+	if stream.IdleTimeout() > 0 {
+		idle := stream.IdleDeadline().UTC()
+		res.IdleDeadline = &idle
+	}
+	return res, nil
+}
+
+// -----------------------------------------------------------------------------
+// GET PathSupplierInfo
+// -----------------------------------------------------------------------------
+
+// SupplierResponse (response) describes a StreamSupplier. Type, Seed and
+// Charset describe the StreamSupplier's content. Lifetime and IdleTimeout are
+// the timeouts of its Streams in seconds. The StreamSupplier is deleted at
+// Expires, if no Stream is opened from it until then. Connections is the number
+// of Streams currently opened from it
+type SupplierResponse struct {
+	ID          int64            `json:"id"`
+	Code        string           `json:"code"`
+	Type        StreamSourceType `json:"type,omitempty"`
+	Seed        int64            `json:"seed"`
+	Charset     []BasicCharacter `json:"charset"`
+	Lifetime    int64            `json:"lifetime"`
+	IdleTimeout int64            `json:"idle_timeout"`
+	State       string           `json:"state"`
+	Created     time.Time        `json:"created"`
+	Expires     time.Time        `json:"expires"`
+	Connections int              `json:"connections"`
+}
+
+func supplierInfo(ctx *com.Context, req interface{}) (res *SupplierResponse, err error) {
+	id, err := supplierID(ctx.Params["supplier_id"])
+	if err != nil {
+		return nil, failure(err)
+	}
+	info, err := streams.Supplier(id)
+	if err != nil {
+		return nil, failure(err)
+	}
+	return supplierResponse(info), nil
+}
+
+// supplierResponse converts a streams.SupplierInfo to a SupplierResponse
+func supplierResponse(info streams.SupplierInfo) *SupplierResponse {
+	supplier := &SupplierResponse{
+		ID:          info.ID,
+		Code:        info.Code,
+		Lifetime:    int64(info.Timeouts.Lifetime / time.Second),
+		IdleTimeout: int64(info.Timeouts.Idle / time.Second),
+		State:       info.State.String(),
+		Created:     info.Created.UTC(),
+		Expires:     info.Expires.UTC(),
+		Connections: info.Connections,
+	}
+	if d := info.Description; d != nil {
+		if d.Type == streams.RandomSourceType {
+			supplier.Type = Random
+		}
+		supplier.Seed = d.Seed
+		supplier.Charset = make([]BasicCharacter, len(d.Charset))
+		for i, r := range d.Charset {
+			supplier.Charset[i] = BasicCharacter(r)
+		}
+	}
+	return supplier
+}
+
+// -----------------------------------------------------------------------------
+// PUT PathSupplierKeepAlive
+// -----------------------------------------------------------------------------
+
+// keepAlive postpones the StreamSupplier's expiry, as if a Stream was opened
+// from it
+func keepAlive(ctx *com.Context, req interface{}) (res com.NoResponse, err error) {
+	id, err := supplierID(ctx.Params["supplier_id"])
+	if err == nil {
+		err = streams.KeepAlive(id)
+	}
+	if err != nil {
+		return com.NoResponse{}, failure(err)
+	}
+	return com.NoResponse{}, nil
+}
+
+// -----------------------------------------------------------------------------
+// DELETE PathDeleteSupplier
+// -----------------------------------------------------------------------------
+
+// deleteSupplier deletes the StreamSupplier and closes all Streams opened from
+// it
+func deleteSupplier(ctx *com.Context, req interface{}) (res interface{}, err error) {
+	id, err := supplierID(ctx.Params["supplier_id"])
+	if err == nil {
+		err = streams.Unregister(id)
+	}
+	if err != nil {
+		return nil, failure(err)
+	}
+	return nil, nil
 }
 
 // -----------------------------------------------------------------------------
 // DELETE PathCloseStreamConnection
 // -----------------------------------------------------------------------------
 
-func closeStream(req interface{}, params map[string]string) (status int, res interface{}) {
-	id, err := strconv.ParseInt(params["id"], 10, 64)
+func closeStream(ctx *com.Context, req interface{}) (res interface{}, err error) {
+	id, err := strconv.ParseInt(ctx.Params["stream_id"], 10, 64)
 	if err != nil {
-		return http.StatusBadRequest, nil
+		return nil, invalidID("stream_id")
 	}
 	streams.Close(id)
-	return http.StatusOK, nil
+	return nil, nil
 }
 
 // -----------------------------------------------------------------------------
 // GET/WEBSOCKET PathEstablishWebsocketToStream
 // -----------------------------------------------------------------------------
 
-func getStream(params map[string]string) (status int, stream streams.Stream) {
-	id, err := strconv.ParseInt(params["id"], 10, 64)
+func getStream(ctx *com.Context) (status int, stream streams.Stream) {
+	id, err := strconv.ParseInt(ctx.Params["stream_id"], 10, 64)
 	if err != nil {
 		return http.StatusBadRequest, nil
 	}
@@ -14,12 +14,17 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
 	com "github.com/theMomax/notypo-backend/communication"
 	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/streams"
 )
 
 var r *mux.Router
 
+// fakeClock drives all timeouts of the api
+var fakeClock = clock.NewFake(time.Now())
+
 func init() {
 	config.IsTest = true
 	config.ConfigPath = "config.ini"
@@ -29,10 +34,26 @@ func init() {
 	config.BuildTime = "TESTBUILDTIME"
 	config.IsTest = false
 
+	streams.Setup(streams.WithClock(fakeClock))
 	Register()
 	r = com.Router()
 }
 
+// setupRegistry replaces the default Registry with one, that is based on
+// fakeClock. Its timeouts default to an hour and can be overridden by the
+// given Options
+func setupRegistry(t *testing.T, options ...streams.Option) {
+	options = append([]streams.Option{
+		streams.WithClock(fakeClock),
+		streams.WithStreamTimeout(time.Hour),
+		streams.WithSupplierTimeout(time.Hour),
+	}, options...)
+	err := streams.Setup(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestVersion(t *testing.T) {
 	ngr := runtime.NumGoroutine()
 
@@ -61,8 +82,8 @@ func TestCreateStream501(t *testing.T) {
 
 	body := bytes.NewBuffer(make([]byte, 0))
 	json.NewEncoder(body).Encode(StreamSupplierDescription{
-		Type: "other",
-		Charset: []rune{
+		Type: Dictionary,
+		Charset: []BasicCharacter{
 			'a', 'b', 'c',
 		},
 	})
@@ -87,8 +108,7 @@ func TestOpenStream404(t *testing.T) {
 }
 
 func TestStreamProcedureWebsocket404(t *testing.T) {
-	config.StreamBase.StreamTimeout = time.Hour
-	config.StreamBase.SupplierTimeout = time.Hour
+	setupRegistry(t)
 	s := httptest.NewServer(r)
 	defer s.Close()
 	ngr := runtime.NumGoroutine()
@@ -96,7 +116,7 @@ func TestStreamProcedureWebsocket404(t *testing.T) {
 	body := bytes.NewBuffer(make([]byte, 0))
 	json.NewEncoder(body).Encode(StreamSupplierDescription{
 		Type: Random,
-		Charset: []rune{
+		Charset: []BasicCharacter{
 			'a', 'b', 'c',
 		},
 	})
@@ -129,6 +149,156 @@ func TestStreamProcedureWebsocket404(t *testing.T) {
 	assert.Equal(t, ngr, runtime.NumGoroutine())
 }
 
+func TestShareCode(t *testing.T) {
+	setupRegistry(t, streams.WithSupplierTimeout(time.Minute))
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type: Random,
+		Charset: []BasicCharacter{
+			'a', 'b', 'c',
+		},
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var streamID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
+
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(streamID, 10)+"/code", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var code string
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &code))
+	assert.NotEmpty(t, code)
+
+	req, _ = http.NewRequest("GET", "/stream/"+code+"/code", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	assert.Equal(t, jsons(code), resp.Body.String())
+
+	req, _ = http.NewRequest("GET", "/stream/"+code, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+
+	req, _ = http.NewRequest("DELETE", "/stream/"+strconv.FormatInt(connectionID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+
+	// closing the last stream released the code
+	req, _ = http.NewRequest("GET", "/stream/"+code, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+
+	// so does the supplier's timeout
+	supplierID, _ := streams.Register(streams.NewRandomCharStreamSource([]streams.Character{BasicCharacter('a')}))
+	code, _ = streams.ShareCode(supplierID)
+	fakeClock.Advance(time.Minute - time.Millisecond)
+	req, _ = http.NewRequest("GET", "/stream/"+code+"/code", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	fakeClock.Advance(time.Millisecond)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+}
+
+func TestTokenProcedure(t *testing.T) {
+	setupRegistry(t)
+	config.Token.Enabled = true
+	config.Token.Key = "secret"
+	defer func() {
+		config.Token.Enabled = false
+	}()
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type: Random,
+		Charset: []BasicCharacter{
+			'a', 'b', 'c',
+		},
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var token string
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &token))
+
+	req, _ = http.NewRequest("GET", "/stream/"+token, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+	stream, ok := streams.Get(connectionID)
+	if !ok {
+		t.Fatal("stream wasn't opened")
+	}
+
+	req, _ = http.NewRequest("DELETE", "/stream/"+strconv.FormatInt(connectionID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	// the stream's generator must have stopped, before the next test counts
+	// the goroutines
+	<-stream.Done()
+
+	config.Token.Key = "other"
+	req, _ = http.NewRequest("GET", "/stream/"+token, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+}
+
+// TestTokenLimits asserts, that issuing tokens is exempt from the suppliers'
+// limits, but resolving them isn't
+func TestTokenLimits(t *testing.T) {
+	setupRegistry(t, streams.WithLimits(streams.Limits{
+		Suppliers:       1,
+		ClientSuppliers: 1,
+	}))
+	config.Token.Enabled = true
+	config.Token.Key = "secret"
+	defer func() {
+		config.Token.Enabled = false
+	}()
+
+	tokens := make([]string, 2)
+	for i := range tokens {
+		body := bytes.NewBuffer(make([]byte, 0))
+		json.NewEncoder(body).Encode(StreamSupplierDescription{
+			Type:    Random,
+			Charset: []BasicCharacter{'a', 'b', 'c'},
+		})
+		req, _ := http.NewRequest("POST", "/stream", body)
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, 200, resp.Code)
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tokens[i]))
+	}
+	assert.NotEqual(t, tokens[0], tokens[1])
+
+	req, _ := http.NewRequest("GET", "/supplier/"+tokens[0], nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	req, _ = http.NewRequest("GET", "/supplier/"+tokens[1], nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	p := problem(t, resp, 429)
+	assert.Equal(t, ProblemLimitExceeded, p.Type)
+}
+
 func TestCloseStreamNoEffect(t *testing.T) {
 	ngr := runtime.NumGoroutine()
 
@@ -142,14 +312,13 @@ func TestCloseStreamNoEffect(t *testing.T) {
 }
 
 func TestStreamProcedureWithoutConnection(t *testing.T) {
-	config.StreamBase.StreamTimeout = time.Hour
-	config.StreamBase.SupplierTimeout = 0
+	setupRegistry(t, streams.WithSupplierTimeout(0))
 	ngr := runtime.NumGoroutine()
 
 	body := bytes.NewBuffer(make([]byte, 0))
 	json.NewEncoder(body).Encode(StreamSupplierDescription{
 		Type: Random,
-		Charset: []rune{
+		Charset: []BasicCharacter{
 			'a', 'b', 'c',
 		},
 	})
@@ -161,20 +330,19 @@ func TestStreamProcedureWithoutConnection(t *testing.T) {
 	var streamID int64
 	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
 
-	<-time.After(20 * time.Millisecond)
-	assert.Equal(t, ngr, runtime.NumGoroutine())
+	fakeClock.Advance(0)
+	assertGoroutines(t, ngr)
 }
 
 func TestStreamProcedureWithoutConnectionClosing(t *testing.T) {
-	config.StreamBase.StreamTimeout = 0
-	config.StreamBase.SupplierTimeout = time.Hour
+	setupRegistry(t, streams.WithStreamTimeout(0))
 	for i := 0; i < 100; i++ {
 		ngr := runtime.NumGoroutine()
 
 		body := bytes.NewBuffer(make([]byte, 0))
 		json.NewEncoder(body).Encode(StreamSupplierDescription{
 			Type: Random,
-			Charset: []rune{
+			Charset: []BasicCharacter{
 				'a', 'b', 'c',
 			},
 		})
@@ -194,14 +362,13 @@ func TestStreamProcedureWithoutConnectionClosing(t *testing.T) {
 		var connectionID int64
 		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
 
-		<-time.After(20 * time.Millisecond)
-		assert.Equal(t, ngr, runtime.NumGoroutine())
+		fakeClock.Advance(0)
+		assertGoroutines(t, ngr)
 	}
 }
 
 func TestStreamProcedureWithoutWebsocketClosing(t *testing.T) {
-	config.StreamBase.StreamTimeout = 10 * time.Millisecond
-	config.StreamBase.SupplierTimeout = time.Hour
+	setupRegistry(t, streams.WithStreamTimeout(10*time.Millisecond))
 	s := httptest.NewServer(r)
 	defer s.Close()
 	for i := 0; i < 550; i++ {
@@ -210,7 +377,7 @@ func TestStreamProcedureWithoutWebsocketClosing(t *testing.T) {
 		body := bytes.NewBuffer(make([]byte, 0))
 		json.NewEncoder(body).Encode(StreamSupplierDescription{
 			Type: Random,
-			Charset: []rune{
+			Charset: []BasicCharacter{
 				'a', 'b', 'c',
 			},
 		})
@@ -231,7 +398,9 @@ func TestStreamProcedureWithoutWebsocketClosing(t *testing.T) {
 		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
 
 		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
-		assert.NoError(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		assert.NoError(t, ws.WriteJSON(uint(3)))
 		for j := 0; j < 3; j++ {
@@ -245,14 +414,13 @@ func TestStreamProcedureWithoutWebsocketClosing(t *testing.T) {
 		r.ServeHTTP(resp, req)
 		assert.Equal(t, 200, resp.Code)
 
-		<-time.After(30 * time.Millisecond)
-		assert.Equal(t, ngr, runtime.NumGoroutine())
+		fakeClock.Advance(10 * time.Millisecond)
+		assertGoroutines(t, ngr)
 	}
 }
 
 func TestStreamProcedureWithoutWebsocketClosingButConnectionClosing(t *testing.T) {
-	config.StreamBase.StreamTimeout = time.Hour
-	config.StreamBase.SupplierTimeout = time.Hour
+	setupRegistry(t)
 	s := httptest.NewServer(r)
 	defer s.Close()
 	for i := 0; i < 100; i++ {
@@ -261,7 +429,7 @@ func TestStreamProcedureWithoutWebsocketClosingButConnectionClosing(t *testing.T
 		body := bytes.NewBuffer(make([]byte, 0))
 		json.NewEncoder(body).Encode(StreamSupplierDescription{
 			Type: Random,
-			Charset: []rune{
+			Charset: []BasicCharacter{
 				'a', 'b', 'c',
 			},
 		})
@@ -282,7 +450,9 @@ func TestStreamProcedureWithoutWebsocketClosingButConnectionClosing(t *testing.T
 		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
 
 		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
-		assert.NoError(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		assert.NoError(t, ws.WriteJSON(uint(3)))
 		for j := 0; j < 3; j++ {
@@ -304,8 +474,7 @@ func TestStreamProcedureWithoutWebsocketClosingButConnectionClosing(t *testing.T
 }
 
 func TestStreamProcedure(t *testing.T) {
-	config.StreamBase.StreamTimeout = time.Hour
-	config.StreamBase.SupplierTimeout = time.Hour
+	setupRegistry(t)
 	s := httptest.NewServer(r)
 	defer s.Close()
 	for i := 0; i < 100; i++ {
@@ -314,7 +483,7 @@ func TestStreamProcedure(t *testing.T) {
 		body := bytes.NewBuffer(make([]byte, 0))
 		json.NewEncoder(body).Encode(StreamSupplierDescription{
 			Type: Random,
-			Charset: []rune{
+			Charset: []BasicCharacter{
 				'a', 'b', 'c',
 			},
 		})
@@ -335,7 +504,9 @@ func TestStreamProcedure(t *testing.T) {
 		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
 
 		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
-		assert.NoError(t, err)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		assert.NoError(t, ws.WriteJSON(uint(3)))
 		for j := 0; j < 3; j++ {
@@ -355,7 +526,556 @@ func TestStreamProcedure(t *testing.T) {
 	}
 }
 
+func TestLimits(t *testing.T) {
+	setupRegistry(t, streams.WithLimits(streams.Limits{
+		CharsetSize:   2,
+		ClientStreams: 1,
+	}))
+	defer func() {
+		config.Limits.RequestSize = 0
+	}()
+	config.Limits.RequestSize = 2
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:    Random,
+		Charset: []BasicCharacter{'a', 'b', 'c'},
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 413, resp.Code)
+	assert.Contains(t, resp.Body.String(), "charset_size")
+
+	body = bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:    Random,
+		Charset: []BasicCharacter{'a', 'b'},
+	})
+	req, _ = http.NewRequest("POST", "/stream", body)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var streamID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
+
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(streamID, 10), nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+	defer func() {
+		req, _ := http.NewRequest("DELETE", "/stream/"+strconv.FormatInt(connectionID, 10), nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 429, resp.Code)
+	assert.Contains(t, resp.Body.String(), "client_streams")
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	assert.NoError(t, ws.WriteJSON(uint(3)))
+	var c rune
+	err = ws.ReadJSON(&c)
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "unexpected error: %v", err)
+
+	for _, series := range []string{
+		`notypo_limits_exceeded_total{limit="charset_size"}`,
+		`notypo_limits_exceeded_total{limit="client_streams"}`,
+		`notypo_http_limits_exceeded_total{limit="request_size"}`,
+	} {
+		assert.True(t, metric(t, series) >= 1, series)
+	}
+}
+
+func TestStreamTimeouts(t *testing.T) {
+	setupRegistry(t,
+		streams.WithIdleTimeout(time.Minute),
+		streams.WithTimeoutBounds(streams.Timeouts{}, streams.Timeouts{Idle: time.Hour}),
+	)
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:        Random,
+		Charset:     []BasicCharacter{'a', 'b', 'c'},
+		IdleTimeout: 7200,
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 400, resp.Code)
+	assert.Contains(t, resp.Body.String(), "idle_timeout")
+
+	body = bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:        Random,
+		Charset:     []BasicCharacter{'a', 'b', 'c'},
+		IdleTimeout: 30,
+	})
+	req, _ = http.NewRequest("POST", "/stream", body)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var streamID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
+
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(streamID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+
+	opened := fakeClock.Now()
+	req, _ = http.NewRequest("GET", "/stream/connection/"+strconv.FormatInt(connectionID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var info StreamConnectionResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &info))
+	assert.Equal(t, connectionID, info.ID)
+	assert.True(t, opened.Add(time.Hour).Equal(info.Deadline))
+	assert.Equal(t, int64(30), info.IdleTimeout)
+	if assert.NotNil(t, info.IdleDeadline) {
+		assert.True(t, opened.Add(30*time.Second).Equal(*info.IdleDeadline))
+	}
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	fakeClock.Advance(20 * time.Second)
+	// requesting characters postpones the idle deadline
+	assert.NoError(t, ws.WriteJSON(uint(1)))
+	var c rune
+	assert.NoError(t, ws.ReadJSON(&c))
+	fakeClock.Advance(20 * time.Second)
+	_, ok := streams.Get(connectionID)
+	assert.True(t, ok)
+
+	fakeClock.Advance(10 * time.Second)
+	_, ok = streams.Get(connectionID)
+	assert.False(t, ok)
+	assert.Error(t, ws.ReadJSON(&c))
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+}
+
+func TestSupplierEndpoints(t *testing.T) {
+	setupRegistry(t)
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:     Random,
+		Charset:  []BasicCharacter{'a', 'b', 'c'},
+		Lifetime: 600,
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var streamID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
+	supplier := "/supplier/" + strconv.FormatInt(streamID, 10)
+
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(streamID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+
+	req, _ = http.NewRequest("GET", supplier, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var info SupplierResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &info))
+	assert.Equal(t, streamID, info.ID)
+	assert.Equal(t, Random, info.Type)
+	assert.Equal(t, []BasicCharacter{'a', 'b', 'c'}, info.Charset)
+	assert.Equal(t, int64(600), info.Lifetime)
+	assert.Equal(t, "active", info.State)
+	assert.Equal(t, 1, info.Connections)
+	assert.True(t, fakeClock.Now().Add(time.Hour).Equal(info.Expires))
+
+	fakeClock.Advance(time.Minute)
+	req, _ = http.NewRequest("PUT", supplier+"/keepalive", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	req, _ = http.NewRequest("GET", supplier, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &info))
+	assert.True(t, fakeClock.Now().Add(time.Hour).Equal(info.Expires))
+
+	req, _ = http.NewRequest("DELETE", supplier, nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	_, ok := streams.Get(connectionID)
+	assert.False(t, ok)
+
+	for _, method := range []string{"GET", "DELETE"} {
+		req, _ = http.NewRequest(method, supplier, nil)
+		resp = httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		assert.Equal(t, 404, resp.Code)
+	}
+	req, _ = http.NewRequest("PUT", supplier+"/keepalive", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+}
+
+func TestAdmin(t *testing.T) {
+	setupRegistry(t)
+	config.Admin.Token = "secret"
+	defer func() {
+		config.Admin.Token = ""
+	}()
+	admin := com.AdminHandler()
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		b := bytes.NewBuffer(make([]byte, 0))
+		if body != nil {
+			json.NewEncoder(b).Encode(body)
+		}
+		req, _ := http.NewRequest(method, path, b)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		admin.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// the admin-api requires the token and isn't reachable via the api's router
+	for _, token := range []string{"", "other"} {
+		resp := do("GET", PathAdminStreams, token, nil)
+		assert.Equal(t, 401, resp.Code)
+		assert.NotEmpty(t, resp.Header().Get("WWW-Authenticate"))
+	}
+	req, _ := http.NewRequest("GET", PathAdminStreams, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 404, resp.Code)
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:    Random,
+		Charset: []BasicCharacter{'a', 'b', 'c'},
+	})
+	req, _ = http.NewRequest("POST", "/stream", body)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	var supplierID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &supplierID))
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(supplierID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+	fakeClock.Advance(time.Minute)
+
+	resp = do("GET", PathAdminSuppliers, "secret", nil)
+	assert.Equal(t, 200, resp.Code)
+	var suppliers []AdminSupplierResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &suppliers))
+	found := false
+	for _, s := range suppliers {
+		if s.ID == supplierID {
+			found = true
+			assert.Equal(t, Random, s.Type)
+			assert.Equal(t, 1, s.Connections)
+			assert.Equal(t, int64(60), s.Age)
+		}
+	}
+	assert.True(t, found)
+
+	// the list can be narrowed down
+	resp = do("GET", PathAdminSuppliers+"?state=active&limit=1", "secret", nil)
+	assert.Equal(t, 200, resp.Code)
+	suppliers = nil
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &suppliers))
+	if assert.Len(t, suppliers, 1) {
+		assert.Equal(t, "active", suppliers[0].State)
+	}
+	resp = do("GET", PathAdminSuppliers+"?state=pending", "secret", nil)
+	suppliers = nil
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &suppliers))
+	assert.Empty(t, suppliers)
+	resp = do("GET", PathAdminSuppliers+"?state=closed&limit=-1", "secret", nil)
+	p := problem(t, resp, 400)
+	assert.Equal(t, []com.FieldError{
+		{Field: "state", Message: "must be one of pending, active, draining"},
+		{Field: "limit", Message: "must be at least 0"},
+	}, p.Errors)
+
+	resp = do("GET", PathAdminStreams, "secret", nil)
+	assert.Equal(t, 200, resp.Code)
+	var opened []AdminStreamResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &opened))
+	found = false
+	for _, s := range opened {
+		if s.ID == connectionID {
+			found = true
+			assert.Equal(t, supplierID, s.SupplierID)
+			assert.Equal(t, streams.RandomSourceType, s.Type)
+			assert.Equal(t, int64(60), s.Age)
+		}
+	}
+	assert.True(t, found)
+
+	// drain mode refuses new suppliers, but keeps the existing ones
+	resp = do("PUT", PathAdminDrainMode, "secret", DrainMode{Enabled: true})
+	assert.Equal(t, 200, resp.Code)
+	resp = do("GET", PathAdminDrainMode, "secret", nil)
+	assert.Equal(t, jsons(DrainMode{Enabled: true}), resp.Body.String())
+	body = bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:    Random,
+		Charset: []BasicCharacter{'a', 'b', 'c'},
+	})
+	req, _ = http.NewRequest("POST", "/stream", body)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 503, resp.Code)
+	_, ok := streams.Get(connectionID)
+	assert.True(t, ok)
+	resp = do("PUT", PathAdminDrainMode, "secret", DrainMode{Enabled: false})
+	assert.Equal(t, 200, resp.Code)
+
+	stream := PathAdminStreams + "/" + strconv.FormatInt(connectionID, 10)
+	resp = do("DELETE", stream, "secret", nil)
+	assert.Equal(t, 200, resp.Code)
+	_, ok = streams.Get(connectionID)
+	assert.False(t, ok)
+	resp = do("DELETE", stream, "secret", nil)
+	assert.Equal(t, 404, resp.Code)
+
+	supplier := PathAdminSuppliers + "/" + strconv.FormatInt(supplierID, 10)
+	// closing the last Stream unregistered the StreamSupplier
+	resp = do("DELETE", supplier, "secret", nil)
+	assert.Equal(t, 404, resp.Code)
+
+	supplierID, _ = streams.Register(streams.NewRandomCharStreamSource([]streams.Character{BasicCharacter('a')}))
+	connectionID, _ = streams.Open(supplierID)
+	resp = do("DELETE", PathAdminSuppliers+"/"+strconv.FormatInt(supplierID, 10), "secret", nil)
+	assert.Equal(t, 200, resp.Code)
+	_, ok = streams.Get(connectionID)
+	assert.False(t, ok)
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	setupRegistry(t)
+	s := httptest.NewServer(r)
+	defer s.Close()
+	delivered := metric(t, "notypo_characters_delivered_total")
+	connections := metric(t, "notypo_websocket_connection_duration_seconds_count")
+
+	body := bytes.NewBuffer(make([]byte, 0))
+	json.NewEncoder(body).Encode(StreamSupplierDescription{
+		Type:    Random,
+		Charset: []BasicCharacter{'a', 'b', 'c'},
+	})
+	req, _ := http.NewRequest("POST", "/stream", body)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	var streamID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &streamID))
+	req, _ = http.NewRequest("GET", "/stream/"+strconv.FormatInt(streamID, 10), nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	var connectionID int64
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &connectionID))
+
+	assert.True(t, metric(t, `notypo_streams{type="random"}`) >= 1)
+	assert.True(t, metric(t, `notypo_suppliers{type="random"}`) >= 1)
+	assert.True(t, metric(t, `notypo_suppliers_created_total{type="random"}`) >= 1)
+	assert.True(t, metric(t, `notypo_http_request_duration_seconds_count{route="/stream",method="POST",status="200"}`) >= 1)
+	assert.True(t, metric(t, `notypo_http_request_duration_seconds_count{route="/stream/{supplier_id}",method="GET",status="200"}`) >= 1)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/stream/websocket/"+strconv.FormatInt(connectionID, 10), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, ws.WriteJSON(uint(5)))
+	for i := 0; i < 5; i++ {
+		var c rune
+		assert.NoError(t, ws.ReadJSON(&c))
+	}
+	ws.Close()
+	// the metrics are updated, when the server notices the closed connection
+	for i := 0; i < 100 && metric(t, "notypo_websocket_connection_duration_seconds_count") == connections; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, connections+1, metric(t, "notypo_websocket_connection_duration_seconds_count"))
+	assert.Equal(t, delivered+5, metric(t, "notypo_characters_delivered_total"))
+
+	closed := metric(t, `notypo_suppliers_expired_total{reason="closed"}`)
+	req, _ = http.NewRequest("DELETE", "/stream/"+strconv.FormatInt(connectionID, 10), nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, closed+1, metric(t, `notypo_suppliers_expired_total{reason="closed"}`))
+}
+
+func TestProblems(t *testing.T) {
+	setupRegistry(t, streams.WithTimeoutBounds(streams.Timeouts{}, streams.Timeouts{Idle: time.Hour}))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/stream", strings.NewReader(body))
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := post(`{"type":"Dictionary","charset":[97]}`)
+	p := problem(t, resp, 501)
+	assert.Equal(t, ProblemUnsupportedType, p.Type)
+	assert.Equal(t, "Not Implemented", p.Title)
+	assert.Equal(t, "/stream", p.Instance)
+	assert.Equal(t, []com.FieldError{{Field: "type", Message: "must be one of the types listed at /stream"}}, p.Errors)
+
+	resp = post(`{"type":"Random","charset":[]}`)
+	p = problem(t, resp, 400)
+	assert.Equal(t, com.ProblemTypeDefault, p.Type)
+	assert.Equal(t, []com.FieldError{{Field: "charset", Message: "must not be empty"}}, p.Errors)
+
+	// all invalid fields are reported at once
+	resp = post(`{"type":"other","charset":[97,98,97,10,-1],"lifetime":-1}`)
+	p = problem(t, resp, 400)
+	assert.Equal(t, []com.FieldError{
+		{Field: "type", Message: "must be one of Random, Dictionary"},
+		{Field: "charset[2]", Message: "duplicates charset[0]"},
+		{Field: "charset[3]", Message: "must be a printable character"},
+		{Field: "charset[4]", Message: "must be a printable character"},
+		{Field: "lifetime", Message: "must be at least 0"},
+	}, p.Errors)
+
+	resp = post(`{"type":"Random","charset":"abc"}`)
+	p = problem(t, resp, 400)
+	assert.Equal(t, com.ProblemTypeDefault, p.Type)
+	assert.Equal(t, "charset", p.Errors[0].Field)
+
+	resp = post(`{"type":"Random","charset":[97],"idle_timeout":7200}`)
+	p = problem(t, resp, 400)
+	assert.Equal(t, ProblemInvalidTimeouts, p.Type)
+	assert.Equal(t, "idle_timeout", p.Errors[0].Field)
+
+	req, _ := http.NewRequest("GET", "/supplier/unknown-supplier-0", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	p = problem(t, resp, 404)
+	assert.Equal(t, ProblemNoSuchSupplier, p.Type)
+	assert.Equal(t, streams.ErrNoSuchSupplier.Error(), p.Detail)
+
+	req, _ = http.NewRequest("GET", "/stream/connection/x", nil)
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	p = problem(t, resp, 400)
+	assert.Equal(t, ProblemInvalidID, p.Type)
+	assert.Equal(t, "stream_id", p.Errors[0].Field)
+	assert.Nil(t, p.Debug)
+
+	// development mode explains the cause
+	defer func(mode int) {
+		config.Server.Mode = mode
+	}(config.Server.Mode)
+	config.Server.Mode = config.ModeDevelopment
+	resp = post(`{"type":"Random","charset":"abc"}`)
+	p = problem(t, resp, 400)
+	if assert.NotNil(t, p.Debug) {
+		assert.Contains(t, p.Debug.Cause, "cannot unmarshal")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	req, _ := http.NewRequest("GET", PathOpenAPI, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &doc))
+	assert.Equal(t, config.Version, doc.Info.Version)
+	for path, method := range map[string]string{
+		PathVersion:                    "get",
+		PathCreateStream:               "post",
+		PathOpenStreamConnection:       "get",
+		PathCloseStreamConnection:      "delete",
+		PathSupplierKeepAlive:          "put",
+		PathEstablishWebsocketToStream: "get",
+		PathPrometheusMetrics:          "get",
+		PathAdminDrainMode:             "put",
+	} {
+		assert.Contains(t, doc.Paths[path], method, path)
+	}
+	assert.Equal(t, []string{"Random", "Dictionary"}, doc.Components.Schemas["StreamSourceType"].Enum)
+
+	written, err := OpenAPI()
+	assert.NoError(t, err)
+	assert.Equal(t, resp.Body.Bytes(), written)
+}
+
+// assertGoroutines asserts, that the number of goroutines drops to ngr within
+// a second. Goroutines may take a moment to exit, after they were signaled
+func assertGoroutines(t *testing.T, ngr int) {
+	for i := 0; i < 1000 && runtime.NumGoroutine() != ngr; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, ngr, runtime.NumGoroutine())
+}
+
 func jsons(i interface{}) string {
 	b, _ := json.Marshal(i)
 	return string(b)
 }
+
+// metric returns the value of the given series published at
+// PathPrometheusMetrics or 0, if there is no such series
+func metric(t *testing.T, series string) float64 {
+	req, _ := http.NewRequest("GET", PathPrometheusMetrics, nil)
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, req)
+	assert.Equal(t, 200, resp.Code)
+	for _, line := range strings.Split(resp.Body.String(), "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			assert.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+// problem asserts, that the given response is a Problem with the given status
+func problem(t *testing.T, resp *httptest.ResponseRecorder, status int) (p com.Problem) {
+	assert.Equal(t, status, resp.Code)
+	assert.Equal(t, com.ProblemContentType, resp.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &p))
+	assert.Equal(t, status, p.Status)
+	return
+}
@@ -0,0 +1,78 @@
+// Package clock abstracts the passing of time, so that all time-based behavior
+// (i.e. timeouts) can be controlled in tests. Production code uses Real, while
+// tests use a Fake, which only advances, when told to do so
+package clock
+
+import "time"
+
+// Clock provides the current time and timers
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after d has elapsed. The returned
+	// Timer's C returns nil
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTimer returns a Timer, that sends the current time on its C after d
+	// has elapsed
+	NewTimer(d time.Duration) Timer
+	// NewTicker returns a Ticker, that sends the current time on its C every
+	// d
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer works like time.Timer
+type Timer interface {
+	// C returns the channel, on which the time is sent, when the Timer fires
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns false, if the Timer
+	// has already fired or been stopped
+	Stop() bool
+	// Reset changes the Timer to fire after d. It returns false, if the Timer
+	// had fired or been stopped
+	Reset(d time.Duration) bool
+}
+
+// Ticker works like time.Ticker
+type Ticker interface {
+	// C returns the channel, on which the ticks are delivered
+	C() <-chan time.Time
+	// Stop turns off the Ticker
+	Stop()
+}
+
+// Real is the Clock backed by the time package
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+type realTimer struct {
+	*time.Timer
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,153 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock, whose time only changes, when Advance is called. Timers
+// fire synchronously within Advance in the order of their deadlines. Thus,
+// AfterFuncs have completed, when Advance returns. A Fake is safe for
+// concurrent use
+type Fake struct {
+	m      sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]bool
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	deadline time.Time
+	// period is set for Tickers
+	period time.Duration
+	// ether f or c is set
+	f func()
+	c chan time.Time
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+// NewFake returns a Fake, that starts at the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:    now,
+		timers: make(map[*fakeTimer]bool),
+	}
+}
+
+// Advance moves the Fake's time forward by d and fires all timers, whose
+// deadline is reached. Timers with a non-positive duration fire on the next
+// call to Advance, even if d is zero
+func (f *Fake) Advance(d time.Duration) {
+	f.m.Lock()
+	target := f.now.Add(d)
+	for {
+		t := f.next(target)
+		if t == nil {
+			break
+		}
+		if t.deadline.After(f.now) {
+			f.now = t.deadline
+		}
+		if t.period > 0 {
+			t.deadline = t.deadline.Add(t.period)
+		} else {
+			delete(f.timers, t)
+		}
+		now := f.now
+		f.m.Unlock()
+		t.fire(now)
+		f.m.Lock()
+	}
+	f.now = target
+	f.m.Unlock()
+}
+
+// Pending returns the number of timers, that have not fired yet
+func (f *Fake) Pending() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return len(f.timers)
+}
+
+func (f *Fake) Now() time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.now
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(&fakeTimer{f: fn}, d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(&fakeTimer{c: make(chan time.Time, 1)}, d)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for clock.Fake.NewTicker")
+	}
+	return fakeTicker{f.add(&fakeTimer{c: make(chan time.Time, 1), period: d}, d)}
+}
+
+func (f *Fake) add(t *fakeTimer, d time.Duration) *fakeTimer {
+	f.m.Lock()
+	t.clock = f
+	t.deadline = f.now.Add(d)
+	f.timers[t] = true
+	f.m.Unlock()
+	return t
+}
+
+// next returns the timer with the earliest deadline, that is not after target
+func (f *Fake) next(target time.Time) (next *fakeTimer) {
+	for t := range f.timers {
+		if t.deadline.After(target) {
+			continue
+		}
+		if next == nil || t.deadline.Before(next.deadline) {
+			next = t
+		}
+	}
+	return
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+		return
+	}
+	// drop the tick, if the receiver is too slow, just like time.Ticker does
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.m.Lock()
+	defer t.clock.m.Unlock()
+	active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.m.Lock()
+	defer t.clock.m.Unlock()
+	active := t.clock.timers[t]
+	t.deadline = t.clock.now.Add(d)
+	t.clock.timers[t] = true
+	return active
+}
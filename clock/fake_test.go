@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeFiresInOrder(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	var fired []int
+	c.AfterFunc(20*time.Millisecond, func() {
+		fired = append(fired, 2)
+	})
+	c.AfterFunc(10*time.Millisecond, func() {
+		fired = append(fired, 1)
+		assert.Equal(t, time.Unix(0, 0).Add(10*time.Millisecond), c.Now())
+	})
+	c.Advance(15 * time.Millisecond)
+	assert.Equal(t, []int{1}, fired)
+	c.Advance(5 * time.Millisecond)
+	assert.Equal(t, []int{1, 2}, fired)
+	assert.Equal(t, 0, c.Pending())
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	timer := c.NewTimer(10 * time.Millisecond)
+	assert.True(t, timer.Stop())
+	c.Advance(time.Second)
+	assert.Len(t, timer.C(), 0)
+
+	assert.False(t, timer.Reset(10*time.Millisecond))
+	c.Advance(9 * time.Millisecond)
+	assert.Len(t, timer.C(), 0)
+	assert.True(t, timer.Reset(10*time.Millisecond))
+	c.Advance(10 * time.Millisecond)
+	assert.Equal(t, time.Unix(0, 0).Add(time.Second+19*time.Millisecond), <-timer.C())
+	assert.False(t, timer.Stop())
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	ticker := c.NewTicker(10 * time.Millisecond)
+	c.Advance(10 * time.Millisecond)
+	<-ticker.C()
+	c.Advance(10 * time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	c.Advance(10 * time.Millisecond)
+	assert.Len(t, ticker.C(), 0)
+}
+
+func TestFakeZeroDuration(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	fired := false
+	c.AfterFunc(0, func() {
+		fired = true
+	})
+	assert.False(t, fired)
+	c.Advance(0)
+	assert.True(t, fired)
+}
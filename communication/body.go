@@ -0,0 +1,93 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/theMomax/notypo-backend/config"
+)
+
+// ErrTrailingData is the cause of a Problem, if a request's body contains more
+// than a single JSON value
+var ErrTrailingData = errors.New("the body contains data after the JSON value")
+
+type bodyLimitKey struct{}
+type strictKey struct{}
+
+// BodyLimit returns a Middleware, that limits the size of the route's request
+// bodies to the given number of bytes, overriding config.Limits.BodySize. 0
+// means unlimited. Larger bodies are rejected with
+// http.StatusRequestEntityTooLarge
+func BodyLimit(bytes int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, bytes)))
+		})
+	}
+}
+
+// Strict returns a Middleware, that controls, whether the route's request
+// bodies with unknown fields are rejected, overriding config.Server.StrictJSON
+func Strict(strict bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), strictKey{}, strict)))
+		})
+	}
+}
+
+// bodyLimit returns the maximum size of the request's body in bytes
+func bodyLimit(ctx context.Context) int64 {
+	if limit, ok := ctx.Value(bodyLimitKey{}).(int64); ok {
+		return limit
+	}
+	return int64(config.Limits.BodySize)
+}
+
+// strict returns true, if unknown fields must be rejected
+func strict(ctx context.Context) bool {
+	if strict, ok := ctx.Value(strictKey{}).(bool); ok {
+		return strict
+	}
+	return config.Server.StrictJSON
+}
+
+// readBody returns the body of the given request, that is to be decoded, and
+// the Codec for its Content-Type. It is rejected with
+// http.StatusUnsupportedMediaType, if no Codec is registered for it. A missing
+// Content-Type defaults to JSON. Reading more bytes than allowed by bodyLimit
+// fails
+func readBody(w http.ResponseWriter, r *http.Request) (io.Reader, Codec, *Problem) {
+	codec, ok := codecFor(r.Header.Get("Content-Type"))
+	if !ok {
+		return nil, nil, NewProblem(http.StatusUnsupportedMediaType, "", "the request's body must be of type "+strings.Join(contentTypes(), ", "))
+	}
+	limit := bodyLimit(r.Context())
+	if limit <= 0 {
+		return r.Body, codec, nil
+	}
+	if r.ContentLength > limit {
+		return nil, nil, tooLarge(limit)
+	}
+	return http.MaxBytesReader(w, r.Body, limit), codec, nil
+}
+
+// decode decodes the single value read from body into v using the request's
+// Codec. Unknown fields are rejected, if the request is strict (see Strict)
+func decode(ctx *Context, body io.Reader, v interface{}) *Problem {
+	err := ctx.codec.Decode(body, v, strict(ctx))
+	if err != nil {
+		return decodingProblem(err)
+	}
+	return nil
+}
+
+// tooLarge explains, that the request's body exceeds the given limit
+func tooLarge(limit int64) *Problem {
+	limitsExceeded.Inc(LimitBodySize)
+	return NewProblem(http.StatusRequestEntityTooLarge, "", "the request's body must not exceed "+strconv.FormatInt(limit, 10)+" bytes")
+}
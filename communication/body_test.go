@@ -0,0 +1,67 @@
+package communication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/config"
+)
+
+func TestBody(t *testing.T) {
+	defer func(strict bool, size int) {
+		config.Server.StrictJSON = strict
+		config.Limits.BodySize = size
+	}(config.Server.StrictJSON, config.Limits.BodySize)
+	config.Server.StrictJSON = false
+	config.Limits.BodySize = 32
+
+	Handle(http.MethodPost, "/body/default", func(ctx *Context, req greeting) (string, error) {
+		return req.Name, nil
+	})
+	Handle(http.MethodPost, "/body/strict", func(ctx *Context, req greeting) (string, error) {
+		return req.Name, nil
+	}, Strict(true), BodyLimit(64))
+	Post("/body/post", func(req greeting, params ParameterMap) (int, string) {
+		return http.StatusOK, req.Name
+	}, Strict(true))
+	serve := func(path, contentType, body string, status int) Problem {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, status, res.Code, path+" "+body)
+		var p Problem
+		if status != http.StatusOK {
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+		}
+		return p
+	}
+
+	serve("/body/default", "", `{"name":"max","age":3}`, http.StatusOK)
+	serve("/body/default", "application/json; charset=utf-8", `{"name":"max"}`, http.StatusOK)
+	serve("/body/default", "application/merge-patch+json", `{"name":"max"}`, http.StatusOK)
+	serve("/body/default", "text/plain", `{"name":"max"}`, http.StatusUnsupportedMediaType)
+	serve("/body/default", "", `{"name":"max"} {}`, http.StatusBadRequest)
+	serve("/body/default", "", `{"name":"max"}garbage`, http.StatusBadRequest)
+	p := serve("/body/default", "", `{"name":"`+strings.Repeat("x", 32)+`"}`, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, "the request's body must not exceed 32 bytes", p.Detail)
+
+	for _, path := range []string{"/body/strict", "/body/post"} {
+		p = serve(path, "", `{"name":"max","age":3}`, http.StatusBadRequest)
+		assert.Equal(t, []FieldError{{Field: "age", Message: "is unknown"}}, p.Errors)
+	}
+	serve("/body/strict", "", `{"name":"`+strings.Repeat("x", 32)+`"}`, http.StatusOK)
+
+	// bodies of unknown size are limited while reading
+	req := httptest.NewRequest("POST", "/body/default", strings.NewReader(`{"name":"`+strings.Repeat("x", 32)+`"}`))
+	req.ContentLength = -1
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+}
@@ -0,0 +1,266 @@
+package communication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes and decodes request- and response-values in a specific format.
+// Codecs must honor the values' json tags
+type Codec interface {
+	// Name identifies the Codec as websocket subprotocol
+	Name() string
+	// ContentType is the media type of encoded values
+	ContentType() string
+	// Binary returns true, if encoded values aren't text, i.e. they are sent
+	// as binary websocket messages
+	Binary() bool
+	Encode(w io.Writer, v interface{}) error
+	// Decode decodes the single value read from r into v. Unknown fields are
+	// rejected, if strict is true. Data after the value results in
+	// ErrTrailingData
+	Decode(r io.Reader, v interface{}, strict bool) error
+}
+
+// the Codecs registered by default
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+	CBOR        Codec = newCBORCodec()
+)
+
+// codecs holds the registered Codecs in the order of preference. The first
+// one is the default
+var codecs = []Codec{JSON, MessagePack, CBOR}
+var codecm sync.RWMutex
+
+// RegisterCodec registers a Codec. It replaces a registered Codec with the
+// same ContentType. REST requests choose Codecs via the Content-Type and
+// Accept headers. Streams choose them via the websocket subprotocol. Without
+// either, JSON is used. Problems are always written in JSON format
+func RegisterCodec(c Codec) {
+	codecm.Lock()
+	defer codecm.Unlock()
+	for i, registered := range codecs {
+		if registered.ContentType() == c.ContentType() {
+			codecs[i] = c
+			return
+		}
+	}
+	codecs = append(codecs, c)
+}
+
+// codecFor returns the Codec for the given Content-Type. Media types with the
+// suffix +json are decoded by JSON
+func codecFor(contentType string) (Codec, bool) {
+	if contentType == "" {
+		return JSON, true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codecm.RLock()
+	defer codecm.RUnlock()
+	for _, c := range codecs {
+		if c.ContentType() == mediaType {
+			return c, true
+		}
+	}
+	if strings.HasSuffix(mediaType, "+json") {
+		return JSON, true
+	}
+	return nil, false
+}
+
+// negotiate returns the preferred Codec, that is acceptable according to the
+// given Accept header. It returns false, if none is
+func negotiate(accept string) (Codec, bool) {
+	if accept == "" {
+		return JSON, true
+	}
+	type option struct {
+		mediaType string
+		q         float64
+	}
+	var options []option
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			options = append(options, option{mediaType, q})
+		}
+	}
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].q > options[j].q
+	})
+	codecm.RLock()
+	defer codecm.RUnlock()
+	for _, o := range options {
+		for _, c := range codecs {
+			if o.mediaType == c.ContentType() || o.mediaType == "*/*" ||
+				(strings.HasSuffix(o.mediaType, "/*") && strings.HasPrefix(c.ContentType(), strings.TrimSuffix(o.mediaType, "*"))) {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// contentTypes returns the ContentTypes of all registered Codecs
+func contentTypes() []string {
+	codecm.RLock()
+	defer codecm.RUnlock()
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = c.ContentType()
+	}
+	return types
+}
+
+// subprotocols returns the Names of all registered Codecs
+func subprotocols() []string {
+	codecm.RLock()
+	defer codecm.RUnlock()
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// codecNamed returns the Codec with the given Name. It defaults to JSON
+func codecNamed(name string) Codec {
+	codecm.RLock()
+	defer codecm.RUnlock()
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+func (jsonCodec) Binary() bool        { return false }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}, strict bool) error {
+	dec := json.NewDecoder(r)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+func (msgpackCodec) Binary() bool        { return true }
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	return enc.Encode(v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}, strict bool) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(strict)
+	err := dec.Decode(v)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.PeekCode(); err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+type cborCodec struct {
+	enc    cbor.EncMode
+	dec    cbor.DecMode
+	strict cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	strict, err := cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{enc: enc, dec: dec, strict: strict}
+}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+func (cborCodec) Binary() bool        { return true }
+
+func (c cborCodec) Encode(w io.Writer, v interface{}) error {
+	return c.enc.NewEncoder(w).Encode(v)
+}
+
+func (c cborCodec) Decode(r io.Reader, v interface{}, strict bool) error {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return err
+	}
+	dec := c.dec
+	if strict {
+		dec = c.strict
+	}
+	err = dec.Unmarshal(buf.Bytes(), v)
+	var extra *cbor.ExtraneousDataError
+	if errors.As(err, &extra) {
+		return ErrTrailingData
+	}
+	return err
+}
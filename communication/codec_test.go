@@ -0,0 +1,136 @@
+package communication
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/streams"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	for accept, expected := range map[string]Codec{
+		"":                               JSON,
+		"*/*":                            JSON,
+		"application/*":                  JSON,
+		"application/cbor":               CBOR,
+		"application/msgpack, */*;q=0.1": MessagePack,
+		"application/json;q=0.5, application/cbor": CBOR,
+		"text/html, application/msgpack;q=0.9":     MessagePack,
+		"text/html":                                nil,
+		"application/json;q=0":                     nil,
+	} {
+		codec, ok := negotiate(accept)
+		assert.Equal(t, expected != nil, ok, accept)
+		assert.Equal(t, expected, codec, accept)
+	}
+
+	for contentType, expected := range map[string]Codec{
+		"":                                JSON,
+		"application/json; charset=utf-8": JSON,
+		"application/merge-patch+json":    JSON,
+		"application/msgpack":             MessagePack,
+		"application/cbor":                CBOR,
+		"text/plain":                      nil,
+	} {
+		codec, ok := codecFor(contentType)
+		assert.Equal(t, expected != nil, ok, contentType)
+		assert.Equal(t, expected, codec, contentType)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	Handle(http.MethodPost, "/codec", func(ctx *Context, req greeting) (greeting, error) {
+		return greeting{Name: "hello " + req.Name}, nil
+	})
+	Post("/codec/post", func(req greeting, params ParameterMap) (int, greeting) {
+		return http.StatusOK, greeting{Name: "hello " + req.Name}
+	})
+	for _, codec := range []Codec{JSON, MessagePack, CBOR} {
+		for _, path := range []string{"/codec", "/codec/post"} {
+			var body bytes.Buffer
+			assert.NoError(t, codec.Encode(&body, greeting{Name: "max"}))
+			req := httptest.NewRequest("POST", path, &body)
+			req.Header.Set("Content-Type", codec.ContentType())
+			req.Header.Set("Accept", codec.ContentType())
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusOK, res.Code, codec.Name())
+			assert.Equal(t, codec.ContentType(), res.Header().Get("Content-Type"))
+			var g greeting
+			assert.NoError(t, codec.Decode(res.Body, &g, true), codec.Name())
+			assert.Equal(t, "hello max", g.Name)
+		}
+
+		// trailing data and unknown fields are rejected by all codecs
+		var body bytes.Buffer
+		codec.Encode(&body, greeting{Name: "max"})
+		codec.Encode(&body, greeting{Name: "max"})
+		assert.Equal(t, ErrTrailingData, codec.Decode(&body, &greeting{}, false), codec.Name())
+		body.Reset()
+		codec.Encode(&body, map[string]interface{}{"name": "max", "age": 3})
+		assert.Error(t, codec.Decode(bytes.NewReader(body.Bytes()), &greeting{}, true), codec.Name())
+		assert.NoError(t, codec.Decode(bytes.NewReader(body.Bytes()), &greeting{}, false), codec.Name())
+	}
+
+	req := httptest.NewRequest("POST", "/codec", strings.NewReader(`{"name":"max"}`))
+	req.Header.Set("Accept", "text/html")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNotAcceptable, res.Code)
+}
+
+func TestStreamSubprotocols(t *testing.T) {
+	id, _ := streams.Register(streams.NewRandomCharStreamSource([]streams.Character{char('a')}))
+	Stream("/codec/websocket", func(ctx *Context) (int, streams.Stream) {
+		streamID, err := streams.Open(id)
+		if err != nil {
+			return http.StatusNotFound, nil
+		}
+		s, _ := streams.Get(streamID)
+		return http.StatusOK, s
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/codec/websocket"
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{"msgpack"}
+	conn, _, err := dialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "msgpack", conn.Subprotocol())
+	request, _ := msgpack.Marshal(2)
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, request))
+	for i := 0; i < 2; i++ {
+		messageType, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, messageType)
+		var c rune
+		assert.NoError(t, msgpack.Unmarshal(message, &c))
+		assert.Equal(t, 'a', c)
+	}
+	conn.Close()
+
+	dialer.Subprotocols = []string{"unknown", "cbor"}
+	conn, _, err = dialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assert.Equal(t, "cbor", conn.Subprotocol())
+	request, _ = cbor.Marshal(1)
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, request))
+	_, message, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	var c rune
+	assert.NoError(t, cbor.Unmarshal(message, &c))
+	assert.Equal(t, 'a', c)
+}
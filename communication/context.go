@@ -0,0 +1,49 @@
+package communication
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Context describes the request a handler-function is called for. It is passed
+// to all kinds of handler-functions. As a context.Context, it is canceled, when
+// the client's connection closes. Params contains the request's path variables
+// (see ParameterMap), Query its query parameters (see BindQuery) and Header its
+// headers. Client is the ip of the requesting client, RequestID the request's
+// id (see RequestIDHeader) and User the name of the authenticated user. User is
+// empty, if the route doesn't require authentication (see Authenticate)
+type Context struct {
+	context.Context
+	Params    ParameterMap
+	Query     url.Values
+	Header    http.Header
+	Client    string
+	RequestID string
+	User      string
+
+	// codec decodes the request's body
+	codec Codec
+}
+
+type userKey struct{}
+
+// newContext returns the Context of the given request
+func newContext(r *http.Request) *Context {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return &Context{
+		Context:   r.Context(),
+		Params:    parameters(r),
+		Query:     r.URL.Query(),
+		Header:    r.Header,
+		Client:    client(r),
+		RequestID: requestID(r),
+		User:      user,
+	}
+}
+
+// withUser returns a copy of the given request, whose context carries the
+// given user
+func withUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
@@ -0,0 +1,82 @@
+package communication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type listQuery struct {
+	N       int           `query:"n"`
+	Format  string        `query:"format"`
+	Verbose *bool         `query:"verbose"`
+	Timeout time.Duration `query:"timeout"`
+	IDs     []uint        `query:"id"`
+	Ignored string
+}
+
+func TestContext(t *testing.T) {
+	guard := Authenticate("test", func(r *http.Request) (string, bool) {
+		return "max", true
+	})
+	var ctx *Context
+	Handle(http.MethodGet, "/context/{id}", func(c *Context, req interface{}) (NoResponse, error) {
+		ctx = c
+		return NoResponse{}, nil
+	}, guard)
+
+	req := httptest.NewRequest("GET", "/context/7?format=text", nil)
+	req.Header.Set("X-Custom", "custom")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if !assert.NotNil(t, ctx) {
+		return
+	}
+	assert.NoError(t, ctx.Err())
+	assert.Equal(t, "7", ctx.Params["id"])
+	assert.Equal(t, "text", ctx.Query.Get("format"))
+	assert.Equal(t, "custom", ctx.Header.Get("X-Custom"))
+	assert.Equal(t, "192.0.2.1", ctx.Client)
+	assert.Equal(t, res.Header().Get(RequestIDHeader), ctx.RequestID)
+	assert.Equal(t, "max", ctx.User)
+}
+
+func TestBindQuery(t *testing.T) {
+	bind := func(query string) (listQuery, error) {
+		r := httptest.NewRequest("GET", "/?"+query, nil)
+		q := listQuery{N: 100, Ignored: "default"}
+		return q, newContext(r).BindQuery(&q)
+	}
+
+	q, err := bind("")
+	assert.NoError(t, err)
+	assert.Equal(t, listQuery{N: 100, Ignored: "default"}, q)
+
+	q, err = bind("n=5&format=text&verbose=true&timeout=1m&id=1&id=2&Ignored=x")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, q.N)
+	assert.Equal(t, "text", q.Format)
+	if assert.NotNil(t, q.Verbose) {
+		assert.True(t, *q.Verbose)
+	}
+	assert.Equal(t, time.Minute, q.Timeout)
+	assert.Equal(t, []uint{1, 2}, q.IDs)
+	assert.Equal(t, "default", q.Ignored)
+
+	_, err = bind("n=many&verbose=maybe&id=-1")
+	p, ok := err.(*Problem)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusBadRequest, p.Status)
+		fields := make([]string, len(p.Errors))
+		for i, e := range p.Errors {
+			fields[i] = e.Field
+		}
+		assert.Equal(t, []string{"n", "verbose", "id"}, fields)
+	}
+
+	assert.Equal(t, ErrIllegalQueryTarget, newContext(httptest.NewRequest("GET", "/", nil)).BindQuery(listQuery{}))
+}
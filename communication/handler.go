@@ -0,0 +1,238 @@
+package communication
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// HandlerFunc is a type-safe handler-function. ctx describes the request (see
+// Context). The request's body is decoded into req, unless Req is an interface
+// type (e.g. interface{}) or the method is GET or OPTIONS. A malformed or
+// invalid (see Validator) body is rejected with http.StatusBadRequest before
+// the handler-function is called, as are unknown fields in strict mode (see
+// Strict). Bodies, that no Codec can decode, are rejected with
+// http.StatusUnsupportedMediaType and bodies exceeding the size limit (see
+// BodyLimit) with http.StatusRequestEntityTooLarge. res is written with
+// http.StatusOK, unless it implements StatusCoder or is a NoResponse. If err is
+// not nil, it is written as Problem instead (see Problem). Request- and
+// response-values are encoded by the Codecs chosen via the Content-Type and
+// Accept headers (see RegisterCodec)
+type HandlerFunc[Req, Res any] func(ctx *Context, req Req) (res Res, err error)
+
+// StatusCoder is implemented by responses, that are written with another
+// status than http.StatusOK
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// NoResponse is the response of handler-functions, that only respond with a
+// status
+type NoResponse struct{}
+
+// Handle registers a handler-function for the given http method. The given
+// middlewares only wrap this handler (see Use). The returned Operation
+// documents the route (see OpenAPI)
+func Handle[Req, Res any](method, path string, handler HandlerFunc[Req, Res], middlewares ...Middleware) *Operation {
+	return handle(router, method, path, handler.withStatus(), middlewares)
+}
+
+// AdminHandle registers a handler-function for the given http method on the
+// admin-api
+func AdminHandle[Req, Res any](method, path string, handler HandlerFunc[Req, Res], middlewares ...Middleware) *Operation {
+	return handle(adminRouter, method, path, handler.withStatus(), middlewares)
+}
+
+// statusHandlerFunc is a handler-function, that returns the response's status
+// explicitly. All registering-functions are based on it
+type statusHandlerFunc[Req, Res any] func(ctx *Context, req Req) (status int, res Res, err error)
+
+// withStatus converts the handler-function to a statusHandlerFunc
+func (h HandlerFunc[Req, Res]) withStatus() statusHandlerFunc[Req, Res] {
+	return func(ctx *Context, req Req) (int, Res, error) {
+		res, err := h(ctx, req)
+		if coder, ok := interface{}(res).(StatusCoder); ok {
+			return coder.StatusCode(), res, err
+		}
+		return http.StatusOK, res, err
+	}
+}
+
+// handle registers the given handler-function on the given router and
+// documents its route
+func handle[Req, Res any](router *mux.Router, method, path string, handler statusHandlerFunc[Req, Res], middlewares []Middleware) *Operation {
+	requestT := reflect.TypeOf((*Req)(nil)).Elem()
+	decodes := method != http.MethodGet && method != http.MethodOptions &&
+		requestT.Kind() != reflect.Interface
+	router.Handle(path, route(func(w http.ResponseWriter, r *http.Request) {
+		codec, ok := negotiate(r.Header.Get("Accept"))
+		if !ok {
+			writeError(w, r, http.StatusNotAcceptable, "the response can only be of type "+strings.Join(contentTypes(), ", "))
+			return
+		}
+		ctx := newContext(r)
+		var req Req
+		if decodes {
+			body, bodyCodec, p := readBody(w, r)
+			if p == nil {
+				ctx.codec = bodyCodec
+				p = decodeRequest(ctx, body, &req)
+			}
+			if p != nil {
+				writeProblem(w, r, p)
+				return
+			}
+		}
+		status, res, err := handler(ctx, req)
+		respond(w, r, codec, status, res, err)
+	}, middlewares)).Methods(method)
+	op := document(router, method, path)
+	if decodes {
+		op.request = requestT
+	}
+	op.response = reflect.TypeOf((*Res)(nil)).Elem()
+	return op
+}
+
+// rawBody is the request-value of handler-functions, that decode the
+// request's body themselves
+type rawBody []byte
+
+// decodeRequest decodes and validates the request's body. A rawBody is only
+// read, so that the handler-function can decode it later on
+func decodeRequest(ctx *Context, body io.Reader, v interface{}) *Problem {
+	if raw, ok := v.(*rawBody); ok {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return decodingProblem(err)
+		}
+		*raw = data
+		return nil
+	}
+	if p := decode(ctx, body, v); p != nil {
+		return p
+	}
+	if errs := validate(v, "json"); len(errs) > 0 {
+		return invalid(errs)
+	}
+	return nil
+}
+
+// reflectHandler adapts a handler-function of the types HandleGetFunc,
+// HandlePostFunc, ... to a statusHandlerFunc
+type reflectHandler struct {
+	fn reflect.Value
+	// requestT is the type of the request-value. It is nil, if the
+	// handler-function doesn't take one
+	requestT reflect.Type
+	// decode is false, if the request-value is an interface{}
+	decode bool
+	// withContext is true, if the handler-function takes a *Context instead
+	// of a ParameterMap
+	withContext  bool
+	withResponse bool
+}
+
+// newReflectHandler asserts, that the given handler-function takes a
+// request-value (if withRequest) and a ParameterMap or *Context and returns a status, a
+// response (if withResponse) and optionally an error. It panics with
+// ErrIllegalHandleFunc otherwise
+func newReflectHandler(handler interface{}, withRequest, withResponse bool) *reflectHandler {
+	hT := reflect.TypeOf(handler)
+	if hT == nil || hT.Kind() != reflect.Func {
+		panic(ErrIllegalHandleFunc)
+	}
+	in, out := 1, 1
+	if withRequest {
+		in++
+	}
+	if withResponse {
+		out++
+	}
+	if hT.NumIn() != in || !validResults(hT, out) {
+		panic(ErrIllegalHandleFunc)
+	}
+	paramsT := hT.In(in - 1)
+	withContext := paramsT == contextType
+	if !withContext && (paramsT.Kind() != reflect.Map || paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String) {
+		panic(ErrIllegalHandleFunc)
+	}
+	if hT.Out(0).Kind() != reflect.Int {
+		panic(ErrIllegalHandleFunc)
+	}
+	h := &reflectHandler{fn: reflect.ValueOf(handler), withContext: withContext, withResponse: withResponse}
+	if withRequest {
+		h.requestT = hT.In(0)
+		h.decode = h.requestT.String() != "interface {}" && h.requestT.String() != "*interface {}"
+	}
+	return h
+}
+
+// register registers the handler-function on the given router. The route is
+// documented with the handler-function's request- and response-type
+func (h *reflectHandler) register(router *mux.Router, method, path string, middlewares []Middleware) *Operation {
+	var op *Operation
+	if h.decode {
+		op = handle(router, method, path, h.call, middlewares)
+		op.request = h.requestT
+	} else {
+		op = handle(router, method, path, func(ctx *Context, req interface{}) (int, interface{}, error) {
+			return h.call(ctx, nil)
+		}, middlewares)
+	}
+	op.response = noResponseType
+	if h.withResponse {
+		op.response = h.fn.Type().Out(1)
+	}
+	return op
+}
+
+// call decodes the given request-body and calls the handler-function
+func (h *reflectHandler) call(ctx *Context, body rawBody) (int, interface{}, error) {
+	in := make([]reflect.Value, 0, 2)
+	if h.requestT != nil {
+		request := reflect.New(h.requestT)
+		if h.decode {
+			if p := decodeRequest(ctx, bytes.NewReader(body), request.Interface()); p != nil {
+				return 0, nil, p
+			}
+		}
+		in = append(in, request.Elem())
+	}
+	if h.withContext {
+		in = append(in, reflect.ValueOf(ctx))
+	} else {
+		in = append(in, reflect.ValueOf(ctx.Params))
+	}
+	out := h.fn.Call(in)
+	if !h.withResponse {
+		return int(out[0].Int()), NoResponse{}, handlerError(out, 1)
+	}
+	return int(out[0].Int()), out[1].Interface(), handlerError(out, 2)
+}
+
+var (
+	// errorType is the type of the error interface
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*Context)(nil))
+)
+
+// validResults returns true, if the given handler-type has n results, or n+1
+// results, the last one being an error
+func validResults(hT reflect.Type, n int) bool {
+	return hT.NumOut() == n || (hT.NumOut() == n+1 && hT.Out(n) == errorType)
+}
+
+// handlerError returns the error returned by a handler as the result with the
+// given index, if it returned one
+func handlerError(out []reflect.Value, i int) error {
+	if len(out) <= i {
+		return nil
+	}
+	err, _ := out[i].Interface().(error)
+	return err
+}
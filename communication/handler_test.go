@@ -0,0 +1,79 @@
+package communication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+type created struct {
+	ID int `json:"id"`
+}
+
+func (created) StatusCode() int {
+	return http.StatusCreated
+}
+
+func TestHandle(t *testing.T) {
+	Handle(http.MethodPost, "/handler/{id}", func(ctx *Context, req greeting) (string, error) {
+		assert.NotEmpty(t, ctx.RequestID)
+		return "hello " + req.Name + " " + ctx.Params["id"], nil
+	})
+	Handle(http.MethodPut, "/handler/{id}", func(ctx *Context, req *greeting) (created, error) {
+		return created{ID: len(req.Name)}, nil
+	})
+	Handle(http.MethodDelete, "/handler/{id}", func(ctx *Context, req interface{}) (NoResponse, error) {
+		assert.Nil(t, req)
+		return NoResponse{}, nil
+	})
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(method, "/handler/7", strings.NewReader(body)))
+		return res
+	}
+
+	res := serve("POST", `{"name":"max"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	assert.Equal(t, `"hello max 7"`, res.Body.String())
+
+	res = serve("POST", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, ProblemContentType, res.Header().Get("Content-Type"))
+
+	res = serve("PUT", `{"name":"max"}`)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, `{"id":3}`, res.Body.String())
+
+	res = serve("DELETE", `ignored`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Body.String())
+}
+
+func BenchmarkHandle(b *testing.B) {
+	Handle(http.MethodPost, "/benchmark/handle", func(ctx *Context, req greeting) (string, error) {
+		return req.Name, nil
+	})
+	benchmarkRoute(b, "/benchmark/handle")
+}
+
+func BenchmarkPost(b *testing.B) {
+	Post("/benchmark/post", func(req greeting, params map[string]string) (int, string) {
+		return http.StatusOK, req.Name
+	})
+	benchmarkRoute(b, "/benchmark/post")
+}
+
+func benchmarkRoute(b *testing.B, path string) {
+	for i := 0; i < b.N; i++ {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("POST", path, strings.NewReader(`{"name":"max"}`)))
+	}
+}
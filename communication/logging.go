@@ -0,0 +1,99 @@
+package communication
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/theMomax/notypo-backend/logging"
+)
+
+// RequestIDHeader is the header, that carries a request's id. If a request
+// doesn't carry an id, one is generated. The id is sent back in the response's
+// header and added to all log records concerning the request
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of an id sent by a client. Longer
+// ids are replaced
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// withLogger returns a copy of the given request, whose context carries the
+// request's id and a logger, that adds the id and the request's path variables
+// (e.g. supplier_id) to each record. The id is written to w's header. If the
+// request passed withLogger before, its id and logger are kept and only the
+// path variables are added
+func withLogger(w http.ResponseWriter, r *http.Request) *http.Request {
+	var attrs []interface{}
+	logger := slog.Default()
+	id := requestID(r)
+	if id != "" {
+		logger = logging.FromContext(r.Context())
+	} else {
+		id = r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		attrs = append(attrs, "request_id", id)
+	}
+
+	vars := mux.Vars(r)
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attrs = append(attrs, name, vars[name])
+	}
+	ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+	ctx = logging.NewContext(ctx, logger.With(attrs...))
+	return r.WithContext(ctx)
+}
+
+// requestID returns the id of the given request. It is empty, if the request
+// didn't pass withLogger
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID returns true, if the given id is neither empty nor too long and
+// consists of printable ascii characters only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random hex-encoded id
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logAccess writes the access log record of a request to the given route
+func logAccess(r *http.Request, route string, status int, duration time.Duration) {
+	logging.FromContext(r.Context()).Info("request",
+		"method", r.Method,
+		"route", route,
+		"path", r.URL.Path,
+		"status", status,
+		"duration", duration,
+		"client", client(r),
+	)
+}
@@ -0,0 +1,78 @@
+package communication
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/logging"
+)
+
+func TestRequestLogging(t *testing.T) {
+	var b bytes.Buffer
+	logger, _ := logging.New(&b, "info", logging.FormatText)
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+
+	Get("/logging/{supplier_id}", func(ctx *Context) (int, string) {
+		return http.StatusOK, ctx.RequestID
+	})
+
+	req := httptest.NewRequest("GET", "/logging/42", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "abc", res.Header().Get(RequestIDHeader))
+	assert.Equal(t, `"abc"`, res.Body.String())
+	assert.Contains(t, b.String(), "msg=request request_id=abc supplier_id=42 method=GET route=/logging/{supplier_id} path=/logging/42 status=200")
+
+	// invalid ids are replaced
+	b.Reset()
+	req = httptest.NewRequest("GET", "/logging/42", nil)
+	req.Header.Set(RequestIDHeader, strings.Repeat("a", maxRequestIDLength+1))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	id := res.Header().Get(RequestIDHeader)
+	assert.Len(t, id, 32)
+	assert.Contains(t, b.String(), "request_id="+id)
+}
+
+func TestAdminRequestLogging(t *testing.T) {
+	var b bytes.Buffer
+	logger, _ := logging.New(&b, "info", logging.FormatText)
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logger)
+	defer func(token string) {
+		config.Admin.Token = token
+	}(config.Admin.Token)
+	config.Admin.Token = "secret"
+
+	AdminGet(AdminPrefix+"/logging", func(params map[string]string) (int, string) {
+		return http.StatusOK, ""
+	})
+	handler := AdminHandler()
+
+	// failed authentications are logged with the request's id
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", AdminPrefix+"/logging", nil))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Contains(t, b.String(), "msg=\"authentication failed\" request_id="+res.Header().Get(RequestIDHeader))
+
+	// the id is assigned only once
+	b.Reset()
+	req := httptest.NewRequest("GET", AdminPrefix+"/logging", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(RequestIDHeader, "abc")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "abc", res.Header().Get(RequestIDHeader))
+	assert.Contains(t, b.String(), "msg=request request_id=abc user="+AdminUser)
+	assert.Equal(t, 1, strings.Count(b.String(), "request_id="))
+}
@@ -0,0 +1,103 @@
+package communication
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/theMomax/notypo-backend/metrics"
+)
+
+// metrics published in the Prometheus format
+var (
+	requestDuration = metrics.NewHistogram(
+		"notypo_http_request_duration_seconds",
+		"Latency of the requests to the routes registered via Get, Post, Put, Delete and Options by route, method and status.",
+		metrics.DefBuckets,
+		"route", "method", "status",
+	)
+	websocketDuration = metrics.NewHistogram(
+		"notypo_websocket_connection_duration_seconds",
+		"Duration of the websocket connections to streams.",
+		[]float64{1, 10, 60, 300, 900, 1800, 3600, 7200, 10800},
+	)
+	charactersDelivered = metrics.NewCounter(
+		"notypo_characters_delivered_total",
+		"Number of characters sent via websocket connections.",
+	)
+	limitsExceeded = metrics.NewCounter(
+		"notypo_http_limits_exceeded_total",
+		"Number of requests and websocket connections rejected by exceeded limit (e.g. body_size).",
+		"limit",
+	)
+)
+
+// Prometheus registers a handler, that publishes all metrics in the Prometheus
+// text exposition format (see package metrics)
+func Prometheus(path string, middlewares ...Middleware) *Operation {
+	router.Handle(path, route(metrics.Handler().ServeHTTP, middlewares)).Methods("GET")
+	op := document(router, http.MethodGet, path)
+	op.response = reflect.TypeOf("")
+	op.produces = "text/plain; version=0.0.4"
+	return op
+}
+
+// Timing is a Middleware, that measures the latency of each request by route,
+// method and status and writes the request's access log
+func Timing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		duration := time.Since(start)
+		route := routeOf(r)
+		requestDuration.Observe(duration.Seconds(), route, r.Method, strconv.Itoa(sw.status))
+		logAccess(r, route, sw.status, duration)
+	})
+}
+
+// routeOf returns the path template of the route matched by the given request
+// or its path, if it didn't match a route
+func routeOf(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// statusWriter remembers the status written to the wrapped
+// http.ResponseWriter and whether anything was sent at all
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Hijack passes the connection of the wrapped http.ResponseWriter on, so that
+// it can be upgraded to a websocket
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	w.written = true
+	return h.Hijack()
+}
@@ -0,0 +1,118 @@
+package communication
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/theMomax/notypo-backend/logging"
+)
+
+// Middleware wraps a handler, e.g. to reject requests before they reach it or
+// to inspect its responses. Middlewares, that wrap the handler of a Stream,
+// must pass the original http.ResponseWriter on, so that the connection can be
+// upgraded
+type Middleware func(next http.Handler) http.Handler
+
+// middlewares holds the global middlewares registered via Use
+var middlewares []Middleware
+
+// Use registers global middlewares. They wrap the handlers of all routes
+// registered afterwards via Get, Post, ..., AdminGet, ... and Stream. Each
+// route's handler is wrapped in the following order, the first being the
+// outermost: RequestID, Timing (except for Streams, which log their sessions
+// themselves), Recover, the global middlewares and the route's own
+// middlewares, each in the order they were given
+func Use(mw ...Middleware) {
+	middlewares = append(middlewares, mw...)
+}
+
+// route wraps the handler of a REST route in the built-in, the global and the
+// route's own middlewares
+func route(handler http.HandlerFunc, own []Middleware) http.Handler {
+	mw := append([]Middleware{RequestID, Timing, Recover}, middlewares...)
+	return chain(handler, append(mw, own...)...)
+}
+
+// streamRoute wraps the handler of a Stream in the built-in, the global and
+// the Stream's own middlewares
+func streamRoute(handler http.HandlerFunc, own []Middleware) http.Handler {
+	mw := append([]Middleware{RequestID, Recover}, middlewares...)
+	return chain(handler, append(mw, own...)...)
+}
+
+// chain returns the given handler wrapped in the given middlewares, the first
+// being the outermost
+func chain(handler http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+	return handler
+}
+
+// RequestID is a Middleware, that assigns an id to each request (see
+// RequestIDHeader). The request passed on carries a logger, that adds the id
+// and the request's path variables to each record (see logging.FromContext)
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, withLogger(w, r))
+	})
+}
+
+// Recover is a Middleware, that recovers from panics of the wrapped handler.
+// The panic is logged and http.StatusInternalServerError is written as
+// Problem. In development mode, the Problem contains the panic and its stack
+// trace. If the handler has already sent (parts of) its response, the
+// connection is aborted instead, just like http.ErrAbortHandler, which is
+// passed on
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			stack := debug.Stack()
+			logging.FromContext(r.Context()).Error("handler panicked",
+				"panic", fmt.Sprint(v),
+				"stack", string(stack),
+			)
+			if sw.written {
+				panic(http.ErrAbortHandler)
+			}
+			p := NewProblem(http.StatusInternalServerError, "", "").WithCause(fmt.Errorf("panic: %v", v))
+			p.Debug = &ProblemDebug{Stack: string(stack)}
+			writeProblem(w, r, p)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Authenticate returns a Middleware, that rejects requests, for which
+// authenticate returns false, with http.StatusUnauthorized. The response asks
+// for a bearer token for the given realm. Otherwise the returned user is passed
+// on to the handler-function (see Context) and added to each log record
+func Authenticate(realm string, authenticate func(r *http.Request) (user string, ok bool)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := authenticate(r)
+			if !ok {
+				logging.FromContext(r.Context()).Warn("authentication failed",
+					"realm", realm,
+					"path", r.URL.Path,
+					"client", client(r),
+				)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`"`)
+				writeError(w, r, http.StatusUnauthorized, "missing or invalid "+realm+" token")
+				return
+			}
+			r = withUser(r, user)
+			logger := logging.FromContext(r.Context()).With("user", user)
+			next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), logger)))
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package communication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tag returns a Middleware, that appends the given name to the X-Trace header
+// of the request and the response
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Trace", name)
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	defer func(global []Middleware) {
+		middlewares = global
+	}(middlewares)
+	Use(tag("global1"), tag("global2"))
+
+	var trace []string
+	Get("/middleware", func(params map[string]string) (int, interface{}) {
+		return http.StatusOK, nil
+	}, tag("route1"), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace = r.Header["X-Trace"]
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/middleware", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, []string{"global1", "global2", "route1"}, trace)
+	assert.NotEmpty(t, res.Header().Get(RequestIDHeader))
+
+	// global middlewares only wrap routes registered afterwards
+	middlewares = nil
+	Get("/middleware/later", func(params map[string]string) (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/middleware/later", nil))
+	assert.Empty(t, res.Header()["X-Trace"])
+}
+
+func TestRecover(t *testing.T) {
+	Post("/middleware/panic", func(req interface{}, params map[string]string) (int, interface{}) {
+		panic("oops")
+	})
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("POST", "/middleware/panic", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, ProblemContentType, res.Header().Get("Content-Type"))
+	var p Problem
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, "/middleware/panic", p.Instance)
+	assert.NotEmpty(t, res.Header().Get(RequestIDHeader))
+
+	// responses, that were already sent, are aborted
+	res = httptest.NewRecorder()
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("oops")
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(res, httptest.NewRequest("GET", "/middleware/panic", nil))
+	})
+	assert.Equal(t, http.StatusAccepted, res.Code)
+	assert.Empty(t, res.Body.String())
+}
+
+func TestAuthenticate(t *testing.T) {
+	guard := Authenticate("test", func(r *http.Request) (string, bool) {
+		return "max", r.Header.Get("Authorization") == "Bearer secret"
+	})
+	Put("/middleware/guarded", func(req interface{}, ctx *Context) int {
+		assert.Equal(t, "max", ctx.User)
+		return http.StatusNoContent
+	}, guard)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("PUT", "/middleware/guarded", nil))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.Equal(t, `Bearer realm="test"`, res.Header().Get("WWW-Authenticate"))
+
+	req := httptest.NewRequest("PUT", "/middleware/guarded", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+}
@@ -0,0 +1,622 @@
+package communication
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification, that the
+// document returned by OpenAPI conforms to
+const OpenAPIVersion = "3.0.3"
+
+// adminScheme is the name of the admin-api's security scheme
+const adminScheme = "adminToken"
+
+// Info describes the api as a whole in the OpenAPI document. Tags maps the
+// names of the Operations' tags (see Operation.Tag) to their descriptions
+type Info struct {
+	Title       string
+	Description string
+	Version     string
+	Tags        map[string]string
+}
+
+// Enumerable is implemented by types, whose values are limited to a fixed set,
+// e.g. enums. The values are listed in the OpenAPI document
+type Enumerable interface {
+	Enum() []interface{}
+}
+
+// Operation documents a registered route in the OpenAPI document (see
+// OpenAPI). The registering-functions record the route's method, path,
+// path-parameters, request- and response-type and the statuses, that this
+// package responds with itself (e.g. http.StatusUnsupportedMediaType). The
+// statuses, that the handler-function responds with, and human-readable
+// descriptions are added via the Operation's methods, e.g.
+//
+//	com.Handle(http.MethodGet, "/stream/{id}", openStream).
+//		Summary("Opens a connection to a Stream.").
+//		Param("id", "the Stream's id").
+//		Responds(http.StatusNotFound, "The Stream doesn't exist.")
+type Operation struct {
+	method string
+	path   string
+	admin  bool
+	// websocket is true, if the route is a Stream
+	websocket bool
+	// request is nil, if the request's body isn't decoded
+	request  reflect.Type
+	response reflect.Type
+	// message is the type of the values sent by a Stream
+	message reflect.Type
+	// produces overrides the Content-Types of successful responses, if the
+	// route doesn't use Codecs
+	produces    string
+	summary     string
+	description string
+	tags        []string
+	params      map[string]string
+	responses   map[int]*documentedResponse
+}
+
+// documentedResponse is a response declared via Operation.Responds
+type documentedResponse struct {
+	description string
+	types       []reflect.Type
+}
+
+// operations holds the Operations of all registered routes in the order they
+// were registered
+var operations []*Operation
+var operationm sync.Mutex
+
+var (
+	noResponseType    = reflect.TypeOf(NoResponse{})
+	problemType       = reflect.TypeOf(Problem{})
+	statusCoderType   = reflect.TypeOf((*StatusCoder)(nil)).Elem()
+	enumerableType    = reflect.TypeOf((*Enumerable)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// document records the Operation of the route with the given method and path.
+// It replaces the Operation of a route, that was registered before with the
+// same method and path on the same router
+func document(r *mux.Router, method, path string) *Operation {
+	op := &Operation{method: method, path: path, admin: r == adminRouter}
+	operationm.Lock()
+	defer operationm.Unlock()
+	for i, registered := range operations {
+		if registered.method == op.method && registered.path == op.path && registered.admin == op.admin {
+			operations[i] = op
+			return op
+		}
+	}
+	operations = append(operations, op)
+	return op
+}
+
+// Summary sets the Operation's short summary
+func (o *Operation) Summary(summary string) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	o.summary = summary
+	return o
+}
+
+// Describe sets the Operation's detailed description
+func (o *Operation) Describe(description string) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	o.description = description
+	return o
+}
+
+// Tag groups the Operation under the given tags
+func (o *Operation) Tag(tags ...string) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	o.tags = append(o.tags, tags...)
+	return o
+}
+
+// Param describes the path-parameter with the given name
+func (o *Operation) Param(name, description string) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	if o.params == nil {
+		o.params = make(map[string]string)
+	}
+	o.params[name] = description
+	return o
+}
+
+// Responds documents, that the route responds with the given status. The types
+// of the given values describe the response's body. Multiple values mean, that
+// the body is either of them. Without values, successful responses are
+// documented with the handler-function's response-type and errors as Problem.
+// If no successful status is documented, http.StatusOK is assumed (or the
+// status of the response-type, if it is a StatusCoder)
+func (o *Operation) Responds(status int, description string, responses ...interface{}) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	if o.responses == nil {
+		o.responses = make(map[int]*documentedResponse)
+	}
+	r := &documentedResponse{description: description}
+	for _, response := range responses {
+		r.types = append(r.types, reflect.TypeOf(response))
+	}
+	o.responses[status] = r
+	return o
+}
+
+// Messages documents the type of the values sent by a Stream
+func (o *Operation) Messages(message interface{}) *Operation {
+	operationm.Lock()
+	defer operationm.Unlock()
+	o.message = reflect.TypeOf(message)
+	return o
+}
+
+// Spec registers a handler, that publishes the OpenAPI document of all routes
+// (see OpenAPI)
+func Spec(path string, info Info, middlewares ...Middleware) *Operation {
+	router.Handle(path, route(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := OpenAPI(info)
+		if err != nil {
+			writeProblem(w, r, NewProblem(http.StatusInternalServerError, "", "").WithCause(err))
+			return
+		}
+		w.Header().Set("Content-Type", JSON.ContentType())
+		w.Write(doc)
+	}, middlewares)).Methods(http.MethodGet)
+	op := document(router, http.MethodGet, path)
+	op.response = reflect.TypeOf(map[string]interface{}{})
+	op.produces = JSON.ContentType()
+	return op
+}
+
+// object is a JSON object of the OpenAPI document
+type object map[string]interface{}
+
+// OpenAPI returns the OpenAPI document in JSON format, that describes all
+// routes registered so far, including the admin-api's. The schemas of named
+// types are listed as components. They are derived from the types' json and
+// validate tags (see Validator). Enumerables list their values. REST
+// operations accept and produce the ContentTypes of all registered Codecs.
+// Streams are described by the extension x-websocket, which lists the
+// subprotocols and the schemas of the client's requests and the Stream's
+// messages
+func OpenAPI(info Info) ([]byte, error) {
+	operationm.Lock()
+	defer operationm.Unlock()
+	s := &schemas{components: make(object), names: make(map[reflect.Type]string)}
+	paths := make(object)
+	admin := false
+	for _, o := range operations {
+		p := pathTemplate(o.path)
+		item, ok := paths[p].(object)
+		if !ok {
+			item = make(object)
+			paths[p] = item
+		}
+		item[strings.ToLower(o.method)] = o.spec(s)
+		admin = admin || o.admin
+	}
+	components := object{"schemas": s.components}
+	if admin {
+		components["securitySchemes"] = object{adminScheme: object{
+			"type":        "http",
+			"scheme":      "bearer",
+			"description": "The admin-api's token. If no token is configured, the admin-api is disabled.",
+		}}
+	}
+	infoDoc := object{"title": info.Title, "version": info.Version}
+	if info.Description != "" {
+		infoDoc["description"] = info.Description
+	}
+	doc := object{
+		"openapi":    OpenAPIVersion,
+		"info":       infoDoc,
+		"paths":      paths,
+		"components": components,
+	}
+	if len(info.Tags) > 0 {
+		names := make([]string, 0, len(info.Tags))
+		for name := range info.Tags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		tags := make([]object, len(names))
+		for i, name := range names {
+			tags[i] = object{"name": name, "description": info.Tags[name]}
+		}
+		doc["tags"] = tags
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// pathParam matches a variable of a path template, e.g. {id} or {id:[0-9]+}
+var pathParam = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// pathTemplate returns the given path template without the variables'
+// patterns
+func pathTemplate(path string) string {
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
+
+// spec returns the Operation's OpenAPI operation object
+func (o *Operation) spec(s *schemas) object {
+	doc := object{"responses": o.documentResponses(s)}
+	if o.summary != "" {
+		doc["summary"] = o.summary
+	}
+	if o.description != "" {
+		doc["description"] = o.description
+	}
+	if len(o.tags) > 0 {
+		doc["tags"] = o.tags
+	}
+	var params []object
+	for _, match := range pathParam.FindAllStringSubmatch(o.path, -1) {
+		param := object{"name": match[1], "in": "path", "required": true, "schema": object{"type": "string"}}
+		if description := o.params[match[1]]; description != "" {
+			param["description"] = description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+	if o.request != nil {
+		doc["requestBody"] = object{"required": true, "content": s.content(contentTypes(), o.request)}
+	}
+	if o.admin {
+		doc["security"] = []object{{adminScheme: []string{}}}
+	}
+	if o.websocket {
+		doc["x-websocket"] = object{
+			"subprotocols": subprotocols(),
+			"request":      s.of(reflect.TypeOf(uint(0))),
+			"message":      s.of(o.message),
+		}
+	}
+	return doc
+}
+
+// documentResponses returns the Operation's OpenAPI responses object. It
+// contains the declared responses, a successful one and the errors this
+// package responds with
+func (o *Operation) documentResponses(s *schemas) object {
+	responses := make(object)
+	success := false
+	for status, r := range o.responses {
+		responses[strconv.Itoa(status)] = o.documentResponse(s, status, r)
+		success = success || status < 400
+	}
+	if !success {
+		status := successStatus(o.response)
+		if o.websocket {
+			status = http.StatusSwitchingProtocols
+		}
+		responses[strconv.Itoa(status)] = o.documentResponse(s, status, &documentedResponse{description: http.StatusText(status)})
+	}
+	for status, description := range o.builtinErrors() {
+		if _, ok := responses[strconv.Itoa(status)]; !ok {
+			responses[strconv.Itoa(status)] = o.documentResponse(s, status, &documentedResponse{description: description})
+		}
+	}
+	return responses
+}
+
+// documentResponse returns the OpenAPI response object of the given status
+func (o *Operation) documentResponse(s *schemas, status int, r *documentedResponse) object {
+	res := object{"description": r.description}
+	contentTypes := contentTypes()
+	if o.produces != "" {
+		contentTypes = []string{o.produces}
+	}
+	switch {
+	case status >= 400 && len(r.types) == 0:
+		res["content"] = s.content([]string{ProblemContentType}, problemType)
+	case status >= 400:
+		res["content"] = s.content([]string{ProblemContentType}, r.types...)
+	case o.websocket || status == http.StatusNoContent:
+	case len(r.types) > 0:
+		res["content"] = s.content(contentTypes, r.types...)
+	case o.response != nil && o.response != noResponseType:
+		res["content"] = s.content(contentTypes, o.response)
+	}
+	return res
+}
+
+// builtinErrors returns the error statuses, this package responds with itself,
+// and their descriptions
+func (o *Operation) builtinErrors() map[int]string {
+	errs := make(map[int]string)
+	switch {
+	case o.websocket:
+		errs[http.StatusTooManyRequests] = "The client has opened the configured maximum number of websocket connections."
+		errs[http.StatusServiceUnavailable] = "The server is shutting down."
+	case o.produces == "":
+		errs[http.StatusNotAcceptable] = "None of the response's Content-Types is acceptable."
+	}
+	if o.request != nil {
+		errs[http.StatusBadRequest] = "The request's body is malformed or invalid. All invalid fields are listed in the Problem's errors."
+		errs[http.StatusRequestEntityTooLarge] = "The request's body exceeds the configured maximum size."
+		errs[http.StatusUnsupportedMediaType] = "The request's body has an unsupported Content-Type."
+	}
+	if o.admin {
+		errs[http.StatusUnauthorized] = "The admin-token is missing or invalid."
+	}
+	return errs
+}
+
+// successStatus returns the status, that responses of the given type are
+// written with (see StatusCoder)
+func successStatus(t reflect.Type) int {
+	if t == nil || t.Kind() == reflect.Interface || !t.Implements(statusCoderType) {
+		return http.StatusOK
+	}
+	v := reflect.Zero(t)
+	if t.Kind() == reflect.Ptr {
+		v = reflect.New(t.Elem())
+	}
+	return v.Interface().(StatusCoder).StatusCode()
+}
+
+// schemas collects the schemas of named types as components of the OpenAPI
+// document
+type schemas struct {
+	components object
+	names      map[reflect.Type]string
+}
+
+// content returns an OpenAPI content object, that holds the schema of the
+// given types for each of the given Content-Types
+func (s *schemas) content(contentTypes []string, types ...reflect.Type) object {
+	schema := s.of(types[0])
+	if len(types) > 1 {
+		oneOf := make([]object, len(types))
+		for i, t := range types {
+			oneOf[i] = s.of(t)
+		}
+		schema = object{"oneOf": oneOf}
+	}
+	content := make(object)
+	for _, contentType := range contentTypes {
+		content[contentType] = object{"schema": schema}
+	}
+	return content
+}
+
+// of returns the schema of the given type. Named types are referenced as
+// components
+func (s *schemas) of(t reflect.Type) object {
+	switch t {
+	case nil:
+		return object{}
+	case timeType:
+		return object{"type": "string", "format": "date-time"}
+	case durationType:
+		return object{"type": "integer", "format": "int64"}
+	}
+	if t.Name() == "" || t.PkgPath() == "" {
+		return s.inline(t)
+	}
+	name, ok := s.names[t]
+	if !ok {
+		name = s.name(t)
+		// the name is known before the schema is built, so that recursive
+		// types can reference themselves
+		s.names[t] = name
+		s.components[name] = object{}
+		s.components[name] = s.inline(t)
+	}
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// componentName matches the characters, that aren't allowed in names of
+// components
+var componentName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// name returns a unique name for the component of the given type. It is the
+// type's name, if it isn't taken yet, or qualified by the type's package
+// otherwise
+func (s *schemas) name(t reflect.Type) string {
+	name := componentName.ReplaceAllString(t.Name(), "_")
+	if _, taken := s.components[name]; !taken {
+		return name
+	}
+	qualified := path.Base(t.PkgPath()) + "." + name
+	name = qualified
+	for i := 2; ; i++ {
+		if _, taken := s.components[name]; !taken {
+			return name
+		}
+		name = qualified + strconv.Itoa(i)
+	}
+}
+
+// inline returns the schema of the given type without referencing it
+func (s *schemas) inline(t reflect.Type) object {
+	var schema object
+	switch {
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		schema = object{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		schema = object{"type": "string"}
+	default:
+		schema = s.kind(t)
+	}
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(enumerableType) {
+		schema["enum"] = reflect.Zero(t).Interface().(Enumerable).Enum()
+	}
+	return schema
+}
+
+// kind returns the schema of the given type's kind as encoded by JSON
+func (s *schemas) kind(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer", "format": "int32", "minimum": 0}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return object{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32:
+		return object{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return object{"type": "number", "format": "double"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Ptr:
+		return s.of(t.Elem())
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Array:
+		return object{"type": "array", "items": s.of(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		properties := make(object)
+		var required []string
+		s.fields(t, properties, &required)
+		schema := object{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return object{}
+}
+
+// fields adds the properties of the given struct type to properties. Fields
+// are required, if they aren't omitted when empty or if they are validated as
+// required. Embedded structs without name are flattened
+func (s *schemas) fields(t reflect.Type, properties object, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" && len(tag) == 1 {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, properties, required)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		rules := field.Tag.Get(validateTag)
+		properties[name] = constrained(s.of(field.Type), field.Type, rules)
+		if !hasOption(tag[1:], "omitempty") || hasOption(strings.Split(rules, ","), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// constrained adds the given validation rules (see Validator) to the schema of
+// a value of the given type
+func constrained(schema object, t reflect.Type, rules string) object {
+	if rules == "" {
+		return schema
+	}
+	constraints := make(object)
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			if k := t.Kind(); k == reflect.String || k == reflect.Slice || k == reflect.Map {
+				if _, ok := constraints[boundKeyword(k, true)]; !ok {
+					constraints[boundKeyword(k, true)] = 1
+				}
+			}
+		case "min", "max":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			elem := t
+			for elem.Kind() == reflect.Ptr {
+				elem = elem.Elem()
+			}
+			constraints[boundKeyword(elem.Kind(), name == "min")] = bound
+		case "unique":
+			constraints["uniqueItems"] = true
+		}
+	}
+	if len(constraints) == 0 {
+		return schema
+	}
+	// siblings of a reference are ignored
+	if _, ref := schema["$ref"]; ref {
+		constraints["allOf"] = []object{schema}
+		return constraints
+	}
+	for k, v := range constraints {
+		schema[k] = v
+	}
+	return schema
+}
+
+// boundKeyword returns the keyword of a lower or upper bound for values of the
+// given kind
+func boundKeyword(kind reflect.Kind, lower bool) string {
+	prefix := "max"
+	if lower {
+		prefix = "min"
+	}
+	switch kind {
+	case reflect.String:
+		return prefix + "Length"
+	case reflect.Slice, reflect.Array:
+		return prefix + "Items"
+	case reflect.Map:
+		return prefix + "Properties"
+	}
+	return prefix + "imum"
+}
+
+// hasOption returns true, if options contains the given option
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package communication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/streams"
+)
+
+type shade string
+
+func (shade) Enum() []interface{} {
+	return []interface{}{"light", "dark"}
+}
+
+type palette struct {
+	Shades []shade `json:"shades" validate:"required,unique"`
+	Size   *int    `json:"size,omitempty" validate:"min=1"`
+	*created
+}
+
+// lookup returns the value found at the given keys of the JSON value v
+func lookup(v interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func TestOpenAPI(t *testing.T) {
+	Handle(http.MethodPost, "/openapi/palette/{name:[a-z]+}", func(ctx *Context, req palette) (created, error) {
+		return created{}, nil
+	}).Summary("creates a palette").Param("name", "the palette's name").
+		Responds(http.StatusConflict, "the palette exists")
+	Get("/openapi/greetings", func(params ParameterMap) (int, []greeting) {
+		return http.StatusOK, nil
+	}).Responds(http.StatusOK, "the greetings", []greeting{}, "")
+	AdminHandle(http.MethodDelete, "/openapi/palette", func(ctx *Context, req interface{}) (NoResponse, error) {
+		return NoResponse{}, nil
+	})
+	Stream("/openapi/websocket", func(ctx *Context) (int, streams.Stream) {
+		return http.StatusNotFound, nil
+	}).Messages(char('a'))
+	Spec("/openapi.json", Info{Title: "test", Version: "v1", Tags: map[string]string{"b": "second", "a": "first"}})
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	var doc map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &doc)) {
+		return
+	}
+	assert.Equal(t, OpenAPIVersion, doc["openapi"])
+	assert.Equal(t, "v1", lookup(doc, "info", "version"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "a", "description": "first"},
+		map[string]interface{}{"name": "b", "description": "second"},
+	}, doc["tags"])
+
+	post := lookup(doc, "paths", "/openapi/palette/{name}", "post")
+	assert.Equal(t, "creates a palette", lookup(post, "summary"))
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"name": "name", "in": "path", "required": true, "description": "the palette's name",
+		"schema": map[string]interface{}{"type": "string"},
+	}}, lookup(post, "parameters"))
+	assert.Equal(t, "#/components/schemas/palette", lookup(post, "requestBody", "content", "application/cbor", "schema", "$ref"))
+	assert.Equal(t, "#/components/schemas/created", lookup(post, "responses", "201", "content", "application/msgpack", "schema", "$ref"))
+	for _, status := range []string{"400", "406", "409", "413", "415"} {
+		assert.Equal(t, "#/components/schemas/Problem", lookup(post, "responses", status, "content", ProblemContentType, "schema", "$ref"), status)
+	}
+
+	get := lookup(doc, "paths", "/openapi/greetings", "get")
+	assert.Nil(t, lookup(get, "requestBody"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/components/schemas/greeting"}},
+		map[string]interface{}{"type": "string"},
+	}, lookup(get, "responses", "200", "content", "application/json", "schema", "oneOf"))
+
+	del := lookup(doc, "paths", "/openapi/palette", "delete")
+	assert.Equal(t, []interface{}{map[string]interface{}{"adminToken": []interface{}{}}}, lookup(del, "security"))
+	assert.NotNil(t, lookup(del, "responses", "401"))
+	assert.Nil(t, lookup(del, "responses", "200", "content"))
+	assert.NotNil(t, lookup(doc, "components", "securitySchemes", "adminToken"))
+
+	ws := lookup(doc, "paths", "/openapi/websocket", "get")
+	assert.NotNil(t, lookup(ws, "responses", "101"))
+	assert.NotNil(t, lookup(ws, "responses", "429"))
+	assert.Equal(t, []interface{}{"json", "msgpack", "cbor"}, lookup(ws, "x-websocket", "subprotocols"))
+	assert.Equal(t, "#/components/schemas/char", lookup(ws, "x-websocket", "message", "$ref"))
+
+	assert.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"shades": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"$ref": "#/components/schemas/shade"},
+				"minItems":    1.0,
+				"uniqueItems": true,
+			},
+			"size": map[string]interface{}{"type": "integer", "format": "int64", "minimum": 1.0},
+			"id":   map[string]interface{}{"type": "integer", "format": "int64"},
+		},
+		"required": []interface{}{"shades", "id"},
+	}, lookup(doc, "components", "schemas", "palette"))
+	assert.Equal(t, map[string]interface{}{
+		"type": "string",
+		"enum": []interface{}{"light", "dark"},
+	}, lookup(doc, "components", "schemas", "shade"))
+}
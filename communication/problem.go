@@ -0,0 +1,207 @@
+package communication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/theMomax/notypo-backend/config"
+)
+
+// ProblemContentType is the Content-Type of a Problem
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeDefault is the Type of a Problem, that is sufficiently described
+// by its Status
+const ProblemTypeDefault = "about:blank"
+
+// Problem (response) explains, why a request failed, in the format specified by
+// RFC 7807. Type is a URI identifying the kind of problem. Title is a short,
+// human-readable summary of that kind and Detail explains this occurrence.
+// Errors lists the invalid fields of the request's body or parameters. Debug is
+// only set in development mode (see config.Server.Mode).
+// Handlers may return a *Problem as error. Other errors are converted to a
+// Problem, whose Detail is the error's message, if the status is a client
+// error, or omitted otherwise
+type Problem struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title"`
+	Status   int           `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Instance string        `json:"instance,omitempty"`
+	Errors   []FieldError  `json:"errors,omitempty"`
+	Debug    *ProblemDebug `json:"debug,omitempty"`
+
+	cause error
+}
+
+// FieldError explains, why the value of a request's field is invalid. Field is
+// the field's name as used in the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ProblemDebug holds details, that help to debug a Problem. Cause is the
+// message of the error, that caused the Problem. Stack is the stack trace of a
+// recovered panic
+type ProblemDebug struct {
+	Cause string `json:"cause,omitempty"`
+	Stack string `json:"stack,omitempty"`
+}
+
+// NewProblem returns a Problem with the given status, type and detail. The
+// Title is the status' text. An empty type defaults to ProblemTypeDefault
+func NewProblem(status int, problemType, detail string) *Problem {
+	if problemType == "" {
+		problemType = ProblemTypeDefault
+	}
+	return &Problem{
+		Type:   problemType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// WithField adds a FieldError for the given field and returns the Problem
+func (p *Problem) WithField(field, message string) *Problem {
+	p.Errors = append(p.Errors, FieldError{Field: field, Message: message})
+	return p
+}
+
+// WithCause sets the error, that caused the Problem, and returns the Problem.
+// Its message is only sent in development mode
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// Unwrap returns the error, that caused the Problem
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// problemOf converts the given error returned by a handler together with the
+// given status to a Problem
+func problemOf(err error, status int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	if status < 400 {
+		status = http.StatusInternalServerError
+	}
+	p = NewProblem(status, "", "").WithCause(err)
+	if status < 500 {
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+// decodingProblem explains, why the request's body couldn't be decoded. Too
+// large bodies result in http.StatusRequestEntityTooLarge
+func decodingProblem(err error) *Problem {
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return tooLarge(sizeErr.Limit).WithCause(err)
+	}
+	p := NewProblem(http.StatusBadRequest, "", "the request's body is malformed").WithCause(err)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		p.WithField(typeErr.Field, "must be of type "+typeErr.Type.String())
+	}
+	// json doesn't export the error of unknown fields
+	const unknownField = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownField) {
+		field, _ := strconv.Unquote(msg[len(unknownField):])
+		p.WithField(field, "is unknown")
+	}
+	return p
+}
+
+// development returns true, if the server runs in development mode
+func development() bool {
+	return config.Server.Mode == config.ModeDevelopment
+}
+
+// writeProblem writes the given Problem. Its Instance defaults to the
+// request's path. In development mode, its cause is added
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	response := *p
+	if response.Instance == "" {
+		response.Instance = r.URL.Path
+	}
+	if development() && response.cause != nil {
+		debug := ProblemDebug{}
+		if response.Debug != nil {
+			debug = *response.Debug
+		}
+		debug.Cause = response.cause.Error()
+		response.Debug = &debug
+	}
+	if !development() {
+		response.Debug = nil
+	}
+	bytes, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(response.Status)
+	w.Write(bytes)
+}
+
+// writeError writes a Problem with the given status and detail
+func writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblem(w, r, NewProblem(status, "", detail))
+}
+
+// respond writes a handler's results. If err is not nil, or if status is an
+// error and there is no response, a Problem is written. Otherwise the response
+// is encoded by the given Codec, unless it is a NoResponse
+func respond(w http.ResponseWriter, r *http.Request, codec Codec, status int, response interface{}, err error) {
+	w.Header().Add("Vary", "Accept")
+	if err != nil {
+		writeProblem(w, r, problemOf(err, status))
+		return
+	}
+	_, none := response.(NoResponse)
+	if status >= 400 && (none || isNil(response)) {
+		writeProblem(w, r, NewProblem(status, "", ""))
+		return
+	}
+	if none {
+		w.WriteHeader(status)
+		return
+	}
+	var buf bytes.Buffer
+	err = codec.Encode(&buf, response)
+	if err != nil {
+		writeProblem(w, r, NewProblem(http.StatusInternalServerError, "", "").WithCause(err))
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// isNil returns true, if v is nil or a nil pointer, map, slice or interface
+func isNil(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package communication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/config"
+)
+
+func TestHandlerErrors(t *testing.T) {
+	secret := errors.New("secret")
+	Get("/problem/{status}", func(params map[string]string) (int, interface{}, error) {
+		switch params["status"] {
+		case "400":
+			return http.StatusBadRequest, nil, errors.New("bad")
+		case "500":
+			return http.StatusOK, nil, secret
+		case "409":
+			return http.StatusConflict, nil, nil
+		case "418":
+			return 0, nil, NewProblem(http.StatusTeapot, "urn:test", "short and stout").WithField("spout", "missing")
+		}
+		return http.StatusOK, "ok", nil
+	})
+	get := func(status string) (int, Problem) {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("GET", "/problem/"+status, nil))
+		var p Problem
+		if res.Code != http.StatusOK {
+			assert.Equal(t, ProblemContentType, res.Header().Get("Content-Type"))
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+		}
+		return res.Code, p
+	}
+
+	code, _ := get("200")
+	assert.Equal(t, http.StatusOK, code)
+
+	// client errors are explained
+	code, p := get("400")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "bad", p.Detail)
+
+	// unexpected errors are only explained in development mode
+	defer func(mode int) {
+		config.Server.Mode = mode
+	}(config.Server.Mode)
+	config.Server.Mode = config.ModeProduction
+	code, p = get("500")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "Internal Server Error", p.Title)
+	assert.Empty(t, p.Detail)
+	assert.Nil(t, p.Debug)
+	config.Server.Mode = config.ModeDevelopment
+	_, p = get("500")
+	if assert.NotNil(t, p.Debug) {
+		assert.Equal(t, "secret", p.Debug.Cause)
+	}
+
+	// status only
+	code, p = get("409")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, ProblemTypeDefault, p.Type)
+	assert.Equal(t, "/problem/409", p.Instance)
+
+	code, p = get("418")
+	assert.Equal(t, http.StatusTeapot, code)
+	assert.Equal(t, "urn:test", p.Type)
+	assert.Equal(t, []FieldError{{Field: "spout", Message: "missing"}}, p.Errors)
+}
+
+func TestReleaseHidesCauses(t *testing.T) {
+	Get("/release", func(params map[string]string) (int, interface{}, error) {
+		return http.StatusOK, nil, errors.New("secret")
+	})
+	defer func(isTest bool, version string, mode int) {
+		config.IsTest = isTest
+		config.Version = version
+		config.Server.Mode = mode
+	}(config.IsTest, config.Version, config.Server.Mode)
+	config.IsTest = true
+
+	// the mode is version-dependant by default
+	config.Version = "development"
+	config.Server.Mode = 0
+	assert.NoError(t, config.Load(nil))
+	assert.Equal(t, config.ModeDevelopment, config.Server.Mode)
+	config.Version = "1.0.0"
+	config.Server.Mode = 0
+	assert.NoError(t, config.Load(nil))
+	assert.Equal(t, config.ModeProduction, config.Server.Mode)
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/release", nil))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.NotContains(t, res.Body.String(), "secret")
+	var p Problem
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+	assert.Nil(t, p.Debug)
+}
+
+func TestIllegalHandleFunc(t *testing.T) {
+	assert.PanicsWithValue(t, ErrIllegalHandleFunc, func() {
+		Get("/problem/illegal", func(params map[string]string) (int, interface{}, string) {
+			return 0, nil, ""
+		})
+	})
+}
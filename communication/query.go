@@ -0,0 +1,146 @@
+package communication
+
+import (
+	"encoding"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrIllegalQueryTarget is returned by BindQuery, if it isn't given a pointer
+// to a struct
+var ErrIllegalQueryTarget = errors.New("query parameters can only be bound to a pointer to a struct")
+
+// BindQuery decodes the request's query parameters into the struct v points
+// to. A field is bound to the query parameter named by its `query` tag, e.g.
+//
+//	struct {
+//		N      int    `query:"n"`
+//		Format string `query:"format"`
+//	}
+//
+// binds ?n=100&format=text. Untagged fields and fields of parameters, that
+// are missing, keep their value, so that defaults can be set beforehand.
+// Pointer fields are only allocated, if the parameter is given. Slice fields
+// take all values of a repeated parameter, all other fields its first value.
+// Supported are strings, bools, integers, floats, time.Durations and
+// encoding.TextUnmarshalers as well as pointers and slices of those.
+// The bound struct is validated like a request-value (see Validator), its
+// fields being named after their query parameters. If parameters are
+// malformed or invalid, a Problem with http.StatusBadRequest is returned, which
+// lists all of them
+func (c *Context) BindQuery(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrIllegalQueryTarget
+	}
+	rv = rv.Elem()
+	var p *Problem
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		name := field.Tag.Get("query")
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+		values, ok := c.Query[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		err := bindQueryField(rv.Field(i), values)
+		if err != nil {
+			if p == nil {
+				p = NewProblem(http.StatusBadRequest, "", "the request's query is invalid")
+			}
+			p.WithField(name, err.Error())
+		}
+	}
+	if p != nil {
+		return p
+	}
+	if errs := validate(v, "query"); len(errs) > 0 {
+		p = invalid(errs)
+		p.Detail = "the request's query is invalid"
+		return p
+	}
+	return nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// bindQueryField sets the given field to the given values of a query
+// parameter
+func bindQueryField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			err := bindQueryValue(slice.Index(i), value)
+			if err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return bindQueryValue(field, values[0])
+}
+
+// bindQueryValue parses the given value into v. The returned error explains,
+// why the value is invalid
+func bindQueryValue(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		err := bindQueryValue(elem.Elem(), value)
+		if err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("must be a duration (e.g. 1m30s)")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer of " + strconv.Itoa(v.Type().Bits()) + " bits")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a non-negative integer of " + strconv.Itoa(v.Type().Bits()) + " bits")
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return errors.New("can't be bound to " + v.Type().String())
+	}
+	return nil
+}
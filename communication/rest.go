@@ -1,24 +1,36 @@
 // Package communication handels the translation from http and json-text to
 // type-safe golang code. Thus, the actual api-handler doesn't have to bother
 // (un-)marshalling json and type-safety.
-// A handler-function can be registered for a specific http-method using the
-// provided functions with the given names (Get, Post, ...). These functions
-// support different types of handler-functions. The raw type of those
-// handler-functions is interface{}, since the required specifications can't be
-// handled at compile-time in golang. The actual type-pattern is described in
-// the type's documentation. When such a handler-function is registered, its
-// type is asserted via reflection, so that type-safety is re-established right
-// after startup. If the handler-function doesn't match the specified
-// type-pattern the registering-function (Get, Post, ...) panics with
-// ErrIllegalHandleFunc
+// A handler-function can be registered for a specific http-method using Handle,
+// which checks its types at compile-time, or the provided functions with the
+// given names (Get, Post, ...). The latter support different types of
+// handler-functions. The raw type of those handler-functions is interface{}.
+// The actual type-pattern is described in the type's documentation. When such
+// a handler-function is registered, its type is asserted via reflection, so
+// that type-safety is re-established right after startup. If the
+// handler-function doesn't match the specified type-pattern the
+// registering-function (Get, Post, ...) panics with ErrIllegalHandleFunc.
+// All handler-functions can be given a Context, which describes the request,
+// i.e. its path variables, query parameters, headers, client and user.
+// Request-values are validated before the handler-function is called (see
+// Validator).
+// All registering-functions return an Operation, which documents the route in
+// the OpenAPI document (see OpenAPI).
+// All handlers are wrapped in Middlewares, which are either global (see Use)
+// or passed to the registering-function of a single route
 package communication
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"errors"
+	"log/slog"
+	"net"
 	"net/http"
-	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -30,283 +42,282 @@ import (
 // HandleFunc-type
 var ErrIllegalHandleFunc = errors.New("the given handler does not meet the requirements of HandleFunc")
 
+// The following handler-function types are checked via reflection, when they
+// are registered. They are adapted to HandlerFuncs, which should be preferred,
+// since their types are checked at compile-time.
+
 // HandleGetFunc represents a handler-function for a GET request. It has the
 // following signature:
-//  func(parameters ParameterMap) (status int, response A)
-// Where A may be anything json.Marshal can handle
+//  func(parameters ParameterMap) (status int, response A[, err error])
+// Where A may be anything json.Marshal can handle. All handler-functions may
+// return an error as last result. It is written as Problem instead of the
+// response (see Problem). A response with an error status, that is nil, is
+// written as Problem as well. All handler-functions may take a *Context
+// instead of the ParameterMap
 type HandleGetFunc interface{}
 
 // HandlePostFunc represents a handler-function for a POST request. It has the
 // following signature:
-//  func(request A, parameters ParameterMap) (status int, response B)
+//  func(request A, parameters ParameterMap) (status int, response B[, err error])
 // Where A/B may be anything json.Unmarshal/json.Marshal can handle
 type HandlePostFunc interface{}
 
 // HandlePutFunc represents a handler-function for a PUT request. It has the
 // following signature:
-//  func(request A, parameters ParameterMap) (status int)
+//  func(request A, parameters ParameterMap) (status int[, err error])
 // Where A may be anything json.Unmarshal can handle
 type HandlePutFunc interface{}
 
 // HandleDeleteFunc represents a handler-function for a DELETE request. It has
 // the following signature:
-//  func(request A, parameters ParameterMap) (status int, response B)
+//  func(request A, parameters ParameterMap) (status int, response B[, err error])
 // Where A/B may be anything json.Unmarshal/json.Marshal can handle
 type HandleDeleteFunc interface{}
 
 // HandleOptionsFunc represents a handler-function for a OPTIONS request. It has
 // the following signature:
-//  func(parameters ParameterMap) (status int, response A)
+//  func(parameters ParameterMap) (status int, response A[, err error])
 // Where A may be anything json.Marshal can handle
 type HandleOptionsFunc interface{}
 
-// ParameterMap contains the parameters of a http-request. The key is the
-// parameter's name and the value its value
+// ParameterMap contains the path variables of a http-request. The key is the
+// variable's name and the value its value. The requesting client's ip and the
+// request's id are found in the Context
 type ParameterMap map[string]string
 
+// names of the limits enforced by this package as used in metrics
+const (
+	LimitRequestSize       = "request_size"
+	LimitClientConnections = "client_connections"
+	LimitBodySize          = "body_size"
+)
+
 var router = mux.NewRouter()
 
-// Serve starts the REST-api and websocket server
-func Serve() {
-	http.ListenAndServe(config.Server.IP+":"+strconv.Itoa(config.Server.Port), handlers.CORS(
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "OPTIONS", "DELETE"}),
-		handlers.AllowedOrigins(config.Server.AllowedRequestOrigins),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"}),
-	)(router))
-}
+// adminRouter holds the handlers registered via AdminGet, AdminPut, ... Their
+// paths must start with AdminPrefix
+var adminRouter = mux.NewRouter()
 
-// Router returns the router used in this package. This function should only be
-// used by tests
-func Router() *mux.Router {
-	return router
-}
+// AdminPrefix is the prefix of all paths of the admin-api
+const AdminPrefix = "/admin"
 
-// Get registers a handler for the http GET method
-func Get(path string, handler HandleGetFunc) {
-	// assert, that the given handler meets the requirements of a HandleGetFunc
-	hT := reflect.TypeOf(handler)
-	hV := reflect.ValueOf(handler)
-	if hT.Kind() != reflect.Func {
-		panic(ErrIllegalHandleFunc)
-	}
-	if hT.NumIn() != 1 || hT.NumOut() != 2 {
-		panic(ErrIllegalHandleFunc)
-	}
+// AdminUser is the User (see Context) of requests authenticated by
+// config.Admin.Token
+const AdminUser = "admin"
 
-	paramsT := hT.In(0)
-	if paramsT.Kind() != reflect.Map {
-		panic(ErrIllegalHandleFunc)
-	}
-	if paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String {
-		panic(ErrIllegalHandleFunc)
+// servers holds the servers started by Serve, so that Shutdown can stop them
+var servers []*http.Server
+var serverm sync.Mutex
+
+// Serve starts the REST-api and websocket server. If config.Admin.Address is
+// set, the admin-api is served by a separate server at that address. Otherwise
+// it is served at AdminPrefix by the api's server. If config.SSL is enabled,
+// all servers use https and plain http requests to config.SSL.RedirectPort are
+// redirected. Serve blocks until the api's server fails or Shutdown is called.
+// In the latter case nil is returned
+func Serve() error {
+	api := &http.Server{
+		Addr: config.Server.IP + ":" + strconv.Itoa(config.Server.Port),
+		Handler: handlers.CORS(
+			handlers.AllowedMethods([]string{"GET", "POST", "PUT", "OPTIONS", "DELETE"}),
+			handlers.AllowedOrigins(config.Server.AllowedRequestOrigins),
+			handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"}),
+		)(router),
 	}
-	statusT := hT.Out(0)
-	if statusT.Kind() != reflect.Int {
-		panic(ErrIllegalHandleFunc)
+	others := make([]*http.Server, 0, 2)
+	if config.Admin.Address != "" {
+		others = append(others, &http.Server{Addr: config.Admin.Address, Handler: AdminHandler()})
+	} else {
+		router.PathPrefix(AdminPrefix).Handler(AdminHandler())
 	}
-	// register type-safe handler
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		out := hV.Call([]reflect.Value{reflect.ValueOf(mux.Vars(r))})
-		response := out[1].Interface()
-		bytes, err := json.Marshal(response)
+	if config.SSL.Enabled {
+		c, err := tlsConfig()
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return err
+		}
+		for _, s := range append([]*http.Server{api}, others...) {
+			s.TLSConfig = c
+			if !config.SSL.HTTP2 {
+				// a non-nil, empty map disables HTTP/2
+				s.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+			}
+		}
+		if config.SSL.RedirectPort != 0 {
+			others = append(others, &http.Server{
+				Addr:    config.Server.IP + ":" + strconv.Itoa(config.SSL.RedirectPort),
+				Handler: redirectHandler(config.Server.Port),
+			})
 		}
-		status := out[0].Interface().(int)
-		w.WriteHeader(status)
-		w.Write(bytes)
-	}).Methods("GET")
-}
-
-// Post registers a handler for the http POST method
-func Post(path string, handler HandlePostFunc) {
-	// assert, that the given handler meets the requirements of a HandlePostFunc
-	hT := reflect.TypeOf(handler)
-	hV := reflect.ValueOf(handler)
-	if hT.Kind() != reflect.Func {
-		panic(ErrIllegalHandleFunc)
-	}
-	if hT.NumIn() != 2 || hT.NumOut() != 2 {
-		panic(ErrIllegalHandleFunc)
 	}
-	requestT := hT.In(0)
-	parseRequest := true
-	if requestT.String() == "interface {}" || requestT.String() == "*interface {}" {
-		parseRequest = false
+	serverm.Lock()
+	if shuttingDown() {
+		serverm.Unlock()
+		return nil
 	}
+	servers = append(servers, api)
+	servers = append(servers, others...)
+	serverm.Unlock()
 
-	paramsT := hT.In(1)
-	if paramsT.Kind() != reflect.Map {
-		panic(ErrIllegalHandleFunc)
-	}
-	if paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String {
-		panic(ErrIllegalHandleFunc)
-	}
-	statusT := hT.Out(0)
-	if statusT.Kind() != reflect.Int {
-		panic(ErrIllegalHandleFunc)
-	}
-	// register type-safe handler
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		var err error
-		request := reflect.New(requestT)
-		if parseRequest {
-			err = json.NewDecoder(r.Body).Decode(request.Interface())
+	for _, s := range others {
+		go func(s *http.Server) {
+			err := listen(s)
 			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
+				slog.Error("serving failed", "address", s.Addr, "error", err)
 			}
-		}
-		out := hV.Call([]reflect.Value{request.Elem(), reflect.ValueOf(mux.Vars(r))})
-		response := out[1].Interface()
-		bytes, err := json.Marshal(response)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		status := out[0].Interface().(int)
-		w.WriteHeader(status)
-		w.Write(bytes)
-	}).Methods("POST")
+		}(s)
+	}
+	return listen(api)
 }
 
-// Put registers a handler for the http PUT method
-func Put(path string, handler HandlePutFunc) {
-	// assert, that the given handler meets the requirements of a HandlePutFunc
-	hT := reflect.TypeOf(handler)
-	hV := reflect.ValueOf(handler)
-	if hT.Kind() != reflect.Func {
-		panic(ErrIllegalHandleFunc)
-	}
-	if hT.NumIn() != 2 || hT.NumOut() != 1 {
-		panic(ErrIllegalHandleFunc)
+// listen serves the given server via https, if it has a TLSConfig, or via
+// plain http otherwise. It returns nil, if the server was shut down
+func listen(s *http.Server) error {
+	var err error
+	if s.TLSConfig != nil {
+		err = s.ListenAndServeTLS("", "")
+	} else {
+		err = s.ListenAndServe()
 	}
-	requestT := hT.In(0)
-	parseRequest := true
-	if requestT.String() == "interface {}" || requestT.String() == "*interface {}" {
-		parseRequest = false
+	if err == http.ErrServerClosed {
+		return nil
 	}
+	return err
+}
+
+// Shutdown gracefully shuts down the servers started by Serve. They stop
+// accepting connections right away. Open websocket-connections are closed with
+// websocket.CloseGoingAway. Shutdown waits until all open requests and
+// websocket-connections are finished, or until ctx is done. In the latter case
+// the remaining websocket-connections are closed at ctx's deadline and ctx's
+// error is returned
+func Shutdown(ctx context.Context) error {
+	serverm.Lock()
+	closeSockets(ctx)
+	stopping := servers
+	servers = nil
+	serverm.Unlock()
 
-	paramsT := hT.In(1)
-	if paramsT.Kind() != reflect.Map {
-		panic(ErrIllegalHandleFunc)
+	errs := make(chan error, len(stopping))
+	for _, s := range stopping {
+		go func(s *http.Server) {
+			errs <- s.Shutdown(ctx)
+		}(s)
 	}
-	if paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String {
-		panic(ErrIllegalHandleFunc)
+	var err error
+	for range stopping {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
 	}
-	statusT := hT.Out(0)
-	if statusT.Kind() != reflect.Int {
-		panic(ErrIllegalHandleFunc)
+	if err != nil {
+		return err
 	}
-	// register type-safe handler
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		var err error
-		request := reflect.New(requestT)
-		if parseRequest {
-			err = json.NewDecoder(r.Body).Decode(request.Interface())
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-		}
-		out := hV.Call([]reflect.Value{request.Elem(), reflect.ValueOf(mux.Vars(r))})
-		status := out[0].Interface().(int)
-		w.WriteHeader(status)
-	}).Methods("PUT")
+	return waitForSockets(ctx)
 }
 
-// Delete registers a handler for the http DELETE method
-func Delete(path string, handler HandleDeleteFunc) {
-	// assert, that the given handler meets the requirements of a HandleDeleteFunc
-	hT := reflect.TypeOf(handler)
-	hV := reflect.ValueOf(handler)
-	if hT.Kind() != reflect.Func {
-		panic(ErrIllegalHandleFunc)
-	}
-	if hT.NumIn() != 2 || hT.NumOut() != 2 {
-		panic(ErrIllegalHandleFunc)
-	}
-	requestT := hT.In(0)
-	parseRequest := true
-	if requestT.String() == "interface {}" || requestT.String() == "*interface {}" {
-		parseRequest = false
-	}
+// Router returns the router used in this package. This function should only be
+// used by tests
+func Router() *mux.Router {
+	return router
+}
+
+// AdminHandler returns the admin-api's handler, which assigns an id to each
+// request (see RequestID) and authenticates it using config.Admin.Token before
+// passing it on to the handlers registered via AdminGet, AdminPut, ...
+func AdminHandler() http.Handler {
+	return RequestID(Authenticate("admin", authenticated)(adminRouter))
+}
 
-	paramsT := hT.In(1)
-	if paramsT.Kind() != reflect.Map {
-		panic(ErrIllegalHandleFunc)
+// authenticated returns the admin user, if the given request carries
+// config.Admin.Token as bearer token. If no token is configured, no request is
+// authenticated
+func authenticated(r *http.Request) (user string, ok bool) {
+	if config.Admin.Token == "" {
+		return "", false
 	}
-	if paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String {
-		panic(ErrIllegalHandleFunc)
+	const scheme = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, scheme) {
+		return "", false
 	}
-	statusT := hT.Out(0)
-	if statusT.Kind() != reflect.Int {
-		panic(ErrIllegalHandleFunc)
+	if subtle.ConstantTimeCompare([]byte(header[len(scheme):]), []byte(config.Admin.Token)) != 1 {
+		return "", false
 	}
-	// register type-safe handler
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		var err error
-		request := reflect.New(requestT)
-		if parseRequest {
-			err = json.NewDecoder(r.Body).Decode(request.Interface())
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				return
-			}
-		}
-		out := hV.Call([]reflect.Value{request.Elem(), reflect.ValueOf(mux.Vars(r))})
-		response := out[1].Interface()
-		bytes, err := json.Marshal(response)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		status := out[0].Interface().(int)
-		w.WriteHeader(status)
-		w.Write(bytes)
-	}).Methods("DELETE")
+	return AdminUser, true
 }
 
-// Options registers a handler for the http OPTIONS method
-func Options(path string, handler HandleOptionsFunc) {
-	// assert, that the given handler meets the requirements of a HandleOptionsFunc
-	hT := reflect.TypeOf(handler)
-	hV := reflect.ValueOf(handler)
-	if hT.Kind() != reflect.Func {
-		panic(ErrIllegalHandleFunc)
-	}
-	if hT.NumIn() != 1 || hT.NumOut() != 2 {
-		panic(ErrIllegalHandleFunc)
-	}
+// Get registers a handler for the http GET method. The given middlewares only
+// wrap this handler (see Use). The returned Operation documents the route (see
+// OpenAPI)
+func Get(path string, handler HandleGetFunc, middlewares ...Middleware) *Operation {
+	return handleGet(router, path, handler, middlewares)
+}
 
-	paramsT := hT.In(0)
-	if paramsT.Kind() != reflect.Map {
-		panic(ErrIllegalHandleFunc)
-	}
-	if paramsT.Key().Kind() != reflect.String || paramsT.Elem().Kind() != reflect.String {
-		panic(ErrIllegalHandleFunc)
+// AdminGet registers a handler for the http GET method on the admin-api
+func AdminGet(path string, handler HandleGetFunc, middlewares ...Middleware) *Operation {
+	return handleGet(adminRouter, path, handler, middlewares)
+}
+
+func handleGet(router *mux.Router, path string, handler HandleGetFunc, middlewares []Middleware) *Operation {
+	return newReflectHandler(handler, false, true).register(router, http.MethodGet, path, middlewares)
+}
+
+// Post registers a handler for the http POST method. The given middlewares
+// only wrap this handler (see Use)
+func Post(path string, handler HandlePostFunc, middlewares ...Middleware) *Operation {
+	return newReflectHandler(handler, true, true).register(router, http.MethodPost, path, middlewares)
+}
+
+// Put registers a handler for the http PUT method. The given middlewares only
+// wrap this handler (see Use)
+func Put(path string, handler HandlePutFunc, middlewares ...Middleware) *Operation {
+	return handlePut(router, path, handler, middlewares)
+}
+
+// AdminPut registers a handler for the http PUT method on the admin-api
+func AdminPut(path string, handler HandlePutFunc, middlewares ...Middleware) *Operation {
+	return handlePut(adminRouter, path, handler, middlewares)
+}
+
+func handlePut(router *mux.Router, path string, handler HandlePutFunc, middlewares []Middleware) *Operation {
+	return newReflectHandler(handler, true, false).register(router, http.MethodPut, path, middlewares)
+}
+
+// Delete registers a handler for the http DELETE method. The given middlewares
+// only wrap this handler (see Use)
+func Delete(path string, handler HandleDeleteFunc, middlewares ...Middleware) *Operation {
+	return handleDelete(router, path, handler, middlewares)
+}
+
+// AdminDelete registers a handler for the http DELETE method on the admin-api
+func AdminDelete(path string, handler HandleDeleteFunc, middlewares ...Middleware) *Operation {
+	return handleDelete(adminRouter, path, handler, middlewares)
+}
+
+func handleDelete(router *mux.Router, path string, handler HandleDeleteFunc, middlewares []Middleware) *Operation {
+	return newReflectHandler(handler, true, true).register(router, http.MethodDelete, path, middlewares)
+}
+
+// Options registers a handler for the http OPTIONS method. The given
+// middlewares only wrap this handler (see Use)
+func Options(path string, handler HandleOptionsFunc, middlewares ...Middleware) *Operation {
+	return newReflectHandler(handler, false, true).register(router, http.MethodOptions, path, middlewares)
+}
+
+// parameters returns the ParameterMap of the given request
+func parameters(r *http.Request) ParameterMap {
+	params := make(ParameterMap)
+	for k, v := range mux.Vars(r) {
+		params[k] = v
 	}
-	statusT := hT.Out(0)
-	if statusT.Kind() != reflect.Int {
-		panic(ErrIllegalHandleFunc)
+	return params
+}
+
+// client returns the ip of the client, that sent the given request
+func client(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	// register type-safe handler
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		out := hV.Call([]reflect.Value{reflect.ValueOf(mux.Vars(r))})
-		response := out[1].Interface()
-		bytes, err := json.Marshal(response)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		status := out[0].Interface().(int)
-		w.WriteHeader(status)
-		w.Write(bytes)
-	}).Methods("OPTIONS")
+	return host
 }
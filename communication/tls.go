@@ -0,0 +1,149 @@
+package communication
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/theMomax/notypo-backend/config"
+)
+
+// errors
+var (
+	ErrInvalidTLSVersion = errors.New("the configured minimum TLS version is unknown")
+	ErrInvalidCipher     = errors.New("a configured cipher suite is unknown or insecure")
+)
+
+// tlsVersions maps the versions allowed in config.SSL.MinVersion to their
+// constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// reloadInterval is the minimum time between two checks, whether the
+// certificate's files changed
+var reloadInterval = time.Second
+
+// tlsConfig returns the TLS configuration specified in config.SSL. The
+// certificate is reloaded, when its files change
+func tlsConfig() (*tls.Config, error) {
+	c := &tls.Config{}
+	if config.SSL.MinVersion != "" {
+		v, ok := tlsVersions[config.SSL.MinVersion]
+		if !ok {
+			return nil, ErrInvalidTLSVersion
+		}
+		c.MinVersion = v
+	}
+	for _, name := range config.SSL.CipherSuites {
+		if name == "" {
+			continue
+		}
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, ErrInvalidCipher
+		}
+		c.CipherSuites = append(c.CipherSuites, id)
+	}
+	cert, err := newCertificate(config.SSL.CertificatePath, config.SSL.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	c.GetCertificate = cert.get
+	return c, nil
+}
+
+// cipherSuite returns the id of the secure cipher suite with the given name
+func cipherSuite(name string) (id uint16, ok bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+// certificate holds a certificate loaded from a certificate- and a key-file.
+// It reloads them, when their modification-time changes
+type certificate struct {
+	certPath, keyPath string
+
+	// m guards all of the following fields
+	m       sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+	checked time.Time
+}
+
+// newCertificate loads the certificate from the given files
+func newCertificate(certPath, keyPath string) (*certificate, error) {
+	c := &certificate{certPath: certPath, keyPath: keyPath}
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c, c.load()
+}
+
+// get returns the current certificate. It is used as tls.Config.GetCertificate.
+// The files are checked for changes at most once per reloadInterval. If they
+// can't be loaded, the previous certificate is kept
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if time.Since(c.checked) >= reloadInterval {
+		err := c.load()
+		if err != nil {
+			slog.Warn("reloading certificate failed", "error", err)
+		}
+	}
+	return c.cert, nil
+}
+
+// load loads the certificate, if its files changed since they were loaded
+// last. c.m must be locked
+func (c *certificate) load() error {
+	c.checked = time.Now()
+	certInfo, err := os.Stat(c.certPath)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(c.keyPath)
+	if err != nil {
+		return err
+	}
+	if c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certPath, c.keyPath)
+	if err != nil {
+		return err
+	}
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// redirectHandler redirects all requests to the same url using https and the
+// given port
+func redirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,192 @@
+package communication
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/config"
+)
+
+func TestTLSConfig(t *testing.T) {
+	dir := certificateFiles(t, "localhost")
+	defer os.RemoveAll(dir)
+	config.SSL.CertificatePath = filepath.Join(dir, "cert.pem")
+	config.SSL.KeyPath = filepath.Join(dir, "key.pem")
+
+	config.SSL.MinVersion = "1.2"
+	config.SSL.CipherSuites = []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}
+	c, err := tlsConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, c.CipherSuites)
+
+	config.SSL.MinVersion = "2.0"
+	_, err = tlsConfig()
+	assert.Equal(t, ErrInvalidTLSVersion, err)
+	config.SSL.MinVersion = "1.2"
+	config.SSL.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+	_, err = tlsConfig()
+	assert.Equal(t, ErrInvalidCipher, err)
+	config.SSL.CipherSuites = nil
+	config.SSL.KeyPath = filepath.Join(dir, "missing.pem")
+	_, err = tlsConfig()
+	assert.Error(t, err)
+}
+
+func TestServeTLSWithHTTP2(t *testing.T) {
+	dir := certificateFiles(t, "localhost")
+	defer os.RemoveAll(dir)
+	config.SSL.CertificatePath = filepath.Join(dir, "cert.pem")
+	config.SSL.KeyPath = filepath.Join(dir, "key.pem")
+	config.SSL.MinVersion = "1.2"
+	c, err := tlsConfig()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	s.TLS = c
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(readFile(t, config.SSL.CertificatePath))
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, ServerName: "localhost"},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get(s.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "HTTP/2.0", string(body))
+}
+
+func TestCertificateReload(t *testing.T) {
+	interval := reloadInterval
+	reloadInterval = 0
+	defer func() {
+		reloadInterval = interval
+	}()
+	dir := certificateFiles(t, "first")
+	defer os.RemoveAll(dir)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	c, err := newCertificate(certPath, keyPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "first", leaf(t, c).Subject.CommonName)
+
+	// replace the files and make sure, their modification-time changes
+	other := certificateFiles(t, "second")
+	defer os.RemoveAll(other)
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), readFile(t, filepath.Join(other, name)), 0600))
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name), later, later))
+	}
+	assert.Equal(t, "second", leaf(t, c).Subject.CommonName)
+
+	// invalid files are ignored
+	later = later.Add(time.Minute)
+	assert.NoError(t, os.WriteFile(certPath, []byte("invalid"), 0600))
+	assert.NoError(t, os.Chtimes(certPath, later, later))
+	assert.Equal(t, "second", leaf(t, c).Subject.CommonName)
+}
+
+func TestRedirect(t *testing.T) {
+	for port, location := range map[int]string{
+		4443: "https://example.com:4443/stream/1?a=b",
+		443:  "https://example.com/stream/1?a=b",
+	} {
+		req, _ := http.NewRequest("POST", "http://example.com:4000/stream/1?a=b", nil)
+		resp := httptest.NewRecorder()
+		redirectHandler(port).ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusPermanentRedirect, resp.Code)
+		assert.Equal(t, location, resp.Header().Get("Location"))
+	}
+}
+
+// certificateFiles writes a self-signed certificate for the given common name
+// and localhost to cert.pem and its key to key.pem in a new directory
+func certificateFiles(t *testing.T, name string) (dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err = os.MkdirTemp("", "notypo-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	}
+	for file, block := range files {
+		err = os.WriteFile(filepath.Join(dir, file), pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) []byte {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// leaf returns the parsed certificate currently served by c
+func leaf(t *testing.T, c *certificate) *x509.Certificate {
+	cert, err := c.get(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
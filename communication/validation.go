@@ -0,0 +1,257 @@
+package communication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator is implemented by values, that validate themselves, e.g. enums.
+// Request-values and all values they contain are validated after they were
+// decoded and before the handler-function is called. If Validate returns a
+// Problem, its Errors are reported relative to the value's field. Any other
+// error is reported as the field's error message.
+// Additionally, fields are validated according to the comma-separated rules
+// in their `validate` tag, e.g.
+//
+//	struct {
+//		Name    string `json:"name" validate:"required,max=32"`
+//		Charset []rune `json:"charset" validate:"required,unique"`
+//	}
+//
+// The following rules are supported:
+//
+//	required  the value must not be zero, i.e. strings, slices and maps must not be empty
+//	min=N     numbers must be at least N, strings must be at least N characters long and slices and maps must contain at least N elements
+//	max=N     like min, but an upper bound
+//	unique    the slice's elements must be distinct
+//
+// A request-value, that is invalid, is rejected with http.StatusBadRequest.
+// The Problem lists all invalid fields by their name in the request (e.g.
+// charset[3]). Tags with unknown rules make the handler panic
+type Validator interface {
+	Validate() error
+}
+
+const validateTag = "validate"
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// validate validates the given value and returns all invalid fields. Fields
+// are named after the given tag (e.g. json)
+func validate(v interface{}, nameTag string) []FieldError {
+	val := &validation{nameTag: nameTag}
+	val.value("", reflect.ValueOf(v))
+	return val.errs
+}
+
+// invalid explains, that the given fields of the request's body are invalid
+func invalid(errs []FieldError) *Problem {
+	p := NewProblem(http.StatusBadRequest, "", "the request's body is invalid")
+	p.Errors = errs
+	return p
+}
+
+type validation struct {
+	nameTag string
+	errs    []FieldError
+}
+
+func (val *validation) fail(field, message string) {
+	val.errs = append(val.errs, FieldError{Field: field, Message: message})
+}
+
+// value validates v, which is found at the given path, and everything it
+// contains
+func (val *validation) value(path string, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return
+	}
+	switch {
+	case v.Type().Implements(validatorType):
+		val.validator(path, v.Interface().(Validator))
+	case v.CanAddr() && v.Addr().Type().Implements(validatorType):
+		val.validator(path, v.Addr().Interface().(Validator))
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, ok := val.name(field)
+			if !ok {
+				continue
+			}
+			fieldPath := join(path, name)
+			if val.rules(fieldPath, v.Field(i), field.Tag.Get(validateTag)) {
+				val.value(fieldPath, v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			val.value(index(path, i), v.Index(i))
+		}
+	}
+}
+
+// validator reports the error returned by the given Validator
+func (val *validation) validator(path string, v Validator) {
+	err := v.Validate()
+	if err == nil {
+		return
+	}
+	var p *Problem
+	if errors.As(err, &p) && len(p.Errors) > 0 {
+		for _, e := range p.Errors {
+			val.fail(join(path, e.Field), e.Message)
+		}
+		return
+	}
+	val.fail(path, err.Error())
+}
+
+// name returns the field's name in the request. It returns false, if the field
+// is not part of the request. Embedded structs without name are flattened
+func (val *validation) name(field reflect.StructField) (string, bool) {
+	name := strings.Split(field.Tag.Get(val.nameTag), ",")[0]
+	switch {
+	case name == "-":
+		return "", false
+	case name != "":
+		return name, true
+	case field.Anonymous:
+		return "", true
+	}
+	return field.Name, true
+}
+
+// rules checks the given rules of the field found at the given path. It
+// returns false, if the field is missing, so that it isn't validated any
+// further
+func (val *validation) rules(path string, v reflect.Value, rules string) bool {
+	if rules == "" {
+		return true
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "required":
+			if v.IsZero() || (lengthy(v) && v.Len() == 0) {
+				if lengthy(v) {
+					val.fail(path, "must not be empty")
+				} else {
+					val.fail(path, "is required")
+				}
+				return false
+			}
+		case "min", "max":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("communication: illegal validation rule %q", rule))
+			}
+			val.bound(path, v, name == "min", bound)
+		case "unique":
+			val.unique(path, v)
+		default:
+			panic(fmt.Sprintf("communication: unknown validation rule %q", rule))
+		}
+	}
+	return true
+}
+
+// lengthy returns true, if the rules apply to v's length instead of its value
+func lengthy(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// bound checks, that v, or its length, is at least (if lower) or at most the
+// given bound
+func (val *validation) bound(path string, v reflect.Value, lower bool, bound float64) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	var n float64
+	verb, unit, suffix := "must be ", "", ""
+	switch v.Kind() {
+	case reflect.String:
+		n, unit, suffix = float64(utf8.RuneCountInString(v.String())), " character", " long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, verb, unit = float64(v.Len()), "must contain ", " element"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic("communication: min and max can't be applied to " + v.Type().String())
+	}
+	if unit != "" && bound != 1 {
+		unit += "s"
+	}
+	b := strconv.FormatFloat(bound, 'f', -1, 64) + unit + suffix
+	switch {
+	case lower && n < bound:
+		val.fail(path, verb+"at least "+b)
+	case !lower && n > bound:
+		val.fail(path, verb+"at most "+b)
+	}
+}
+
+// unique reports each element of the slice v, that equals a preceding one
+func (val *validation) unique(path string, v reflect.Value) {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic("communication: unique can't be applied to " + v.Type().String())
+	}
+	if !v.Type().Elem().Comparable() {
+		panic("communication: unique can't be applied to " + v.Type().String())
+	}
+	first := make(map[interface{}]int, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i).Interface()
+		if j, ok := first[e]; ok {
+			val.fail(index(path, i), "duplicates "+index(path, j))
+			continue
+		}
+		first[e] = i
+	}
+}
+
+// join returns the path of the field with the given name in the value found
+// at path
+func join(path, name string) string {
+	switch {
+	case path == "":
+		return name
+	case name == "":
+		return path
+	}
+	return path + "." + name
+}
+
+// index returns the path of the i-th element of the slice found at path
+func index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,104 @@
+package communication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type color string
+
+func (c color) Validate() error {
+	if c != "red" && c != "blue" {
+		return errors.New("must be red or blue")
+	}
+	return nil
+}
+
+type pen struct {
+	Color color `json:"color"`
+}
+
+type box struct {
+	Name   string            `json:"name" validate:"required,max=5"`
+	Size   *int              `json:"size,omitempty" validate:"min=1,max=10"`
+	Pens   []pen             `json:"pens" validate:"min=1,unique"`
+	Labels map[string]string `json:"labels" validate:"max=1"`
+	Hidden string            `json:"-" validate:"required"`
+}
+
+func (b *box) Validate() error {
+	if strings.HasPrefix(b.Name, "empty") && len(b.Pens) > 0 {
+		return NewProblem(http.StatusBadRequest, "", "").WithField("pens", "must be empty")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	size := 11
+	assert.Equal(t, []FieldError{
+		{Field: "name", Message: "must not be empty"},
+		{Field: "size", Message: "must be at most 10"},
+		{Field: "pens", Message: "must contain at least 1 element"},
+		{Field: "labels", Message: "must contain at most 1 element"},
+	}, validate(&box{Size: &size, Labels: map[string]string{"a": "", "b": ""}}, "json"))
+
+	assert.Equal(t, []FieldError{
+		{Field: "pens", Message: "must be empty"},
+		{Field: "name", Message: "must be at most 5 characters long"},
+		{Field: "pens[1]", Message: "duplicates pens[0]"},
+		{Field: "pens[2].color", Message: "must be red or blue"},
+	}, validate(&box{Name: "empty box", Pens: []pen{{"red"}, {"red"}, {"green"}}}, "json"))
+
+	assert.Empty(t, validate(&box{Name: "box", Pens: []pen{{"red"}, {"blue"}}}, "json"))
+	assert.Empty(t, validate(nil, "json"))
+	assert.Panics(t, func() {
+		validate(struct {
+			N int `validate:"positive"`
+		}{}, "json")
+	})
+}
+
+func TestValidation(t *testing.T) {
+	Handle(http.MethodPost, "/validation/handle", func(ctx *Context, req box) (NoResponse, error) {
+		return NoResponse{}, nil
+	})
+	Post("/validation/post", func(req *box, params ParameterMap) (int, interface{}) {
+		return http.StatusOK, nil
+	})
+	Handle(http.MethodGet, "/validation/query", func(ctx *Context, req interface{}) (NoResponse, error) {
+		q := struct {
+			Color color `query:"color"`
+			N     int   `query:"n" validate:"max=10"`
+		}{Color: "red"}
+		return NoResponse{}, ctx.BindQuery(&q)
+	})
+	serve := func(method, path, body string) Problem {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(method, path, strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		var p Problem
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p))
+		return p
+	}
+
+	for _, path := range []string{"/validation/handle", "/validation/post"} {
+		p := serve("POST", path, `{"name":"","pens":[{"color":"green"}]}`)
+		assert.Equal(t, []FieldError{
+			{Field: "name", Message: "must not be empty"},
+			{Field: "pens[0].color", Message: "must be red or blue"},
+		}, p.Errors)
+	}
+
+	p := serve("GET", "/validation/query?color=green&n=11", "")
+	assert.Equal(t, "the request's query is invalid", p.Detail)
+	assert.Equal(t, []FieldError{
+		{Field: "color", Message: "must be red or blue"},
+		{Field: "n", Message: "must be at most 10"},
+	}, p.Errors)
+}
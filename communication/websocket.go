@@ -1,20 +1,37 @@
 package communication
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/logging"
 
-	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/theMomax/notypo-backend/streams"
 )
 
 // HandleStreamFunc represents a handler-function for websocket connection. It
-// is based on a http GET request. If status is not successful (starting with 2)
-// requests are rejected
-type HandleStreamFunc func(params map[string]string) (status int, stream streams.Stream)
+// is based on a http GET request. ctx describes the request (see Context). If
+// status is not successful (starting with 2) requests are rejected
+type HandleStreamFunc func(ctx *Context) (status int, stream streams.Stream)
+
+// connections holds the number of open websocket-connections of each client
+var connections = make(map[string]int)
+var connm sync.Mutex
+
+// sockets counts the open websocket-connections, so that Shutdown can wait for
+// them
+var sockets sync.WaitGroup
+
+// shutdown is closed, when Shutdown is called. shutdownCtx is Shutdown's
+// context. socketm guards closing shutdown and adding to sockets
+var shutdown = make(chan struct{})
+var shutdownCtx context.Context
+var socketm sync.Mutex
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
@@ -27,63 +44,259 @@ var upgrader = websocket.Upgrader{
 // Stream registers a websocket Stream-handler. When a client requests such a
 // Stream, a websocket-connection is established. It can be closed by ether
 // client or server. The latter closes the connection automatically, when the
-// underlying channel (provided by the handler via the streams.Stream interface)
-// is closed. The server only sends the Stream's values, when requested. I.e.
-// the client must send a JSON-encoded uint value, which represents the number
-// of requested streams.Characters.
-// The streams.Characters are sent in JSON format. The actual representation
-// depends on the underlying streams.StreamSource and how it was initialized
-func Stream(path string, handler HandleStreamFunc) {
-	router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+// underlying streams.Stream is closed, e.g. because it timed out. Each request
+// counts as activity on the streams.Stream (see streams.Stream.Touch). The
+// server only sends the Stream's values, when requested. I.e. the client must
+// send a JSON-encoded uint value, which represents the number of requested
+// streams.Characters.
+// The client chooses the format of all messages by requesting a websocket
+// subprotocol named after a registered Codec (e.g. msgpack). It defaults to
+// JSON. The actual representation of the streams.Characters depends on the
+// underlying streams.StreamSource and how it was initialized.
+// Clients exceeding config.Limits.ClientConnections are rejected with
+// http.StatusTooManyRequests. Requesting more than config.Limits.RequestSize
+// streams.Characters at once closes the connection with
+// websocket.CloseMessageTooBig. When the server shuts down, the connection is
+// closed with websocket.CloseGoingAway.
+// Rejected requests are logged like any other request. Established connections
+// are logged, when they are closed. The given middlewares only wrap this
+// handler (see Use). The returned Operation documents the route (see
+// Operation.Messages)
+func Stream(path string, handler HandleStreamFunc, middlewares ...Middleware) *Operation {
+	router.Handle(path, streamRoute(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 		w.Header().Set("Content-Type", "application/json")
-		status, stream := handler(mux.Vars(r))
+		ctx := newContext(r)
+		status, stream := handler(ctx)
 		if (status / 100) != 2 {
-			w.WriteHeader(status)
+			writeError(w, r, status, "")
+			logAccess(r, path, status, time.Since(start))
+			return
+		}
+		if !connect(ctx.Client) {
+			writeError(w, r, http.StatusTooManyRequests, "at most "+strconv.Itoa(config.Limits.ClientConnections)+" websocket connections per client are allowed")
+			logAccess(r, path, http.StatusTooManyRequests, time.Since(start))
 			return
 		}
-		conn, err := upgrader.Upgrade(w, r, nil)
+		defer disconnect(ctx.Client)
+		if !openSocket() {
+			writeError(w, r, http.StatusServiceUnavailable, "server shutting down")
+			logAccess(r, path, http.StatusServiceUnavailable, time.Since(start))
+			return
+		}
+		defer sockets.Done()
+		u := upgrader
+		u.Subprotocols = subprotocols()
+		conn, err := u.Upgrade(w, r, nil)
 		if err != nil {
+			logging.FromContext(r.Context()).Warn("websocket upgrade failed", "route", path, "client", ctx.Client, "error", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		codec := codecNamed(conn.Subprotocol())
+		delivered := 0
+		defer func() {
+			duration := time.Since(start)
+			websocketDuration.Observe(duration.Seconds())
+			logging.FromContext(r.Context()).Info("websocket session",
+				"route", path,
+				"path", r.URL.Path,
+				"duration", duration,
+				"characters", delivered,
+				"codec", codec.Name(),
+				"client", ctx.Client,
+			)
+		}()
 		requests := make(chan uint, 5)
 		closed := make(chan bool, 1)
+		// done tells the reader, that requests aren't received anymore
+		done := make(chan struct{})
+		defer close(done)
 		go func() {
 			for {
 				i := uint(0)
-				err := conn.ReadJSON(&i)
+				err := readMessage(conn, codec, &i)
 				if err != nil {
 					closed <- true
 					close(closed)
 					close(requests)
 					return
 				}
-				requests <- i
+				select {
+				case requests <- i:
+				case <-shutdown:
+					// the request is dropped, but reading goes on, so that
+					// the client's confirmation of closing is received
+				case <-done:
+					return
+				}
 			}
 		}()
+		// goAway closes the connection, because the server shuts down
+		goAway := func() {
+			deadline, _ := shutdownCtx.Deadline()
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(
+				websocket.CloseGoingAway,
+				"server shutting down",
+			), deadline)
+			// wait for the client to confirm closing
+			select {
+			case <-closed:
+			case <-shutdownCtx.Done():
+			}
+			conn.Close()
+		}
 	outer:
 		for {
 			select {
-			case <-time.After(config.StreamBase.StreamTimeout):
+			case <-stream.Done():
 				conn.Close()
 				break outer
 			case <-closed:
 				conn.Close()
 				break outer
+			case <-shutdown:
+				goAway()
+				break outer
 			case n := <-requests:
+				stream.Touch()
+				if max := config.Limits.RequestSize; max > 0 && n > uint(max) {
+					limitsExceeded.Inc(LimitRequestSize)
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(
+						websocket.CloseMessageTooBig,
+						"at most "+strconv.Itoa(max)+" characters may be requested at once",
+					))
+					conn.Close()
+					break outer
+				}
 				for i := 0; i < int(n); i++ {
-					c, ok := <-stream.Channel()
+					var c streams.Character
+					var ok bool
+					select {
+					case <-shutdown:
+						goAway()
+						break outer
+					case <-stream.Done():
+						conn.Close()
+						break outer
+					case c, ok = <-stream.Channel():
+					}
 					if !ok {
 						conn.Close()
 						break outer
 					}
-					err := conn.WriteJSON(c)
+					err := writeMessage(conn, codec, c)
 					if err != nil {
 						conn.Close()
 						break outer
 					}
+					charactersDelivered.Inc()
+					delivered++
 				}
 			}
 		}
-	})
+	}, middlewares))
+	op := document(router, http.MethodGet, path)
+	op.websocket = true
+	return op
+}
+
+// readMessage decodes the next message of the given connection into v
+func readMessage(conn *websocket.Conn, codec Codec, v interface{}) error {
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return err
+	}
+	return codec.Decode(r, v, false)
+}
+
+// writeMessage sends v as a message encoded by the given Codec. Binary Codecs
+// send binary messages
+func writeMessage(conn *websocket.Conn, codec Codec, v interface{}) error {
+	messageType := websocket.TextMessage
+	if codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+	w, err := conn.NextWriter(messageType)
+	if err != nil {
+		return err
+	}
+	err = codec.Encode(w, v)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// connect counts a new websocket-connection of the given client. It returns
+// false, if the client has too many connections already
+func connect(client string) bool {
+	connm.Lock()
+	defer connm.Unlock()
+	if max := config.Limits.ClientConnections; max > 0 && connections[client] >= max {
+		limitsExceeded.Inc(LimitClientConnections)
+		return false
+	}
+	connections[client]++
+	return true
+}
+
+func disconnect(client string) {
+	connm.Lock()
+	defer connm.Unlock()
+	connections[client]--
+	if connections[client] <= 0 {
+		delete(connections, client)
+	}
+}
+
+// shuttingDown returns true, if Shutdown was called
+func shuttingDown() bool {
+	select {
+	case <-shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// openSocket counts a new websocket-connection. It returns false, if the
+// server is shutting down
+func openSocket() bool {
+	socketm.Lock()
+	defer socketm.Unlock()
+	if shuttingDown() {
+		return false
+	}
+	sockets.Add(1)
+	return true
+}
+
+// closeSockets tells all open websocket-connections to close. Connections,
+// whose client doesn't confirm closing, are closed, when ctx is done
+func closeSockets(ctx context.Context) {
+	socketm.Lock()
+	defer socketm.Unlock()
+	if shuttingDown() {
+		return
+	}
+	shutdownCtx = ctx
+	close(shutdown)
+}
+
+// waitForSockets waits until all websocket-connections are closed or until ctx
+// is done
+func waitForSockets(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		sockets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
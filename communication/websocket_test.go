@@ -0,0 +1,104 @@
+package communication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/streams"
+)
+
+type char rune
+
+func (c char) Rune() rune {
+	return rune(c)
+}
+
+func init() {
+	config.IsTest = true
+	config.ConfigPath = "config.ini"
+	config.Load(nil)
+	config.IsTest = false
+}
+
+func TestShutdownClosesWebsockets(t *testing.T) {
+	id, _ := streams.Register(streams.NewRandomCharStreamSource([]streams.Character{char('a')}))
+	Stream("/websocket", func(ctx *Context) (int, streams.Stream) {
+		streamID, err := streams.Open(id)
+		if err != nil {
+			return http.StatusNotFound, nil
+		}
+		s, _ := streams.Get(streamID)
+		return http.StatusOK, s
+	})
+	s := httptest.NewServer(router)
+	defer s.Close()
+	url := "ws" + strings.TrimPrefix(s.URL, "http") + "/websocket"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.WriteJSON(1))
+	var c rune
+	assert.NoError(t, conn.ReadJSON(&c))
+	assert.Equal(t, 'a', c)
+
+	// busy is still sending characters and has more requests queued, than
+	// the server buffers
+	busy, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer busy.Close()
+	assert.NoError(t, busy.WriteJSON(1<<30))
+	assert.NoError(t, busy.ReadJSON(&c))
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, busy.WriteJSON(1))
+	}
+	busyClosed := make(chan error)
+	go func() {
+		for {
+			_, _, err := busy.ReadMessage()
+			if err != nil {
+				busyClosed <- err
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error)
+	go func() {
+		done <- Shutdown(ctx)
+	}()
+	// reading the close frame confirms closing
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if assert.True(t, ok) {
+		assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+		assert.Equal(t, "server shutting down", closeErr.Text)
+	}
+	closeErr, ok = (<-busyClosed).(*websocket.CloseError)
+	if assert.True(t, ok) {
+		assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	}
+	assert.NoError(t, <-done)
+	// both clients confirmed closing, so the deadline wasn't awaited
+	assert.Less(t, time.Since(start), time.Second)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+}
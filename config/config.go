@@ -1,13 +1,15 @@
 // Package config provides config-data. The most-basic information is to be
-// injected at compile-time. Otherwise, this package stops execution with
-// an error, when Load is called. The other configuration-options are loaded
+// injected at compile-time. Otherwise, Load returns an error, when it is
+// called. The other configuration-options are loaded
 // from a config.ini-file, that is located at ConfigPath, when the Load()
 // function is called
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net/url"
+	"os"
 	"strconv"
 	"time"
 
@@ -19,12 +21,16 @@ import (
 // which config-file is used
 const ConfigDependant = "CONFIG-DEPENDANT"
 
+// AdminTokenEnv is the environment variable, that overrides the admin-api's
+// token from the config-file, if set
+const AdminTokenEnv = "NOTYPO_ADMIN_TOKEN"
+
 // IsTest is a flag, that should be set when running tests. If set, this package
 // won't panic, if the following variables were not injected at compile-time
 var IsTest bool
 
-// Version must be injected using the makefile. If its value is set to "develop"
-// this server operates in development-mode, if not specified otherwise via the
+// Version must be injected using the makefile. If its value is set to
+// "development" this server operates in development-mode, if not specified otherwise via the
 // cli. The Version is attached to the version command- and request-output
 var Version string
 
@@ -44,12 +50,41 @@ var ConfigPath string
 // or development mode
 var Server *ServerConfig
 
-// SSL holds the path to the ssl-certificate
+// SSL holds whether and how the server is served via https
 var SSL *SSLConfig
 
-// StreamBase holds the inactivity-timeouts for Streams and StreamSources
+// StreamBase holds the lifetime- and inactivity-timeouts for Streams and
+// StreamSources and the bounds for overriding them
 var StreamBase *StreamBaseConfig
 
+// Token holds, whether StreamSupplierIDs are signed tokens and the key used for
+// signing them
+var Token *TokenConfig
+
+// Registry holds which backend stores the registered StreamSuppliers and how
+// to connect to it
+var Registry *RegistryConfig
+
+// Persistence holds where and how often the registered StreamSuppliers are
+// saved, so that they survive restarts
+var Persistence *PersistenceConfig
+
+// Limits holds the maximum amount of resources, that may be requested in
+// total and by a single client
+var Limits *LimitsConfig
+
+// Admin holds the credentials for and the address of the admin-api
+var Admin *AdminConfig
+
+// Log holds the minimum level and the format of log records
+var Log *LogConfig
+
+// modes of the server (see ServerConfig.Mode)
+const (
+	ModeProduction  = 1
+	ModeDevelopment = 2
+)
+
 // ServerConfig holds the local ip and port and, whether the server runs in
 // production or development mode
 type ServerConfig struct {
@@ -59,24 +94,120 @@ type ServerConfig struct {
 	Mode int `ini:"mode"`
 	// add "*", if you want to allow any origin
 	AllowedRequestOrigins []string `ini:"allowed_request_origins"`
+	// ShutdownTimeout is the time open requests and websocket-connections are
+	// given to finish, when the server shuts down. 0 closes them right away
+	ShutdownTimeout time.Duration `ini:"shutdown_timeout"`
+	// StrictJSON controls, whether request bodies with unknown fields are
+	// rejected
+	StrictJSON bool `ini:"strict_json"`
 }
 
-// SSLConfig holds the path to the ssl-certificate
+// SSLConfig holds whether and how the server is served via https. The
+// certificate and key are reloaded, when their files change. If RedirectPort
+// isn't 0, plain http requests to that port are redirected to https
 type SSLConfig struct {
+	Enabled         bool   `ini:"enabled"`
 	CertificatePath string `ini:"path"`
+	KeyPath         string `ini:"key_path"`
+	RedirectPort    int    `ini:"redirect_port"`
+	HTTP2           bool   `ini:"http2"`
+	// (1.0, 1.1, 1.2 or 1.3)
+	MinVersion string `ini:"min_version"`
+	// CipherSuites holds the names of the allowed cipher suites for TLS 1.0 to
+	// 1.2 (empty means golang's defaults)
+	CipherSuites []string `ini:"cipher_suites"`
 }
 
-// StreamBaseConfig holds the inactivity-timeouts for Streams and StreamSources
+// StreamBaseConfig holds the lifetime- and inactivity-timeouts for Streams and
+// StreamSources. StreamTimeout and IdleTimeout may be overridden for each
+// StreamSource within the given bounds. A bound of 0 means unbounded
 type StreamBaseConfig struct {
 	SupplierTimeout time.Duration `ini:"suppliertimeout"`
-	StreamTimeout   time.Duration `ini:"streamtimeout"`
+	// StreamTimeout is the maximum lifetime of a Stream
+	StreamTimeout time.Duration `ini:"streamtimeout"`
+	// IdleTimeout is the time after which an inactive Stream is closed. 0
+	// disables it
+	IdleTimeout      time.Duration `ini:"idletimeout"`
+	MinStreamTimeout time.Duration `ini:"minstreamtimeout"`
+	MaxStreamTimeout time.Duration `ini:"maxstreamtimeout"`
+	MinIdleTimeout   time.Duration `ini:"minidletimeout"`
+	MaxIdleTimeout   time.Duration `ini:"maxidletimeout"`
+}
+
+// TokenConfig holds, whether StreamSupplierIDs are signed tokens and the key
+// used for signing them. All instances sharing the same key can rebuild each
+// other's StreamSuppliers from such a token
+type TokenConfig struct {
+	Enabled bool   `ini:"enabled"`
+	Key     string `ini:"key"`
+}
+
+// RegistryConfig holds which backend stores the registered StreamSuppliers and
+// how to connect to it. Multiple instances of this server can share a redis
+// backend
+type RegistryConfig struct {
+	// (memory or redis)
+	Backend       string `ini:"backend"`
+	RedisAddress  string `ini:"redis_address"`
+	RedisPassword string `ini:"redis_password"`
+	RedisPrefix   string `ini:"redis_prefix"`
+}
+
+// PersistenceConfig holds where and how often the registered StreamSuppliers
+// are saved, so that they survive restarts. An empty Path disables persistence
+type PersistenceConfig struct {
+	Path     string        `ini:"path"`
+	Interval time.Duration `ini:"interval"`
+	// Cursors controls, whether opened Streams and their positions are saved
+	Cursors bool `ini:"cursors"`
+}
+
+// LimitsConfig holds the maximum amount of resources, that may be requested in
+// total and by a single client. Clients are identified by their ip. A limit of
+// 0 means unlimited
+type LimitsConfig struct {
+	Suppliers          int `ini:"suppliers"`
+	Streams            int `ini:"streams"`
+	StreamsPerSupplier int `ini:"streams_per_supplier"`
+	CharsetSize        int `ini:"charset_size"`
+	// RequestSize is the maximum number of characters a websocket client may
+	// request at once
+	RequestSize       int `ini:"request_size"`
+	ClientSuppliers   int `ini:"client_suppliers"`
+	ClientStreams     int `ini:"client_streams"`
+	ClientConnections int `ini:"client_connections"`
+	// BodySize is the maximum size of a request's body in bytes
+	BodySize int `ini:"body_size"`
+}
+
+// AdminConfig holds the token, that authenticates requests to the admin-api,
+// and the address it is served at. An empty Token disables the admin-api. If
+// Address is empty, the admin-api is served by the api's server. Token is read
+// from the config-file or AdminTokenEnv, but never from a cli flag, so that it
+// doesn't show up in the process list
+type AdminConfig struct {
+	Token   string `ini:"token"`
+	Address string `ini:"address"`
+}
+
+// LogConfig holds the minimum level of log records (debug, info, warn or error)
+// and their format (text or json)
+type LogConfig struct {
+	Level  string `ini:"level"`
+	Format string `ini:"format"`
 }
 
 // config is just a wrapper for parsing the ini-file
 var config struct {
-	SC   ServerConfig     `ini:"server"`
-	SSLC SSLConfig        `ini:"ssl"`
-	SBC  StreamBaseConfig `ini:"streambase"`
+	SC   ServerConfig      `ini:"server"`
+	SSLC SSLConfig         `ini:"ssl"`
+	SBC  StreamBaseConfig  `ini:"streambase"`
+	TC   TokenConfig       `ini:"token"`
+	RC   RegistryConfig    `ini:"registry"`
+	PC   PersistenceConfig `ini:"persistence"`
+	LC   LimitsConfig      `ini:"limits"`
+	AC   AdminConfig       `ini:"admin"`
+	LGC  LogConfig         `ini:"log"`
 }
 
 // Options returns a list of flags for the cli, which represent the
@@ -108,11 +239,51 @@ func Options() []cli.Flag {
 			Value: &cli.StringSlice{ConfigDependant},
 			Usage: "allowed_request_origins contains all url's, which may send requests to this server (format: http://localhost:8080) (add * to allow any source)",
 		},
+		cli.StringFlag{
+			Name:  "server_shutdown_timeout",
+			Value: ConfigDependant,
+			Usage: "shutdown_timeout holds the time in seconds, open requests and websocket connections are given to finish, when the server shuts down",
+		},
+		cli.StringFlag{
+			Name:  "server_strict_json",
+			Value: ConfigDependant,
+			Usage: "strict_json controls, whether request bodies with unknown fields are rejected (true/false)",
+		},
+		cli.StringFlag{
+			Name:  "ssl_enabled",
+			Value: ConfigDependant,
+			Usage: "enabled controls, whether the server is served via https (true/false)",
+		},
 		cli.StringFlag{
 			Name:  "ssl_path, s",
 			Value: ConfigDependant,
 			Usage: "path holds the path to the ssl-certificate",
 		},
+		cli.StringFlag{
+			Name:  "ssl_key_path",
+			Value: ConfigDependant,
+			Usage: "key_path holds the path to the ssl-certificate's private key",
+		},
+		cli.StringFlag{
+			Name:  "ssl_redirect_port",
+			Value: ConfigDependant,
+			Usage: "redirect_port holds the local port, where plain http requests are redirected to https (0 disables redirection)",
+		},
+		cli.StringFlag{
+			Name:  "ssl_http2",
+			Value: ConfigDependant,
+			Usage: "http2 controls, whether HTTP/2 is offered to clients (true/false)",
+		},
+		cli.StringFlag{
+			Name:  "ssl_min_version",
+			Value: ConfigDependant,
+			Usage: "min_version holds the minimum TLS version (1.0, 1.1, 1.2 or 1.3)",
+		},
+		cli.StringSliceFlag{
+			Name:  "ssl_cipher_suites",
+			Value: &cli.StringSlice{ConfigDependant},
+			Usage: "cipher_suites contains the names of the allowed cipher suites for TLS 1.0 to 1.2 (format: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) (leave empty to use golang's defaults)",
+		},
 		cli.StringFlag{
 			Name:  "streambase_suppliertimeout",
 			Value: ConfigDependant,
@@ -123,25 +294,157 @@ func Options() []cli.Flag {
 			Value: ConfigDependant,
 			Usage: "streamtimeout holds the time in seconds, after which a character stream is closed, no matter its activity",
 		},
+		cli.StringFlag{
+			Name:  "streambase_idletimeout",
+			Value: ConfigDependant,
+			Usage: "idletimeout holds the time in seconds, after which a character stream is closed, if no characters were requested (0 disables it)",
+		},
+		cli.StringFlag{
+			Name:  "streambase_minstreamtimeout",
+			Value: ConfigDependant,
+			Usage: "minstreamtimeout holds the minimum streamtimeout in seconds a client may request for its stream supplier (0 means unbounded)",
+		},
+		cli.StringFlag{
+			Name:  "streambase_maxstreamtimeout",
+			Value: ConfigDependant,
+			Usage: "maxstreamtimeout holds the maximum streamtimeout in seconds a client may request for its stream supplier (0 means unbounded)",
+		},
+		cli.StringFlag{
+			Name:  "streambase_minidletimeout",
+			Value: ConfigDependant,
+			Usage: "minidletimeout holds the minimum idletimeout in seconds a client may request for its stream supplier (0 means unbounded)",
+		},
+		cli.StringFlag{
+			Name:  "streambase_maxidletimeout",
+			Value: ConfigDependant,
+			Usage: "maxidletimeout holds the maximum idletimeout in seconds a client may request for its stream supplier (0 means unbounded)",
+		},
+		cli.StringFlag{
+			Name:  "token_enabled",
+			Value: ConfigDependant,
+			Usage: "enabled controls, whether stream-ids are signed tokens, that can be resolved by any server sharing the same key (true/false)",
+		},
+		cli.StringFlag{
+			Name:  "token_key",
+			Value: ConfigDependant,
+			Usage: "key holds the secret used for signing tokens",
+		},
+		cli.StringFlag{
+			Name:  "registry_backend",
+			Value: ConfigDependant,
+			Usage: "backend selects where stream suppliers are stored - in this process' memory (memory) or in a redis server shared with other instances (redis)",
+		},
+		cli.StringFlag{
+			Name:  "registry_redis_address",
+			Value: ConfigDependant,
+			Usage: "redis_address holds the address of the redis server (format: localhost:6379)",
+		},
+		cli.StringFlag{
+			Name:  "registry_redis_password",
+			Value: ConfigDependant,
+			Usage: "redis_password holds the password of the redis server",
+		},
+		cli.StringFlag{
+			Name:  "registry_redis_prefix",
+			Value: ConfigDependant,
+			Usage: "redis_prefix is prepended to all keys stored in the redis server",
+		},
+		cli.StringFlag{
+			Name:  "persistence_path",
+			Value: ConfigDependant,
+			Usage: "path holds the path to the file, stream suppliers are saved to at shutdown and restored from at startup (leave empty to disable persistence)",
+		},
+		cli.StringFlag{
+			Name:  "persistence_interval",
+			Value: ConfigDependant,
+			Usage: "interval holds the time in seconds, after which the stream suppliers are saved periodically (0 disables periodic saving)",
+		},
+		cli.StringFlag{
+			Name:  "persistence_cursors",
+			Value: ConfigDependant,
+			Usage: "cursors controls, whether opened character streams and their positions are saved as well (true/false)",
+		},
+		cli.StringFlag{
+			Name:  "limits_suppliers",
+			Value: ConfigDependant,
+			Usage: "suppliers holds the maximum number of registered stream suppliers (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_streams",
+			Value: ConfigDependant,
+			Usage: "streams holds the maximum number of character streams opened by this server (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_streams_per_supplier",
+			Value: ConfigDependant,
+			Usage: "streams_per_supplier holds the maximum number of character streams opened from a single stream supplier (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_charset_size",
+			Value: ConfigDependant,
+			Usage: "charset_size holds the maximum number of characters in a stream supplier's charset (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_request_size",
+			Value: ConfigDependant,
+			Usage: "request_size holds the maximum number of characters a websocket client may request at once (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_client_suppliers",
+			Value: ConfigDependant,
+			Usage: "client_suppliers holds the maximum number of stream suppliers registered by a single client (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_client_streams",
+			Value: ConfigDependant,
+			Usage: "client_streams holds the maximum number of character streams opened by a single client (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_client_connections",
+			Value: ConfigDependant,
+			Usage: "client_connections holds the maximum number of websocket connections of a single client (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "limits_body_size",
+			Value: ConfigDependant,
+			Usage: "body_size holds the maximum size of a request's body in bytes (0 means unlimited)",
+		},
+		cli.StringFlag{
+			Name:  "admin_address",
+			Value: ConfigDependant,
+			Usage: "address holds the local address of a separate listener for the admin-api (format: localhost:4001) (leave empty to serve it at /admin)",
+		},
+		cli.StringFlag{
+			Name:  "log_level",
+			Value: ConfigDependant,
+			Usage: "level holds the minimum level of log records (debug, info, warn or error)",
+		},
+		cli.StringFlag{
+			Name:  "log_format",
+			Value: ConfigDependant,
+			Usage: "format holds the format of log records (text or json)",
+		},
 	}
 }
 
 // Load updates that part of the configuration-data, which is derived from the
-// config-file located at ConfigPath
+// config-file located at ConfigPath, and the flags given in ctx. An error is
+// returned, if the build is corrupted, the config-file can't be read or a flag
+// is invalid
 func Load(ctx *cli.Context) error {
 	if !IsTest && (Version == "" || GitCommit == "" || BuildTime == "" || ConfigPath == "") {
-		log.Fatal("corrupted build (the configuration was not injected correctly)")
+		return errors.New("corrupted build (the configuration was not injected correctly)")
 	}
 	if ctx != nil {
 		ConfigPath = ctx.String("config")
 		f, err := ini.Load(ConfigPath)
 		if err != nil {
-			log.Fatal("invalid config-path: " + err.Error())
+			return fmt.Errorf("invalid config-path: %w", err)
 		}
 
 		err = f.MapTo(&config)
 		if err != nil {
-			log.Fatal("invalid config-format: " + err.Error())
+			return fmt.Errorf("invalid config-format: %w", err)
 		}
 
 		if ctx.String("server_ip") != ConfigDependant {
@@ -150,13 +453,13 @@ func Load(ctx *cli.Context) error {
 		if ctx.String("server_port") != ConfigDependant {
 			config.SC.Port, err = strconv.Atoi(ctx.String("server_port"))
 			if err != nil {
-				log.Fatal("invalid server_port flag")
+				return errors.New("invalid server_port flag")
 			}
 		}
 		if ctx.String("server_mode") != ConfigDependant {
 			config.SC.Mode, err = strconv.Atoi(ctx.String("server_mode"))
 			if err != nil {
-				log.Fatal("invalid server_mode flag")
+				return errors.New("invalid server_mode flag")
 			}
 		}
 		if len(ctx.StringSlice("server_allowed_request_origins")) > 1 {
@@ -165,45 +468,227 @@ func Load(ctx *cli.Context) error {
 				if s != "*" {
 					_, err := url.ParseRequestURI(s)
 					if err != nil {
-						log.Fatal("invalid server_allowed_request_origins flag " + "(" + s + ")")
+						return fmt.Errorf("invalid server_allowed_request_origins flag (%s)", s)
 					}
 				}
 			}
 		}
+		if ctx.String("server_shutdown_timeout") != ConfigDependant {
+			config.SC.ShutdownTimeout, err = time.ParseDuration(ctx.String("server_shutdown_timeout") + "s")
+			if err != nil {
+				return errors.New("invalid server_shutdown_timeout flag")
+			}
+		}
+		if ctx.String("server_strict_json") != ConfigDependant {
+			config.SC.StrictJSON, err = strconv.ParseBool(ctx.String("server_strict_json"))
+			if err != nil {
+				return errors.New("invalid server_strict_json flag")
+			}
+		}
+		if ctx.String("ssl_enabled") != ConfigDependant {
+			config.SSLC.Enabled, err = strconv.ParseBool(ctx.String("ssl_enabled"))
+			if err != nil {
+				return errors.New("invalid ssl_enabled flag")
+			}
+		}
 		if ctx.String("ssl_path") != ConfigDependant {
 			config.SSLC.CertificatePath = ctx.String("ssl_path")
 		}
+		if ctx.String("ssl_key_path") != ConfigDependant {
+			config.SSLC.KeyPath = ctx.String("ssl_key_path")
+		}
+		if ctx.String("ssl_redirect_port") != ConfigDependant {
+			config.SSLC.RedirectPort, err = strconv.Atoi(ctx.String("ssl_redirect_port"))
+			if err != nil {
+				return errors.New("invalid ssl_redirect_port flag")
+			}
+		}
+		if ctx.String("ssl_http2") != ConfigDependant {
+			config.SSLC.HTTP2, err = strconv.ParseBool(ctx.String("ssl_http2"))
+			if err != nil {
+				return errors.New("invalid ssl_http2 flag")
+			}
+		}
+		if ctx.String("ssl_min_version") != ConfigDependant {
+			config.SSLC.MinVersion = ctx.String("ssl_min_version")
+		}
+		if len(ctx.StringSlice("ssl_cipher_suites")) > 1 {
+			config.SSLC.CipherSuites = ctx.StringSlice("ssl_cipher_suites")[1:]
+		}
 		if ctx.String("streambase_suppliertimeout") != ConfigDependant {
 			config.SBC.SupplierTimeout, err = time.ParseDuration(ctx.String("streambase_suppliertimeout") + "s")
 			if err != nil {
-				log.Fatal("invalid streambase_suppliertimeout flag")
+				return errors.New("invalid streambase_suppliertimeout flag")
 			}
 		}
 		if ctx.String("streambase_streamtimeout") != ConfigDependant {
 			config.SBC.StreamTimeout, err = time.ParseDuration(ctx.String("streambase_streamtimeout") + "s")
 			if err != nil {
-				log.Fatal("invalid streambase_streamtimeout flag")
+				return errors.New("invalid streambase_streamtimeout flag")
+			}
+		}
+		if ctx.String("streambase_idletimeout") != ConfigDependant {
+			config.SBC.IdleTimeout, err = time.ParseDuration(ctx.String("streambase_idletimeout") + "s")
+			if err != nil {
+				return errors.New("invalid streambase_idletimeout flag")
 			}
 		}
+		if ctx.String("streambase_minstreamtimeout") != ConfigDependant {
+			config.SBC.MinStreamTimeout, err = time.ParseDuration(ctx.String("streambase_minstreamtimeout") + "s")
+			if err != nil {
+				return errors.New("invalid streambase_minstreamtimeout flag")
+			}
+		}
+		if ctx.String("streambase_maxstreamtimeout") != ConfigDependant {
+			config.SBC.MaxStreamTimeout, err = time.ParseDuration(ctx.String("streambase_maxstreamtimeout") + "s")
+			if err != nil {
+				return errors.New("invalid streambase_maxstreamtimeout flag")
+			}
+		}
+		if ctx.String("streambase_minidletimeout") != ConfigDependant {
+			config.SBC.MinIdleTimeout, err = time.ParseDuration(ctx.String("streambase_minidletimeout") + "s")
+			if err != nil {
+				return errors.New("invalid streambase_minidletimeout flag")
+			}
+		}
+		if ctx.String("streambase_maxidletimeout") != ConfigDependant {
+			config.SBC.MaxIdleTimeout, err = time.ParseDuration(ctx.String("streambase_maxidletimeout") + "s")
+			if err != nil {
+				return errors.New("invalid streambase_maxidletimeout flag")
+			}
+		}
+		if ctx.String("token_enabled") != ConfigDependant {
+			config.TC.Enabled, err = strconv.ParseBool(ctx.String("token_enabled"))
+			if err != nil {
+				return errors.New("invalid token_enabled flag")
+			}
+		}
+		if ctx.String("token_key") != ConfigDependant {
+			config.TC.Key = ctx.String("token_key")
+		}
+		if config.TC.Enabled && config.TC.Key == "" {
+			return errors.New("token_key must not be empty, if tokens are enabled")
+		}
+		if ctx.String("registry_backend") != ConfigDependant {
+			config.RC.Backend = ctx.String("registry_backend")
+		}
+		if ctx.String("registry_redis_address") != ConfigDependant {
+			config.RC.RedisAddress = ctx.String("registry_redis_address")
+		}
+		if ctx.String("registry_redis_password") != ConfigDependant {
+			config.RC.RedisPassword = ctx.String("registry_redis_password")
+		}
+		if ctx.String("registry_redis_prefix") != ConfigDependant {
+			config.RC.RedisPrefix = ctx.String("registry_redis_prefix")
+		}
+		if ctx.String("persistence_path") != ConfigDependant {
+			config.PC.Path = ctx.String("persistence_path")
+		}
+		if ctx.String("persistence_interval") != ConfigDependant {
+			config.PC.Interval, err = time.ParseDuration(ctx.String("persistence_interval") + "s")
+			if err != nil {
+				return errors.New("invalid persistence_interval flag")
+			}
+		}
+		if ctx.String("persistence_cursors") != ConfigDependant {
+			config.PC.Cursors, err = strconv.ParseBool(ctx.String("persistence_cursors"))
+			if err != nil {
+				return errors.New("invalid persistence_cursors flag")
+			}
+		}
+		if ctx.String("limits_suppliers") != ConfigDependant {
+			config.LC.Suppliers, err = strconv.Atoi(ctx.String("limits_suppliers"))
+			if err != nil || config.LC.Suppliers < 0 {
+				return errors.New("invalid limits_suppliers flag")
+			}
+		}
+		if ctx.String("limits_streams") != ConfigDependant {
+			config.LC.Streams, err = strconv.Atoi(ctx.String("limits_streams"))
+			if err != nil || config.LC.Streams < 0 {
+				return errors.New("invalid limits_streams flag")
+			}
+		}
+		if ctx.String("limits_streams_per_supplier") != ConfigDependant {
+			config.LC.StreamsPerSupplier, err = strconv.Atoi(ctx.String("limits_streams_per_supplier"))
+			if err != nil || config.LC.StreamsPerSupplier < 0 {
+				return errors.New("invalid limits_streams_per_supplier flag")
+			}
+		}
+		if ctx.String("limits_charset_size") != ConfigDependant {
+			config.LC.CharsetSize, err = strconv.Atoi(ctx.String("limits_charset_size"))
+			if err != nil || config.LC.CharsetSize < 0 {
+				return errors.New("invalid limits_charset_size flag")
+			}
+		}
+		if ctx.String("limits_request_size") != ConfigDependant {
+			config.LC.RequestSize, err = strconv.Atoi(ctx.String("limits_request_size"))
+			if err != nil || config.LC.RequestSize < 0 {
+				return errors.New("invalid limits_request_size flag")
+			}
+		}
+		if ctx.String("limits_client_suppliers") != ConfigDependant {
+			config.LC.ClientSuppliers, err = strconv.Atoi(ctx.String("limits_client_suppliers"))
+			if err != nil || config.LC.ClientSuppliers < 0 {
+				return errors.New("invalid limits_client_suppliers flag")
+			}
+		}
+		if ctx.String("limits_client_streams") != ConfigDependant {
+			config.LC.ClientStreams, err = strconv.Atoi(ctx.String("limits_client_streams"))
+			if err != nil || config.LC.ClientStreams < 0 {
+				return errors.New("invalid limits_client_streams flag")
+			}
+		}
+		if ctx.String("limits_client_connections") != ConfigDependant {
+			config.LC.ClientConnections, err = strconv.Atoi(ctx.String("limits_client_connections"))
+			if err != nil || config.LC.ClientConnections < 0 {
+				return errors.New("invalid limits_client_connections flag")
+			}
+		}
+		if ctx.String("limits_body_size") != ConfigDependant {
+			config.LC.BodySize, err = strconv.Atoi(ctx.String("limits_body_size"))
+			if err != nil || config.LC.BodySize < 0 {
+				return errors.New("invalid limits_body_size flag")
+			}
+		}
+		if ctx.String("admin_address") != ConfigDependant {
+			config.AC.Address = ctx.String("admin_address")
+		}
+		if ctx.String("log_level") != ConfigDependant {
+			config.LGC.Level = ctx.String("log_level")
+		}
+		if ctx.String("log_format") != ConfigDependant {
+			config.LGC.Format = ctx.String("log_format")
+		}
+	}
+	if token, ok := os.LookupEnv(AdminTokenEnv); ok {
+		config.AC.Token = token
 	}
 
 	config.SC.Mode = evalActualMode(config.SC.Mode)
 	Server = &config.SC
 	SSL = &config.SSLC
 	StreamBase = &config.SBC
+	Token = &config.TC
+	Registry = &config.RC
+	Persistence = &config.PC
+	Limits = &config.LC
+	Admin = &config.AC
+	Log = &config.LGC
 	return nil
 }
 
+// evalActualMode returns the mode the server runs in. Unless the mode is
+// specified explicitly, only development builds run in development mode
 func evalActualMode(climode int) int {
-	if climode == 1 {
-		return 1
-	} else if climode == 2 {
-		return 2
+	if climode == ModeProduction {
+		return ModeProduction
+	} else if climode == ModeDevelopment {
+		return ModeDevelopment
 	} else {
 		if Version == "development" {
-			return 1
+			return ModeDevelopment
 		} else {
-			return 2
+			return ModeProduction
 		}
 	}
 }
@@ -1,13 +1,25 @@
 module github.com/theMomax/notypo-backend
 
+go 1.21
+
 require (
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/gorilla/handlers v1.4.0
 	github.com/gorilla/mux v1.7.0
 	github.com/gorilla/websocket v1.4.0
-	github.com/smartystreets/goconvey v0.0.0-20190306220146-200a235640ff // indirect
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.9.0
 	github.com/urfave/cli v1.20.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	gopkg.in/ini.v1 v1.42.0
 )
 
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/smartystreets/goconvey v0.0.0-20190306220146-200a235640ff // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
 replace github.com/urfave/cli v1.20.0 => ../cli
@@ -0,0 +1,73 @@
+// Package logging configures the structured logger (see log/slog) used
+// throughout this program and carries request-scoped loggers in contexts.
+// Packages log via slog's package-level functions or via the logger returned
+// by FromContext, which adds the request's fields (e.g. its request-id)
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// errors
+var (
+	ErrInvalidLevel  = errors.New("the given log level is unknown")
+	ErrInvalidFormat = errors.New("the given log format is unknown")
+)
+
+// formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Setup makes a logger, that writes records of at least the given level in the
+// given format to w, the default logger. The level is one of debug, info, warn
+// or error. The format is FormatText or FormatJSON. Empty values default to
+// info and FormatText
+func Setup(w io.Writer, level, format string) error {
+	logger, err := New(w, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// New returns a logger configured as described at Setup
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		err := l.UnmarshalText([]byte(level))
+		if err != nil {
+			return nil, ErrInvalidLevel
+		}
+	}
+	options := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, ErrInvalidFormat
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx, that carries the given logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx or the default logger, if ctx
+// doesn't carry one
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	var b bytes.Buffer
+	logger, err := New(&b, "warn", FormatJSON)
+	assert.NoError(t, err)
+	logger.Info("dropped")
+	logger.Warn("kept", "supplier_id", int64(42))
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &record))
+	assert.Equal(t, "kept", record["msg"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, float64(42), record["supplier_id"])
+
+	b.Reset()
+	logger, err = New(&b, "", "")
+	assert.NoError(t, err)
+	logger.Debug("dropped")
+	logger.Info("kept")
+	assert.Contains(t, b.String(), "level=INFO msg=kept")
+
+	_, err = New(&b, "verbose", FormatText)
+	assert.Equal(t, ErrInvalidLevel, err)
+	_, err = New(&b, "info", "xml")
+	assert.Equal(t, ErrInvalidFormat, err)
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, slog.Default(), FromContext(context.Background()))
+	var b bytes.Buffer
+	logger, _ := New(&b, "info", FormatText)
+	ctx := NewContext(context.Background(), logger.With("request_id", "abc"))
+	FromContext(ctx).Info("request")
+	assert.Contains(t, b.String(), "msg=request request_id=abc")
+}
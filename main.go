@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/theMomax/notypo-backend/api"
 	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/logging"
+	"github.com/theMomax/notypo-backend/streams"
 	"github.com/urfave/cli"
 )
 
@@ -21,11 +27,84 @@ func main() {
 		Action: serve,
 		Flags:  config.Options(),
 		Before: config.Load,
+	}, cli.Command{
+		Name:      "openapi",
+		Usage:     "write the api's OpenAPI document to a file",
+		ArgsUsage: "[file (default: openapi.json)]",
+		Action:    writeOpenAPI,
 	}}
-	app.Run(os.Args)
+	err := app.Run(os.Args)
+	if err != nil {
+		fatal("running the command failed", err)
+	}
 }
 
 func serve(ctx *cli.Context) {
+	err := logging.Setup(os.Stderr, config.Log.Level, config.Log.Format)
+	if err != nil {
+		fatal("invalid log configuration", err)
+	}
+	err = streams.Setup()
+	if err != nil {
+		fatal("invalid registry configuration", err)
+	}
 	api.Register()
-	api.Serve()
+	stopped := make(chan struct{})
+	go shutdownOnSignal(stopped)
+	slog.Info("serving", "ip", config.Server.IP, "port", config.Server.Port, "version", config.Version)
+	err = api.Serve()
+	if err != nil {
+		fatal("serving failed", err)
+	}
+	<-stopped
+	slog.Info("stopped")
+}
+
+// writeOpenAPI writes the OpenAPI document of all registered operations to
+// the file given as first argument
+func writeOpenAPI(ctx *cli.Context) {
+	file := ctx.Args().First()
+	if file == "" {
+		file = "openapi.json"
+	}
+	api.Register()
+	doc, err := api.OpenAPI()
+	if err != nil {
+		fatal("generating the OpenAPI document failed", err)
+	}
+	err = os.WriteFile(file, doc, 0644)
+	if err != nil {
+		fatal("writing the OpenAPI document failed", err)
+	}
+}
+
+// fatal logs the given error and exits the process
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// shutdownOnSignal shuts the server down gracefully, when the process is
+// interrupted or terminated. First, the registered stream suppliers are saved,
+// so that the positions of the open streams are preserved. Then, the server
+// stops accepting connections and closes the open ones within
+// config.Server.ShutdownTimeout. stopped is closed afterwards. A second signal
+// terminates the process right away
+func shutdownOnSignal(stopped chan<- struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	signal.Stop(signals)
+	slog.Info("shutting down", "signal", sig.String())
+	err := streams.Persist()
+	if err != nil {
+		slog.Error("saving stream suppliers failed", "error", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+	err = api.Shutdown(ctx)
+	if err != nil {
+		slog.Error("shutdown failed", "error", err)
+	}
+	close(stopped)
 }
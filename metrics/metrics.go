@@ -0,0 +1,328 @@
+// Package metrics collects metrics and publishes them in the Prometheus text
+// exposition format. It implements the small subset of Prometheus' client
+// library this program needs, so that it doesn't depend on it: Counters,
+// Histograms and Gauges, whose values are collected when they are published.
+// All metrics are registered with a default registry, when they are created.
+// Metrics are safe for concurrent use
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default buckets of a Histogram. They are tailored to
+// measure latencies in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is anything, that can be published
+type metric interface {
+	// describe returns the name, help and type of the metric
+	describe() (name, help, kind string)
+	// write writes the metric's samples
+	write(w *bufio.Writer)
+}
+
+var registry = struct {
+	metrics map[string]metric
+	m       sync.Mutex
+}{metrics: make(map[string]metric)}
+
+// register adds the given metric to the default registry. It panics, if a
+// metric with the same name is registered already
+func register(m metric) {
+	name, _, _ := m.describe()
+	registry.m.Lock()
+	defer registry.m.Unlock()
+	if _, ok := registry.metrics[name]; ok {
+		panic("metrics: " + name + " is registered already")
+	}
+	registry.metrics[name] = m
+}
+
+// Handler returns a http.Handler, that publishes all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write writes all registered metrics in the text exposition format ordered by
+// their names
+func Write(out io.Writer) error {
+	registry.m.Lock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = registry.metrics[name]
+	}
+	registry.m.Unlock()
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		name, help, kind := m.describe()
+		w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+		w.WriteString("# TYPE " + name + " " + kind + "\n")
+		m.write(w)
+	}
+	return w.Flush()
+}
+
+// desc holds a metric's description and the names of its labels
+type desc struct {
+	name, help string
+	labels     []string
+}
+
+// key returns the key of the series with the given label values. It panics, if
+// the number of values doesn't match the number of labels
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic("metrics: " + d.name + " requires " + strconv.Itoa(len(d.labels)) + " label values")
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series returns the formatted labels of the series with the given label
+// values and the given additional label
+func (d *desc) series(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, d.labels[i]+`="`+escapeValue(v)+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeValue(extra[1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a metric, whose values only increase
+type Counter struct {
+	desc
+	// m guards values
+	m      sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounter registers a Counter with the given name, help and labels
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		desc:   desc{name: name, help: help, labels: labels},
+		values: make(map[string]*counterValue),
+	}
+	register(c)
+	return c
+}
+
+// Add adds v to the series with the given label values. v must not be negative
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.m.Lock()
+	defer c.m.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labels: labelValues}
+		c.values[key] = value
+	}
+	value.value += v
+}
+
+// Inc adds 1 to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the value of the series with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.m.Lock()
+	defer c.m.Unlock()
+	if value, ok := c.values[key]; ok {
+		return value.value
+	}
+	return 0
+}
+
+func (c *Counter) describe() (name, help, kind string) {
+	return c.name, c.help, "counter"
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		value := c.values[key]
+		w.WriteString(c.name + c.series(value.labels) + " " + formatFloat(value.value) + "\n")
+	}
+}
+
+// Histogram is a metric, that counts observations in configurable buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	// m guards values
+	m      sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	// counts holds the number of observations in each bucket, the last one
+	// being +Inf. They aren't cumulative
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers a Histogram with the given name, help, buckets and
+// labels. The buckets are the sorted upper bounds of the buckets. The +Inf
+// bucket is added implicitly
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds v to the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.m.Lock()
+	defer h.m.Unlock()
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{labels: labelValues, counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = value
+	}
+	value.counts[i]++
+	value.sum += v
+	value.count++
+}
+
+// Count returns the number of observations of the series with the given label
+// values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.m.Lock()
+	defer h.m.Unlock()
+	if value, ok := h.values[key]; ok {
+		return value.count
+	}
+	return 0
+}
+
+func (h *Histogram) describe() (name, help, kind string) {
+	return h.name, h.help, "histogram"
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		value := h.values[key]
+		cumulative := uint64(0)
+		for i, count := range value.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			w.WriteString(h.name + "_bucket" + h.series(value.labels, "le", formatFloat(le)) + " " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(h.name + "_sum" + h.series(value.labels) + " " + formatFloat(value.sum) + "\n")
+		w.WriteString(h.name + "_count" + h.series(value.labels) + " " + strconv.FormatUint(value.count, 10) + "\n")
+	}
+}
+
+// Gauge is a metric, whose values are collected, when it is published
+type Gauge struct {
+	desc
+	collect func(set func(v float64, labelValues ...string))
+}
+
+// NewGauge registers a Gauge with the given name, help and labels. When the
+// Gauge is published, collect is called. It must call set for each series
+func NewGauge(name, help string, collect func(set func(v float64, labelValues ...string)), labels ...string) *Gauge {
+	g := &Gauge{
+		desc:    desc{name: name, help: help, labels: labels},
+		collect: collect,
+	}
+	register(g)
+	return g
+}
+
+func (g *Gauge) describe() (name, help, kind string) {
+	return g.name, g.help, "gauge"
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	values := make(map[string]*counterValue)
+	g.collect(func(v float64, labelValues ...string) {
+		values[g.key(labelValues)] = &counterValue{labels: labelValues, value: v}
+	})
+	for _, key := range sortedKeys(values) {
+		value := values[key]
+		w.WriteString(g.name + g.series(value.labels) + " " + formatFloat(value.value) + "\n")
+	}
+}
+
+// sortedKeys returns the keys of the given map in ascending order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*counterValue:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramValue:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueEscaper.Replace(s)
+}
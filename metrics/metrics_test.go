@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_counter_total", "Counts\nthings.", "kind")
+	c.Inc("b")
+	c.Add(2.5, "a")
+	c.Inc(`"quoted"`)
+	assert.Equal(t, 2.5, c.Value("a"))
+	assert.Zero(t, c.Value("c"))
+	assert.Panics(t, func() {
+		c.Inc()
+	})
+	assert.Equal(t, `# HELP test_counter_total Counts\nthings.
+# TYPE test_counter_total counter
+test_counter_total{kind="\"quoted\""} 1
+test_counter_total{kind="a"} 2.5
+test_counter_total{kind="b"} 1
+`, written(t, "test_counter_total"))
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_histogram_seconds", "Measures things.", []float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(3)
+	h.Observe(10)
+	assert.Equal(t, uint64(4), h.Count())
+	assert.Equal(t, `# HELP test_histogram_seconds Measures things.
+# TYPE test_histogram_seconds histogram
+test_histogram_seconds_bucket{le="1"} 2
+test_histogram_seconds_bucket{le="5"} 3
+test_histogram_seconds_bucket{le="+Inf"} 4
+test_histogram_seconds_sum 14.5
+test_histogram_seconds_count 4
+`, written(t, "test_histogram_seconds"))
+}
+
+func TestGauge(t *testing.T) {
+	NewGauge("test_gauge", "Collects things.", func(set func(v float64, labelValues ...string)) {
+		set(3, "x", "y")
+		set(1, "a", "b")
+	}, "first", "second")
+	assert.Equal(t, `# HELP test_gauge Collects things.
+# TYPE test_gauge gauge
+test_gauge{first="a",second="b"} 1
+test_gauge{first="x",second="y"} 3
+`, written(t, "test_gauge"))
+	assert.Panics(t, func() {
+		NewGauge("test_gauge", "", func(func(float64, ...string)) {})
+	})
+}
+
+func TestHandler(t *testing.T) {
+	NewCounter("test_handler_total", "Counts requests.").Inc()
+	resp := httptest.NewRecorder()
+	Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, resp.Code)
+	assert.True(t, strings.HasPrefix(resp.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Contains(t, resp.Body.String(), "\ntest_handler_total 1\n")
+}
+
+// written returns the published lines of the metric with the given name
+func written(t *testing.T, name string) string {
+	var b bytes.Buffer
+	assert.NoError(t, Write(&b))
+	var lines []string
+	for _, line := range strings.SplitAfter(b.String(), "\n") {
+		fields := strings.Fields(strings.TrimPrefix(line, "# "))
+		if len(fields) == 0 {
+			continue
+		}
+		metric := fields[0]
+		if metric == "HELP" || metric == "TYPE" {
+			metric = fields[1]
+		}
+		if strings.HasPrefix(strings.SplitN(metric, "{", 2)[0], name) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,131 @@
+package streams
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDrainMode is returned, if a StreamSource is registered, while the Registry
+// is in drain mode
+var ErrDrainMode = errors.New("the server is draining and doesn't accept new suppliers")
+
+// SetDrainMode enables or disables the drain mode of the default Registry
+func SetDrainMode(enabled bool) {
+	defaultRegistry.Load().SetDrainMode(enabled)
+}
+
+// SetDrainMode enables or disables the Registry's drain mode. While it is
+// enabled, the Registry refuses to register StreamSources with ErrDrainMode,
+// but the registered StreamSuppliers and opened Streams continue to work, so
+// that this process can be shut down as soon as they are gone. The drain mode
+// only affects this Registry, even if it shares its Backend with other
+// processes
+func (r *Registry) SetDrainMode(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&r.drain, v)
+}
+
+// DrainMode returns true, if the default Registry is in drain mode
+func DrainMode() bool {
+	return defaultRegistry.Load().DrainMode()
+}
+
+// DrainMode returns true, if the Registry is in drain mode
+func (r *Registry) DrainMode() bool {
+	return atomic.LoadInt32(&r.drain) == 1
+}
+
+// Suppliers describes all StreamSuppliers registered with the default Registry
+func Suppliers() (infos []SupplierInfo, err error) {
+	return defaultRegistry.Load().Suppliers()
+}
+
+// Suppliers describes all StreamSuppliers registered in the Registry's Backend,
+// including those registered by other processes sharing the same Backend. They
+// are ordered by the time they were registered
+func (r *Registry) Suppliers() (infos []SupplierInfo, err error) {
+	ids, err := r.backend.ListSuppliers()
+	if err != nil {
+		return nil, err
+	}
+	infos = make([]SupplierInfo, 0, len(ids))
+	for _, id := range ids {
+		info, err := r.Supplier(id)
+		// the StreamSupplier was unregistered in the meantime
+		if err == ErrNoSuchSupplier {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos, nil
+}
+
+// StreamInfo describes an opened Stream
+type StreamInfo struct {
+	ID         int64
+	SupplierID int64
+	// Type is the type of the StreamSupplier's StreamSource
+	Type string
+	// Client is the client, whose quota the Stream counts towards
+	Client string
+	// Opened is the time, when this process opened or restored the Stream
+	Opened time.Time
+	// Age is the time passed since Opened
+	Age          time.Duration
+	Deadline     time.Time
+	IdleDeadline time.Time
+	// Delivered is the number of Characters the Stream generated so far. It is
+	// zero, if the Stream isn't a PositionedStream
+	Delivered uint64
+}
+
+// Streams describes all Streams opened by the default Registry
+func Streams() []StreamInfo {
+	return defaultRegistry.Load().Streams()
+}
+
+// Streams describes all Active Streams opened by this Registry. Streams opened
+// by other processes sharing the same Backend aren't included. They are ordered
+// by the time they were opened
+func (r *Registry) Streams() []StreamInfo {
+	var opened []*streamWrapper
+	r.eachStream(func(s *streamWrapper) {
+		opened = append(opened, s)
+	})
+	now := r.clock.Now()
+	infos := make([]StreamInfo, 0, len(opened))
+	for _, s := range opened {
+		if s.State() != Active {
+			continue
+		}
+		info := StreamInfo{
+			ID:           s.id,
+			SupplierID:   s.supplierID,
+			Type:         s.sourceType,
+			Client:       s.client,
+			Opened:       s.opened,
+			Age:          now.Sub(s.opened),
+			Deadline:     s.deadline,
+			IdleDeadline: s.IdleDeadline(),
+		}
+		if p, ok := s.UnregisteredStream.(PositionedStream); ok {
+			info.Delivered = p.Position()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Opened.Before(infos[j].Opened)
+	})
+	return infos
+}
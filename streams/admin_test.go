@@ -0,0 +1,79 @@
+package streams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestDrainMode(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour))
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c'))
+	id, _ := r.Register(src)
+	token, _ := Token(src, Timeouts{}, testKey)
+
+	r.SetDrainMode(true)
+	assert.True(t, r.DrainMode())
+	_, err := r.Register(src)
+	assert.Equal(t, ErrDrainMode, err)
+	_, err = r.ResolveToken(token, testKey)
+	assert.Equal(t, ErrDrainMode, err)
+	// registered StreamSuppliers continue to work
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+
+	r.SetDrainMode(false)
+	assert.False(t, r.DrainMode())
+	_, err = r.Register(src)
+	assert.NoError(t, err)
+	r.Close(sid)
+}
+
+func TestListSuppliersAndStreams(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour), WithIdleTimeout(-1))
+	first, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	c.Advance(time.Second)
+	second, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+
+	infos, err := r.Suppliers()
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, first, infos[0].ID)
+		assert.Equal(t, second, infos[1].ID)
+		assert.Equal(t, time.Second, infos[0].Age)
+	}
+
+	opened := c.Now()
+	sid0, _ := r.OpenAs("client", first)
+	c.Advance(time.Second)
+	sid1, _ := r.Open(second)
+	s, _ := r.Get(sid0)
+	for i := 0; i < 10; i++ {
+		<-s.Channel()
+	}
+	list := r.Streams()
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, sid0, list[0].ID)
+		assert.Equal(t, first, list[0].SupplierID)
+		assert.Equal(t, "client", list[0].Client)
+		assert.Equal(t, opened, list[0].Opened)
+		assert.Equal(t, time.Second, list[0].Age)
+		assert.Equal(t, opened.Add(time.Hour), list[0].Deadline)
+		// the generator counts a Character right after handing it over
+		assert.True(t, list[0].Delivered >= 9)
+		assert.Equal(t, sid1, list[1].ID)
+	}
+
+	r.Close(sid0)
+	r.Close(sid1)
+	infos, _ = r.Suppliers()
+	assert.Empty(t, infos)
+	assert.Empty(t, r.Streams())
+}
@@ -0,0 +1,162 @@
+package streams
+
+import (
+	"errors"
+	"time"
+
+	"github.com/theMomax/notypo-backend/clock"
+	"github.com/theMomax/notypo-backend/config"
+)
+
+// errors
+var (
+	ErrCodeTaken      = errors.New("the given share-code is already in use")
+	ErrTokenTaken     = errors.New("the given token is already in use")
+	ErrUnknownBackend = errors.New("the configured registry backend is unknown")
+)
+
+// Backend stores the state of the registry, i.e. the registered
+// StreamSuppliers, their share-codes and tokens, their connection-count and
+// the opened Streams' references to their StreamSupplier. A Backend is
+// responsible for unregistering StreamSuppliers: A StreamSupplier is
+// unregistered, when ether it wasn't connected to within its timeout, or its
+// connection-count dropped to zero. A StreamSupplier, that times out while
+// connections are still open, is Draining, i.e. it refuses new connections
+// until the last one is closed. Backends must be safe for concurrent use.
+// The actual Instances of a StreamSupplier are never stored in the Backend, but
+// always belong to the process, which opened them
+type Backend interface {
+	// WriteSupplier registers the given record under the given id. It returns
+	// ErrCodeTaken or ErrTokenTaken, if the record's share-code or token is
+	// already in use. The StreamSupplier is unregistered, if Connect isn't
+	// called within timeout
+	WriteSupplier(id int64, record SupplierRecord, timeout time.Duration) error
+	// ReadSupplier returns the record registered under the given id
+	ReadSupplier(id int64) (record SupplierRecord, ok bool, err error)
+	// ReadCode returns the id of the StreamSupplier with the given share-code
+	ReadCode(code string) (id int64, ok bool, err error)
+	// ReadToken returns the id of the StreamSupplier with the given token
+	ReadToken(token string) (id int64, ok bool, err error)
+	// ReadStatus returns the current status of the StreamSupplier registered
+	// under the given id
+	ReadStatus(id int64) (status SupplierStatus, ok bool, err error)
+	// CountSuppliers returns the number of registered StreamSuppliers
+	CountSuppliers() (n int, err error)
+	// ListSuppliers returns the ids of all registered StreamSuppliers
+	ListSuppliers() (ids []int64, err error)
+	// KeepAlive resets the timeout of the StreamSupplier with the given id as
+	// Connect does, but without adding a connection. It returns
+	// ErrNoSuchSupplier, if there is no such StreamSupplier, or a *StateError,
+	// if it is Draining
+	KeepAlive(id int64) error
+	// DeleteSupplier unregisters the StreamSupplier with the given id, no
+	// matter its connection-count. It returns ErrNoSuchSupplier, if there is
+	// no such StreamSupplier
+	DeleteSupplier(id int64) error
+	// Connect increments the connection-count of the StreamSupplier with the
+	// given id and resets its timeout. It returns ErrNoSuchSupplier, if there
+	// is no such StreamSupplier, a *StateError, if it is Draining, or a
+	// *LimitError, if the connection-count would exceed limit. A limit of zero
+	// means unlimited
+	Connect(id int64, limit int) error
+	// Disconnect decrements the connection-count of the StreamSupplier with
+	// the given id. The StreamSupplier is unregistered, if the count drops to
+	// zero
+	Disconnect(id int64) error
+	// WriteStream stores, that the Stream with the given id was opened from
+	// the StreamSupplier with the given supplierID. The Stream is closed at
+	// latest after timeout. Backends, that share their state with other
+	// processes, may delete the reference then, so that the references of
+	// processes, which crash, don't leak. Otherwise, the reference is kept
+	// until DeleteStream is called
+	WriteStream(id int64, supplierID int64, timeout time.Duration) error
+	// DeleteStream deletes the reference stored by WriteStream and returns the
+	// referenced supplierID. If there was no such reference, !ok is returned
+	DeleteStream(id int64) (supplierID int64, ok bool, err error)
+}
+
+// SupplierRecord is a Backend's representation of a StreamSupplier
+type SupplierRecord struct {
+	// Source is the registered StreamSource. Backends, that share their state
+	// with other processes, require a DescribedSource
+	Source StreamSource
+	// Code is the StreamSupplier's share-code
+	Code string
+	// Token is the token the StreamSupplier was rebuilt from. It may be empty
+	Token string
+	// Timeouts override the Registry's timeouts for the StreamSupplier's
+	// Streams
+	Timeouts Timeouts
+	// Created is the time, when the StreamSupplier was registered
+	Created time.Time
+}
+
+// SupplierStatus is the part of a StreamSupplier's state, that changes over
+// time
+type SupplierStatus struct {
+	State State
+	// Connections is the number of Streams opened from the StreamSupplier
+	Connections int
+	// Expires is the time, when the StreamSupplier times out, if no Stream is
+	// opened from it until then
+	Expires time.Time
+}
+
+// backend names used in config.Registry
+const (
+	MemoryBackend = "memory"
+	RedisBackend  = "redis"
+)
+
+// Setup replaces the default Registry with a new one. It is configured
+// WithConfig and uses the Backend specified in config.Registry, unless the
+// given Options, which are applied afterwards, say otherwise. If
+// config.Persistence specifies a path, the StreamSuppliers saved there are
+// restored and saved periodically from now on. Setup should only be called at
+// startup, since the Streams of the former default Registry aren't moved
+func Setup(options ...Option) error {
+	r := newRegistry(append([]Option{WithConfig()}, options...)...)
+	if r.backend == nil {
+		b, err := configuredBackend(r.clock)
+		if err != nil {
+			return err
+		}
+		r.backend = b
+	}
+	if config.Persistence != nil && config.Persistence.Path != "" {
+		err := r.RestoreSnapshot(config.Persistence.Path)
+		if err != nil {
+			return err
+		}
+		if config.Persistence.Interval > 0 {
+			r.PersistPeriodically(config.Persistence.Path, config.Persistence.Interval, config.Persistence.Cursors)
+		}
+	}
+	defaultRegistry.Store(r)
+	return nil
+}
+
+// Persist saves the registered StreamSuppliers as specified in
+// config.Persistence. It should be called right before this process exits
+func Persist() error {
+	if config.Persistence.Path == "" {
+		return nil
+	}
+	return SaveSnapshot(config.Persistence.Path, config.Persistence.Cursors)
+}
+
+// configuredBackend returns the Backend specified in config.Registry, which
+// uses the given Clock
+func configuredBackend(c clock.Clock) (Backend, error) {
+	if config.Registry == nil {
+		return NewMemoryBackendWithClock(c), nil
+	}
+	switch config.Registry.Backend {
+	case "", MemoryBackend:
+		return NewMemoryBackendWithClock(c), nil
+	case RedisBackend:
+		return NewRedisBackendWithClock(config.Registry.RedisAddress, config.Registry.RedisPassword, config.Registry.RedisPrefix, c)
+	default:
+		return nil, ErrUnknownBackend
+	}
+}
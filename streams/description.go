@@ -0,0 +1,141 @@
+package streams
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errors
+var (
+	ErrNotDescribable     = errors.New("the given source can't be rebuilt from a description")
+	ErrInvalidDescription = errors.New("the given description does not describe a valid source")
+)
+
+// source types
+const (
+	// RandomSourceType describes StreamSources created by
+	// NewRandomCharStreamSource
+	RandomSourceType = "random"
+)
+
+// descriptionVersion is the version of the binary encoding of
+// SourceDescriptions
+const descriptionVersion byte = 1
+
+// SourceDescription holds all information necessary to rebuild a StreamSource.
+// Two StreamSources built from the same SourceDescription generate the exact
+// same output
+type SourceDescription struct {
+	Type    string `json:"type"`
+	Seed    int64  `json:"seed"`
+	Charset []rune `json:"charset"`
+}
+
+// DescribedSource is a StreamSource, that can be rebuilt from its description
+type DescribedSource interface {
+	StreamSource
+	// Description returns the SourceDescription, this source can be rebuilt
+	// from using Rebuild
+	Description() SourceDescription
+}
+
+// runeCharacter is the Character used by rebuilt StreamSources
+type runeCharacter rune
+
+// Rebuild creates a StreamSource, that generates the exact same output as the
+// StreamSource the given SourceDescription was taken from
+func Rebuild(d SourceDescription) (StreamSource, error) {
+	switch d.Type {
+	case RandomSourceType:
+		charset := make([]Character, len(d.Charset))
+		for i, r := range d.Charset {
+			charset[i] = runeCharacter(r)
+		}
+		source := NewSeededRandomCharStreamSource(d.Seed, charset)
+		if source == nil {
+			return nil, ErrInvalidDescription
+		}
+		return source, nil
+	default:
+		return nil, ErrInvalidDescription
+	}
+}
+
+func (c runeCharacter) Rune() rune {
+	return rune(c)
+}
+
+// MarshalBinary encodes the SourceDescription in a compact binary format
+func (d SourceDescription) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 2+len(d.Type)+binary.MaxVarintLen64*(2+len(d.Charset)))
+	b = append(b, descriptionVersion)
+	b = appendUvarint(b, uint64(len(d.Type)))
+	b = append(b, d.Type...)
+	b = appendVarint(b, d.Seed)
+	b = appendUvarint(b, uint64(len(d.Charset)))
+	for _, r := range d.Charset {
+		b = appendVarint(b, int64(r))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a SourceDescription encoded by MarshalBinary
+func (d *SourceDescription) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 || b[0] != descriptionVersion {
+		return ErrInvalidDescription
+	}
+	b = b[1:]
+	l, b, ok := readUvarint(b)
+	if !ok || uint64(len(b)) < l {
+		return ErrInvalidDescription
+	}
+	d.Type = string(b[:l])
+	b = b[l:]
+	d.Seed, b, ok = readVarint(b)
+	if !ok {
+		return ErrInvalidDescription
+	}
+	l, b, ok = readUvarint(b)
+	if !ok || uint64(len(b)) < l {
+		return ErrInvalidDescription
+	}
+	d.Charset = make([]rune, l)
+	for i := range d.Charset {
+		var r int64
+		r, b, ok = readVarint(b)
+		if !ok {
+			return ErrInvalidDescription
+		}
+		d.Charset[i] = rune(r)
+	}
+	if len(b) != 0 {
+		return ErrInvalidDescription
+	}
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutUvarint(buf, v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(b, buf[:binary.PutVarint(buf, v)]...)
+}
+
+func readUvarint(b []byte) (v uint64, rest []byte, ok bool) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, b, false
+	}
+	return v, b[n:], true
+}
+
+func readVarint(b []byte) (v int64, rest []byte, ok bool) {
+	v, n := binary.Varint(b)
+	if n <= 0 {
+		return 0, b, false
+	}
+	return v, b[n:], true
+}
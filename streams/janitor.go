@@ -0,0 +1,158 @@
+package streams
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+// janitor executes functions after a delay, like clock.AfterFunc does. Instead
+// of starting one timer per function, it keeps all pending functions in a
+// heap ordered by their deadlines and only arms a single timer for the
+// earliest one. Thus, the cost of an idle StreamSupplier or Stream is a heap
+// entry rather than a runtime timer. A janitor is safe for concurrent use
+type janitor struct {
+	clock clock.Clock
+
+	// m guards all of the following fields
+	m     sync.Mutex
+	tasks taskHeap
+	timer clock.Timer
+	// armed is set, while timer is armed for the deadline next
+	armed bool
+	next  time.Time
+}
+
+// task is a function scheduled by a janitor
+type task struct {
+	janitor  *janitor
+	f        func()
+	deadline time.Time
+	// index is the task's position in the janitor's heap, or -1 if it isn't
+	// scheduled
+	index int
+}
+
+func newJanitor(c clock.Clock) *janitor {
+	return &janitor{clock: c}
+}
+
+// AfterFunc calls f after the duration d elapsed. All due tasks are run one
+// after another by the goroutine of the janitor's timer, so f shouldn't block.
+// The returned task can be stopped or reset like a clock.Timer
+func (j *janitor) AfterFunc(d time.Duration, f func()) *task {
+	t := &task{janitor: j, f: f, index: -1}
+	t.Reset(d)
+	return t
+}
+
+// Len returns the number of tasks, that have not been run yet
+func (j *janitor) Len() int {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return len(j.tasks)
+}
+
+// Stop prevents the task from running. It returns false, if the task has been
+// run or stopped already
+func (t *task) Stop() bool {
+	j := t.janitor
+	j.m.Lock()
+	defer j.m.Unlock()
+	if t.index < 0 {
+		return false
+	}
+	// the timer isn't disarmed, since waking up once without any due task is
+	// cheaper than resetting the timer on each Stop
+	heap.Remove(&j.tasks, t.index)
+	return true
+}
+
+// Reset changes the task to run after the duration d. It returns true, if the
+// task had been scheduled before
+func (t *task) Reset(d time.Duration) bool {
+	j := t.janitor
+	j.m.Lock()
+	defer j.m.Unlock()
+	active := t.index >= 0
+	t.deadline = j.clock.Now().Add(d)
+	if active {
+		heap.Fix(&j.tasks, t.index)
+	} else {
+		heap.Push(&j.tasks, t)
+	}
+	j.arm()
+	return active
+}
+
+// arm makes sure, the timer fires at the earliest deadline. j.m must be locked
+func (j *janitor) arm() {
+	if len(j.tasks) == 0 {
+		return
+	}
+	deadline := j.tasks[0].deadline
+	if j.armed && !deadline.Before(j.next) {
+		return
+	}
+	j.armed = true
+	j.next = deadline
+	d := deadline.Sub(j.clock.Now())
+	if j.timer == nil {
+		j.timer = j.clock.AfterFunc(d, j.run)
+		return
+	}
+	j.timer.Reset(d)
+}
+
+// run is called, when the timer fires. It runs all due tasks and re-arms the
+// timer for the remaining ones
+func (j *janitor) run() {
+	j.m.Lock()
+	j.armed = false
+	now := j.clock.Now()
+	var due []*task
+	for len(j.tasks) > 0 && !j.tasks[0].deadline.After(now) {
+		due = append(due, heap.Pop(&j.tasks).(*task))
+	}
+	j.arm()
+	j.m.Unlock()
+	// the tasks are run without holding j.m, since they may schedule or stop
+	// other tasks
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// taskHeap implements heap.Interface
+type taskHeap []*task
+
+func (h taskHeap) Len() int {
+	return len(h)
+}
+
+func (h taskHeap) Less(i, j int) bool {
+	return h[i].deadline.Before(h[j].deadline)
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*task)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,204 @@
+package streams
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestJanitorRunsInOrder(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Unix(0, 0))
+	j := newJanitor(c)
+	var ran []int
+	for _, i := range []int{3, 1, 2} {
+		i := i
+		j.AfterFunc(time.Duration(i)*time.Second, func() {
+			ran = append(ran, i)
+		})
+	}
+	// the janitor arms a single timer, no matter how many tasks it holds
+	assert.Equal(t, 1, c.Pending())
+	assert.Equal(t, 3, j.Len())
+
+	c.Advance(1500 * time.Millisecond)
+	assert.Equal(t, []int{1}, ran)
+	c.Advance(10 * time.Second)
+	assert.Equal(t, []int{1, 2, 3}, ran)
+	assert.Zero(t, j.Len())
+	assert.Zero(t, c.Pending())
+}
+
+func TestJanitorStopAndReset(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Unix(0, 0))
+	j := newJanitor(c)
+	var ran int
+	task := j.AfterFunc(time.Second, func() {
+		ran++
+	})
+	assert.True(t, task.Stop())
+	assert.False(t, task.Stop())
+	c.Advance(2 * time.Second)
+	assert.Zero(t, ran)
+
+	assert.False(t, task.Reset(time.Second))
+	c.Advance(900 * time.Millisecond)
+	// postpone the task
+	assert.True(t, task.Reset(time.Second))
+	c.Advance(900 * time.Millisecond)
+	assert.Zero(t, ran)
+	c.Advance(100 * time.Millisecond)
+	assert.Equal(t, 1, ran)
+
+	// bring a task forward, while another one is due later
+	j.AfterFunc(time.Hour, func() {})
+	task.Reset(time.Hour)
+	task.Reset(time.Second)
+	c.Advance(time.Second)
+	assert.Equal(t, 2, ran)
+	assert.Equal(t, 1, j.Len())
+}
+
+func TestJanitorTaskSchedulesTask(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Unix(0, 0))
+	j := newJanitor(c)
+	var ran int
+	j.AfterFunc(time.Second, func() {
+		j.AfterFunc(time.Second, func() {
+			ran++
+		})
+	})
+	c.Advance(2 * time.Second)
+	assert.Equal(t, 1, ran)
+}
+
+func TestJanitorRealClock(t *testing.T) {
+	t.Parallel()
+	j := newJanitor(clock.Real)
+	var wg sync.WaitGroup
+	var ran int32
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		j.AfterFunc(time.Duration(i)*time.Millisecond, func() {
+			atomic.AddInt32(&ran, 1)
+			wg.Done()
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(100), atomic.LoadInt32(&ran))
+	assert.Zero(t, j.Len())
+}
+
+// the benchmarks compare the janitor to the previous design, which started a
+// runtime timer for each StreamSupplier and Stream. Each iteration schedules a
+// timeout, resets it once (as Connect does) and stops it (as Disconnect does)
+
+func BenchmarkTimeoutsJanitor(b *testing.B) {
+	j := newJanitor(clock.Real)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			task := j.AfterFunc(time.Hour, func() {})
+			task.Reset(time.Hour)
+			task.Stop()
+		}
+	})
+}
+
+func BenchmarkTimeoutsTimerPerTask(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			timer := clock.Real.AfterFunc(time.Hour, func() {})
+			timer.Reset(time.Hour)
+			timer.Stop()
+		}
+	})
+}
+
+// BenchmarkIdleTimeouts* measure the cost of holding many pending timeouts,
+// i.e. many idle StreamSuppliers
+
+func BenchmarkIdleTimeoutsJanitor(b *testing.B) {
+	j := newJanitor(clock.Real)
+	tasks := make([]*task, b.N)
+	b.ResetTimer()
+	for i := range tasks {
+		tasks[i] = j.AfterFunc(time.Hour, func() {})
+	}
+	for _, task := range tasks {
+		task.Stop()
+	}
+}
+
+func BenchmarkIdleTimeoutsTimerPerTask(b *testing.B) {
+	timers := make([]clock.Timer, b.N)
+	b.ResetTimer()
+	for i := range timers {
+		timers[i] = clock.Real.AfterFunc(time.Hour, func() {})
+	}
+	for _, timer := range timers {
+		timer.Stop()
+	}
+}
+
+// lockedStreams is the previous, unsharded map of Streams, which is guarded by
+// a single lock
+type lockedStreams struct {
+	streams map[int64]*streamWrapper
+	m       sync.RWMutex
+}
+
+func BenchmarkStreamMapSharded(b *testing.B) {
+	r := NewRegistry()
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := atomic.AddInt64(&next, 1)
+			r.writeStream(id, &streamWrapper{id: id})
+			r.readStream(id)
+			r.takeStream(id)
+		}
+	})
+}
+
+func BenchmarkStreamMapLocked(b *testing.B) {
+	l := &lockedStreams{streams: make(map[int64]*streamWrapper)}
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := atomic.AddInt64(&next, 1)
+			l.m.Lock()
+			l.streams[id] = &streamWrapper{id: id}
+			l.m.Unlock()
+			l.m.RLock()
+			_ = l.streams[id]
+			l.m.RUnlock()
+			l.m.Lock()
+			delete(l.streams, id)
+			l.m.Unlock()
+		}
+	})
+}
+
+func BenchmarkRegisterAndOpen(b *testing.B) {
+	r := NewRegistry(WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour))
+	source := NewRandomCharStreamSource(charslice('a', 'b', 'c'))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id, err := r.Register(source)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sid, err := r.Open(id)
+			if err != nil {
+				b.Fatal(err)
+			}
+			r.Close(sid)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package streams
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrNoSuchStream is returned, if there is no Stream with the given id
+var ErrNoSuchStream = errors.New("there is no stream opened under the given id")
+
+// State is the lifecycle-state of a StreamSupplier or a Stream. The possible
+// transitions are:
+//
+//	Pending  -> Active   (the first connection was opened)
+//	Pending  -> Closed   (timeout)
+//	Active   -> Draining (timeout, while connections are still open)
+//	Active   -> Closed   (the last connection was closed)
+//	Draining -> Closed   (the last connection was closed)
+//
+// Streams are Pending, while they are opened and Active until they are Closed.
+// Closed is final
+type State int
+
+// states
+const (
+	Pending State = iota
+	Active
+	Draining
+	Closed
+)
+
+// StateError is returned, if an operation is not permitted in the current
+// State of the StreamSupplier or Stream with the given ID
+type StateError struct {
+	Op    string
+	ID    int64
+	State State
+}
+
+func (e *StateError) Error() string {
+	return "cannot " + e.Op + " " + strconv.FormatInt(e.ID, 10) + ": it is " + e.State.String()
+}
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Active:
+		return "active"
+	case Draining:
+		return "draining"
+	case Closed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
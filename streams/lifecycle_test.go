@@ -0,0 +1,138 @@
+package streams
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+// The following tests stress the lifecycle of StreamSuppliers and Streams.
+// They should be run with the -race flag
+
+func TestConcurrentOpenClose(t *testing.T) {
+	t.Parallel()
+	b := NewMemoryBackend().(*memoryBackend)
+	r := NewRegistry(WithBackend(b), WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Second))
+
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	// keep the supplier alive, until all workers are done
+	keepalive, err := r.Open(id)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				sid, err := r.Open(id)
+				assertLifecycleError(t, err)
+				if err != nil {
+					continue
+				}
+				// close concurrently from two sides
+				done := make(chan error)
+				go func() {
+					done <- r.Close(sid)
+				}()
+				err0, err1 := r.Close(sid), <-done
+				assert.True(t, err0 == nil || err1 == nil)
+				assertLifecycleError(t, err0)
+				assertLifecycleError(t, err1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, r.Close(keepalive))
+	_, err = r.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	assertEmpty(t, r, b)
+}
+
+func TestConcurrentTimeouts(t *testing.T) {
+	t.Parallel()
+	b := NewMemoryBackend().(*memoryBackend)
+	r := NewRegistry(WithBackend(b), WithSupplierTimeout(5*time.Millisecond), WithStreamTimeout(5*time.Millisecond))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				id, err := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+				assert.NoError(t, err)
+				for j := 0; j < 5; j++ {
+					time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+					sid, err := r.Open(id)
+					assertLifecycleError(t, err)
+					if err == nil && rand.Intn(2) == 0 {
+						assertLifecycleError(t, r.Close(sid))
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(50 * time.Millisecond)
+	assertEmpty(t, r, b)
+}
+
+func TestDrainingSupplierRefusesConnections(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	b := NewMemoryBackendWithClock(c).(*memoryBackend)
+	r := NewRegistry(WithBackend(b), WithClock(c), WithSupplierTimeout(20*time.Millisecond), WithStreamTimeout(50*time.Second))
+
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	c.Advance(20 * time.Millisecond)
+
+	_, err = r.Open(id)
+	var stateErr *StateError
+	assert.True(t, errors.As(err, &stateErr))
+	assert.Equal(t, Draining, stateErr.State)
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+
+	assert.NoError(t, r.Close(sid))
+	assert.Equal(t, ErrNoSuchStream, r.Close(sid))
+	_, err = r.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	assertEmpty(t, r, b)
+}
+
+// assertLifecycleError asserts, that err is nil or one of the errors
+// documented for lifecycle-operations
+func assertLifecycleError(t *testing.T, err error) {
+	var stateErr *StateError
+	if err != nil && err != ErrNoSuchSupplier && err != ErrNoSuchStream && !errors.As(err, &stateErr) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// assertEmpty asserts, that neither the given Backend nor Registry holds any
+// StreamSuppliers, Streams or pending timeouts
+func assertEmpty(t *testing.T, r *Registry, b *memoryBackend) {
+	n, _ := b.CountSuppliers()
+	assert.Zero(t, n)
+	assert.Zero(t, b.janitor.Len())
+	b.aliasm.RLock()
+	assert.Empty(t, b.codes)
+	b.aliasm.RUnlock()
+	b.strm.Lock()
+	assert.Empty(t, b.streams)
+	b.strm.Unlock()
+	r.eachStream(func(s *streamWrapper) {
+		t.Errorf("stream %d wasn't deleted", s.id)
+	})
+	assert.Zero(t, r.janitor.Len())
+}
@@ -0,0 +1,235 @@
+package streams
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Limits restrict the resources a Registry hands out. A limit of zero means
+// unlimited
+type Limits struct {
+	// Suppliers is the maximum number of StreamSuppliers registered in the
+	// Registry's Backend. It is a soft limit, i.e. concurrent registrations
+	// may exceed it slightly
+	Suppliers int
+	// Streams is the maximum number of Streams opened by the Registry
+	Streams int
+	// StreamsPerSupplier is the maximum number of Streams opened from a
+	// single StreamSupplier
+	StreamsPerSupplier int
+	// CharsetSize is the maximum size of a DescribedSource's charset
+	CharsetSize int
+	// ClientSuppliers is the maximum number of StreamSuppliers registered by
+	// a single client
+	ClientSuppliers int
+	// ClientStreams is the maximum number of Streams opened by a single
+	// client
+	ClientStreams int
+}
+
+// names of the limits as used in LimitErrors and metrics
+const (
+	LimitSuppliers          = "suppliers"
+	LimitStreams            = "streams"
+	LimitStreamsPerSupplier = "streams_per_supplier"
+	LimitCharsetSize        = "charset_size"
+	LimitClientSuppliers    = "client_suppliers"
+	LimitClientStreams      = "client_streams"
+)
+
+// LimitError is returned, if an operation would exceed one of the Registry's
+// Limits
+type LimitError struct {
+	// Limit is the name of the exceeded limit (e.g. LimitStreams)
+	Limit string
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return "limit exceeded: " + e.Limit + " is limited to " + strconv.Itoa(e.Max)
+}
+
+// WithLimits sets the Registry's Limits. By default, nothing is limited
+func WithLimits(l Limits) Option {
+	return func(r *Registry) {
+		r.limits = l
+	}
+}
+
+// quotas tracks the resources a Registry handed out
+type quotas struct {
+	m sync.Mutex
+	// streams is the number of Streams opened by the Registry
+	streams int
+	// clientStreams is the number of Streams opened by each client
+	clientStreams map[string]int
+	// clientSuppliers holds the ids of the StreamSuppliers registered by
+	// each client. Unregistered StreamSuppliers are removed lazily
+	clientSuppliers map[string]map[int64]bool
+	// added is the number of StreamSuppliers added to clientSuppliers
+	added int
+}
+
+// sweepInterval is the number of StreamSuppliers added to the clients' quotas,
+// after which all quotas are pruned
+const sweepInterval = 1024
+
+func newQuotas() *quotas {
+	return &quotas{
+		clientStreams:   make(map[string]int),
+		clientSuppliers: make(map[string]map[int64]bool),
+	}
+}
+
+// Limits returns the Registry's Limits
+func (r *Registry) Limits() Limits {
+	return r.limits
+}
+
+// CheckSource checks a StreamSource using the default Registry
+func CheckSource(source StreamSource) error {
+	return defaultRegistry.Load().CheckSource(source)
+}
+
+// CheckSource returns a *LimitError, if the given StreamSource exceeds the
+// Registry's Limits. Only DescribedSources can be checked
+func (r *Registry) CheckSource(source StreamSource) error {
+	d, ok := source.(DescribedSource)
+	if !ok {
+		return nil
+	}
+	max := r.Limits().CharsetSize
+	if max > 0 && len(d.Description().Charset) > max {
+		return exceeded(LimitCharsetSize, max)
+	}
+	return nil
+}
+
+// checkSuppliers returns a *LimitError, if the given client must not register
+// another StreamSupplier
+func (r *Registry) checkSuppliers(client string) error {
+	l := r.Limits()
+	if l.Suppliers > 0 {
+		n, err := r.backend.CountSuppliers()
+		if err != nil {
+			return err
+		}
+		if n >= l.Suppliers {
+			return exceeded(LimitSuppliers, l.Suppliers)
+		}
+	}
+	if l.ClientSuppliers <= 0 || client == "" {
+		return nil
+	}
+	if r.clientSuppliers(client) < l.ClientSuppliers {
+		return nil
+	}
+	// forget the StreamSuppliers, that were unregistered in the meantime
+	err := r.pruneSuppliers(client)
+	if err != nil {
+		return err
+	}
+	if r.clientSuppliers(client) >= l.ClientSuppliers {
+		return exceeded(LimitClientSuppliers, l.ClientSuppliers)
+	}
+	return nil
+}
+
+func (r *Registry) clientSuppliers(client string) int {
+	r.quotas.m.Lock()
+	defer r.quotas.m.Unlock()
+	return len(r.quotas.clientSuppliers[client])
+}
+
+// pruneSuppliers removes the StreamSuppliers, that are not registered anymore,
+// from the given clients' quotas
+func (r *Registry) pruneSuppliers(clients ...string) error {
+	for _, client := range clients {
+		r.quotas.m.Lock()
+		ids := make([]int64, 0, len(r.quotas.clientSuppliers[client]))
+		for id := range r.quotas.clientSuppliers[client] {
+			ids = append(ids, id)
+		}
+		r.quotas.m.Unlock()
+		for _, id := range ids {
+			_, ok, err := r.backend.ReadSupplier(id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+			r.quotas.m.Lock()
+			delete(r.quotas.clientSuppliers[client], id)
+			if len(r.quotas.clientSuppliers[client]) == 0 {
+				delete(r.quotas.clientSuppliers, client)
+			}
+			r.quotas.m.Unlock()
+		}
+	}
+	return nil
+}
+
+// addSupplier counts the StreamSupplier with the given id towards the given
+// client's quota. Every sweepInterval calls, the quotas of all clients are
+// pruned, so that clients, which don't come back, are forgotten eventually
+func (r *Registry) addSupplier(client string, id int64) {
+	if client == "" || r.Limits().ClientSuppliers <= 0 {
+		return
+	}
+	r.quotas.m.Lock()
+	if r.quotas.clientSuppliers[client] == nil {
+		r.quotas.clientSuppliers[client] = make(map[int64]bool)
+	}
+	r.quotas.clientSuppliers[client][id] = true
+	r.quotas.added++
+	if r.quotas.added%sweepInterval != 0 {
+		r.quotas.m.Unlock()
+		return
+	}
+	clients := make([]string, 0, len(r.quotas.clientSuppliers))
+	for c := range r.quotas.clientSuppliers {
+		clients = append(clients, c)
+	}
+	r.quotas.m.Unlock()
+	r.pruneSuppliers(clients...)
+}
+
+// acquireStream reserves a Stream for the given client. Each successful call
+// must be followed by a call to releaseStream
+func (r *Registry) acquireStream(client string) error {
+	l := r.Limits()
+	r.quotas.m.Lock()
+	defer r.quotas.m.Unlock()
+	if l.Streams > 0 && r.quotas.streams >= l.Streams {
+		return exceeded(LimitStreams, l.Streams)
+	}
+	if l.ClientStreams > 0 && client != "" && r.quotas.clientStreams[client] >= l.ClientStreams {
+		return exceeded(LimitClientStreams, l.ClientStreams)
+	}
+	r.quotas.streams++
+	if client != "" {
+		r.quotas.clientStreams[client]++
+	}
+	return nil
+}
+
+func (r *Registry) releaseStream(client string) {
+	r.quotas.m.Lock()
+	defer r.quotas.m.Unlock()
+	r.quotas.streams--
+	if client == "" {
+		return
+	}
+	r.quotas.clientStreams[client]--
+	if r.quotas.clientStreams[client] <= 0 {
+		delete(r.quotas.clientStreams, client)
+	}
+}
+
+// exceeded counts the violation of the given limit and returns the according
+// *LimitError
+func exceeded(limit string, max int) error {
+	limitsExceeded.Inc(limit)
+	return &LimitError{Limit: limit, Max: max}
+}
@@ -0,0 +1,119 @@
+package streams
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupplierLimit(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(
+		WithSupplierTimeout(50*time.Second),
+		WithStreamTimeout(50*time.Second),
+		WithLimits(Limits{Suppliers: 2}),
+	)
+	id, err := r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.NoError(t, err)
+	_, err = r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.NoError(t, err)
+	_, err = r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assertLimit(t, LimitSuppliers, err)
+
+	sid, _ := r.Open(id)
+	r.Close(sid)
+	_, err = r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.NoError(t, err)
+}
+
+func TestStreamLimits(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(
+		WithSupplierTimeout(50*time.Second),
+		WithStreamTimeout(50*time.Second),
+		WithLimits(Limits{Streams: 3, StreamsPerSupplier: 2}),
+	)
+	a, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	b, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	a0, err := r.Open(a)
+	assert.NoError(t, err)
+	_, err = r.Open(a)
+	assert.NoError(t, err)
+	_, err = r.Open(a)
+	assertLimit(t, LimitStreamsPerSupplier, err)
+	_, err = r.Open(b)
+	assert.NoError(t, err)
+	_, err = r.Open(b)
+	assertLimit(t, LimitStreams, err)
+
+	assert.NoError(t, r.Close(a0))
+	_, err = r.Open(b)
+	assert.NoError(t, err)
+}
+
+func TestClientQuotas(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(
+		WithSupplierTimeout(50*time.Second),
+		WithStreamTimeout(50*time.Second),
+		WithLimits(Limits{ClientSuppliers: 1, ClientStreams: 1}),
+	)
+	id, err := r.RegisterAs("alice", NewRandomCharStreamSource(charslice('a', 'b')), Timeouts{})
+	assert.NoError(t, err)
+	_, err = r.RegisterAs("alice", NewRandomCharStreamSource(charslice('a', 'b')), Timeouts{})
+	assertLimit(t, LimitClientSuppliers, err)
+	_, err = r.RegisterAs("bob", NewRandomCharStreamSource(charslice('a', 'b')), Timeouts{})
+	assert.NoError(t, err)
+
+	sid, err := r.OpenAs("alice", id)
+	assert.NoError(t, err)
+	_, err = r.OpenAs("alice", id)
+	assertLimit(t, LimitClientStreams, err)
+	keepalive, err := r.OpenAs("bob", id)
+	assert.NoError(t, err)
+
+	// closing the Stream frees alice's quota for Streams
+	assert.NoError(t, r.Close(sid))
+	sid, err = r.OpenAs("alice", id)
+	assert.NoError(t, err)
+
+	// unregistering the StreamSupplier frees alice's quota for StreamSuppliers
+	r.Close(sid)
+	r.Close(keepalive)
+	_, err = r.RegisterAs("alice", NewRandomCharStreamSource(charslice('a', 'b')), Timeouts{})
+	assert.NoError(t, err)
+}
+
+func TestCharsetSizeLimit(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithLimits(Limits{CharsetSize: 2}))
+	_, err := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	assertLimit(t, LimitCharsetSize, err)
+
+	token, _ := Token(NewRandomCharStreamSource(charslice('a', 'b', 'c')), Timeouts{}, testKey)
+	_, err = r.ResolveToken(token, testKey)
+	assertLimit(t, LimitCharsetSize, err)
+}
+
+func TestLimitsExceededMetric(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithLimits(Limits{CharsetSize: 1}))
+	before := exceededCount(LimitCharsetSize)
+	r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	r.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.True(t, exceededCount(LimitCharsetSize) >= before+2)
+}
+
+// assertLimit asserts, that err is a *LimitError for the given limit
+func assertLimit(t *testing.T, limit string, err error) {
+	var limitErr *LimitError
+	if assert.True(t, errors.As(err, &limitErr), "expected *LimitError, got %v", err) {
+		assert.Equal(t, limit, limitErr.Limit)
+	}
+}
+
+func exceededCount(limit string) float64 {
+	return limitsExceeded.Value(limit)
+}
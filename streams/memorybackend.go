@@ -0,0 +1,371 @@
+package streams
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+type memorySupplier struct {
+	SupplierRecord
+	id      int64
+	timeout time.Duration
+
+	// m guards all of the following fields
+	m           sync.Mutex
+	state       State
+	connections int
+	// deadline is the time, when the supplier times out
+	deadline time.Time
+	timer    *task
+}
+
+// supplierState is the state of a StreamSupplier as stored in a snapshot
+type supplierState struct {
+	id          int64
+	record      SupplierRecord
+	state       State
+	timeout     time.Duration
+	remaining   time.Duration
+	connections int
+}
+
+type memoryBackend struct {
+	suppliers [shardCount]supplierShard
+
+	codes  map[string]int64
+	tokens map[string]int64
+	aliasm sync.RWMutex
+
+	streams map[int64]int64
+	strm    sync.Mutex
+
+	clock   clock.Clock
+	janitor *janitor
+}
+
+// supplierShard holds the StreamSuppliers, whose ids belong to the shard
+type supplierShard struct {
+	suppliers map[int64]*memorySupplier
+	m         sync.RWMutex
+}
+
+// NewMemoryBackend returns a Backend, that keeps the registry's state in this
+// process' memory. Thus, it can't be shared with other processes, but it
+// supports any kind of StreamSource. A StreamSupplier, that times out while
+// connections are still open, is Draining, i.e. it refuses new connections
+// and is unregistered as soon as the last connection is closed
+func NewMemoryBackend() Backend {
+	return NewMemoryBackendWithClock(clock.Real)
+}
+
+// NewMemoryBackendWithClock works like NewMemoryBackend, but bases all
+// timeouts on the given Clock
+func NewMemoryBackendWithClock(c clock.Clock) Backend {
+	m := &memoryBackend{
+		codes:   make(map[string]int64),
+		tokens:  make(map[string]int64),
+		streams: make(map[int64]int64),
+	}
+	for i := range m.suppliers {
+		m.suppliers[i].suppliers = make(map[int64]*memorySupplier)
+	}
+	m.clock = c
+	m.janitor = newJanitor(c)
+	return m
+}
+
+func (m *memoryBackend) WriteSupplier(id int64, record SupplierRecord, timeout time.Duration) error {
+	return m.restore(supplierState{
+		id:        id,
+		record:    record,
+		state:     Pending,
+		timeout:   timeout,
+		remaining: timeout,
+	})
+}
+
+// restore registers a StreamSupplier in the given state. A Pending or Active
+// StreamSupplier starts Draining or is unregistered, if Connect isn't called
+// within state.remaining. A Draining StreamSupplier is unregistered, when its
+// last connection is closed
+func (m *memoryBackend) restore(state supplierState) error {
+	id, record := state.id, state.record
+	m.aliasm.Lock()
+	if _, taken := m.codes[record.Code]; taken {
+		m.aliasm.Unlock()
+		return ErrCodeTaken
+	}
+	if _, taken := m.tokens[record.Token]; taken && record.Token != "" {
+		m.aliasm.Unlock()
+		return ErrTokenTaken
+	}
+	m.codes[record.Code] = id
+	if record.Token != "" {
+		m.tokens[record.Token] = id
+	}
+	m.aliasm.Unlock()
+
+	s := &memorySupplier{
+		SupplierRecord: record,
+		id:             id,
+		timeout:        state.timeout,
+		state:          Pending,
+		connections:    state.connections,
+		deadline:       m.clock.Now().Add(state.remaining),
+	}
+	switch {
+	case s.connections > 0 && state.state == Draining:
+		s.state = Draining
+	case s.connections > 0:
+		s.state = Active
+	}
+	// the timer is started while s.m is locked, so that an instant timeout
+	// can't race with the registration
+	s.m.Lock()
+	shard := &m.suppliers[shardOf(id)]
+	shard.m.Lock()
+	shard.suppliers[id] = s
+	shard.m.Unlock()
+	s.timer = m.janitor.AfterFunc(state.remaining, func() {
+		m.expire(s)
+	})
+	s.m.Unlock()
+	return nil
+}
+
+// snapshot returns the state of all registered StreamSuppliers, that are not
+// Closed
+func (m *memoryBackend) snapshot() (states []supplierState) {
+	now := m.clock.Now()
+	for i := range m.suppliers {
+		shard := &m.suppliers[i]
+		shard.m.RLock()
+		for _, s := range shard.suppliers {
+			s.m.Lock()
+			if s.state != Closed {
+				states = append(states, supplierState{
+					id:          s.id,
+					record:      s.SupplierRecord,
+					state:       s.state,
+					timeout:     s.timeout,
+					remaining:   s.deadline.Sub(now),
+					connections: s.connections,
+				})
+			}
+			s.m.Unlock()
+		}
+		shard.m.RUnlock()
+	}
+	return
+}
+
+func (m *memoryBackend) ReadSupplier(id int64) (record SupplierRecord, ok bool, err error) {
+	s := m.readSupplier(id)
+	if s == nil {
+		return record, false, nil
+	}
+	return s.SupplierRecord, true, nil
+}
+
+func (m *memoryBackend) ReadCode(code string) (id int64, ok bool, err error) {
+	m.aliasm.RLock()
+	id, ok = m.codes[code]
+	m.aliasm.RUnlock()
+	return
+}
+
+func (m *memoryBackend) ReadToken(token string) (id int64, ok bool, err error) {
+	m.aliasm.RLock()
+	id, ok = m.tokens[token]
+	m.aliasm.RUnlock()
+	return
+}
+
+func (m *memoryBackend) ReadStatus(id int64) (status SupplierStatus, ok bool, err error) {
+	s := m.readSupplier(id)
+	if s == nil {
+		return status, false, nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	return SupplierStatus{
+		State:       s.state,
+		Connections: s.connections,
+		Expires:     s.deadline,
+	}, true, nil
+}
+
+func (m *memoryBackend) CountSuppliers() (n int, err error) {
+	for i := range m.suppliers {
+		shard := &m.suppliers[i]
+		shard.m.RLock()
+		n += len(shard.suppliers)
+		shard.m.RUnlock()
+	}
+	return
+}
+
+func (m *memoryBackend) ListSuppliers() (ids []int64, err error) {
+	for i := range m.suppliers {
+		shard := &m.suppliers[i]
+		shard.m.RLock()
+		for id := range shard.suppliers {
+			ids = append(ids, id)
+		}
+		shard.m.RUnlock()
+	}
+	return
+}
+
+// Connect returns a StateError, if the StreamSupplier is Draining or Closed
+func (m *memoryBackend) Connect(id int64, limit int) error {
+	s := m.readSupplier(id)
+	if s == nil {
+		return ErrNoSuchSupplier
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	switch s.state {
+	case Pending, Active:
+		if limit > 0 && s.connections >= limit {
+			return &LimitError{Limit: LimitStreamsPerSupplier, Max: limit}
+		}
+		s.state = Active
+		s.connections++
+		// reset timeout
+		s.deadline = m.clock.Now().Add(s.timeout)
+		s.timer.Reset(s.timeout)
+		return nil
+	default:
+		return &StateError{Op: "connect to", ID: id, State: s.state}
+	}
+}
+
+// KeepAlive returns a StateError, if the StreamSupplier is Draining or Closed
+func (m *memoryBackend) KeepAlive(id int64) error {
+	s := m.readSupplier(id)
+	if s == nil {
+		return ErrNoSuchSupplier
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	switch s.state {
+	case Pending, Active:
+		s.deadline = m.clock.Now().Add(s.timeout)
+		s.timer.Reset(s.timeout)
+		return nil
+	default:
+		return &StateError{Op: "keep alive", ID: id, State: s.state}
+	}
+}
+
+// DeleteSupplier closes the StreamSupplier in any State but Closed. Later calls
+// to Disconnect return ErrNoSuchSupplier
+func (m *memoryBackend) DeleteSupplier(id int64) error {
+	s := m.readSupplier(id)
+	if s == nil {
+		return ErrNoSuchSupplier
+	}
+	s.m.Lock()
+	if s.state == Closed {
+		s.m.Unlock()
+		return ErrNoSuchSupplier
+	}
+	s.state = Closed
+	s.timer.Stop()
+	s.m.Unlock()
+	m.deleteSupplier(s)
+	suppliersExpired.Inc(ExpiryDeleted)
+	return nil
+}
+
+// Disconnect returns a StateError, if the StreamSupplier has no connections
+func (m *memoryBackend) Disconnect(id int64) error {
+	s := m.readSupplier(id)
+	if s == nil {
+		return ErrNoSuchSupplier
+	}
+	s.m.Lock()
+	switch s.state {
+	case Active, Draining:
+		s.connections--
+		if s.connections > 0 {
+			s.m.Unlock()
+			return nil
+		}
+		s.state = Closed
+		s.timer.Stop()
+		s.m.Unlock()
+		m.deleteSupplier(s)
+		suppliersExpired.Inc(ExpiryClosed)
+		return nil
+	default:
+		s.m.Unlock()
+		return &StateError{Op: "disconnect from", ID: id, State: s.state}
+	}
+}
+
+// WriteStream ignores the timeout, since the Streams are closed by this process,
+// which calls DeleteStream then
+func (m *memoryBackend) WriteStream(id int64, supplierID int64, timeout time.Duration) error {
+	m.strm.Lock()
+	m.streams[id] = supplierID
+	m.strm.Unlock()
+	return nil
+}
+
+func (m *memoryBackend) DeleteStream(id int64) (supplierID int64, ok bool, err error) {
+	m.strm.Lock()
+	supplierID, ok = m.streams[id]
+	delete(m.streams, id)
+	m.strm.Unlock()
+	return
+}
+
+// expire is called, when the supplier's task is run by the janitor. Pending StreamSuppliers
+// are Closed, Active ones start Draining
+func (m *memoryBackend) expire(s *memorySupplier) {
+	s.m.Lock()
+	// the timer was reset, after it had fired already
+	if m.clock.Now().Before(s.deadline) {
+		s.m.Unlock()
+		return
+	}
+	switch s.state {
+	case Pending:
+		s.state = Closed
+		s.m.Unlock()
+		m.deleteSupplier(s)
+		suppliersExpired.Inc(ExpiryTimeout)
+		slog.Debug("stream supplier expired", "supplier_id", s.id)
+	case Active:
+		s.state = Draining
+		s.m.Unlock()
+	default:
+		s.m.Unlock()
+	}
+}
+
+func (m *memoryBackend) readSupplier(id int64) (supplier *memorySupplier) {
+	shard := &m.suppliers[shardOf(id)]
+	shard.m.RLock()
+	supplier = shard.suppliers[id]
+	shard.m.RUnlock()
+	return
+}
+
+func (m *memoryBackend) deleteSupplier(supplier *memorySupplier) {
+	shard := &m.suppliers[shardOf(supplier.id)]
+	shard.m.Lock()
+	delete(shard.suppliers, supplier.id)
+	shard.m.Unlock()
+	m.aliasm.Lock()
+	delete(m.codes, supplier.Code)
+	if supplier.Token != "" {
+		delete(m.tokens, supplier.Token)
+	}
+	m.aliasm.Unlock()
+}
@@ -0,0 +1,83 @@
+package streams
+
+import (
+	"github.com/theMomax/notypo-backend/metrics"
+)
+
+// reasons for unregistering a StreamSupplier as used in metrics
+const (
+	// ExpiryTimeout means, that no Stream was opened in time
+	ExpiryTimeout = "timeout"
+	// ExpiryClosed means, that the last Stream opened from it was closed
+	ExpiryClosed = "closed"
+	// ExpiryDeleted means, that it was unregistered explicitly
+	ExpiryDeleted = "deleted"
+)
+
+// UnknownSourceType is the type of StreamSources, that aren't DescribedSources,
+// as used in metrics
+const UnknownSourceType = "unknown"
+
+// metrics published in the Prometheus format. The counters cover all
+// Registries, the gauges the default Registry
+var (
+	suppliersCreated = metrics.NewCounter(
+		"notypo_suppliers_created_total",
+		"Number of registered stream suppliers by source type.",
+		"type",
+	)
+	suppliersExpired = metrics.NewCounter(
+		"notypo_suppliers_expired_total",
+		"Number of unregistered stream suppliers by reason (timeout, closed or deleted). Suppliers in a redis backend, that time out, are counted, when they are pruned.",
+		"reason",
+	)
+	limitsExceeded = metrics.NewCounter(
+		"notypo_limits_exceeded_total",
+		"Number of operations rejected by stream registries by exceeded limit (e.g. streams).",
+		"limit",
+	)
+	_ = metrics.NewGauge(
+		"notypo_suppliers",
+		"Number of registered stream suppliers by source type.",
+		func(set func(v float64, labelValues ...string)) {
+			infos, err := Suppliers()
+			if err != nil {
+				return
+			}
+			counts := make(map[string]int)
+			for _, info := range infos {
+				t := UnknownSourceType
+				if info.Description != nil {
+					t = info.Description.Type
+				}
+				counts[t]++
+			}
+			for t, n := range counts {
+				set(float64(n), t)
+			}
+		},
+		"type",
+	)
+	_ = metrics.NewGauge(
+		"notypo_streams",
+		"Number of streams opened by this process by source type.",
+		func(set func(v float64, labelValues ...string)) {
+			counts := make(map[string]int)
+			for _, info := range Streams() {
+				counts[info.Type]++
+			}
+			for t, n := range counts {
+				set(float64(n), t)
+			}
+		},
+		"type",
+	)
+)
+
+// sourceType returns the type of the given StreamSource as used in metrics
+func sourceType(source StreamSource) string {
+	if d, ok := source.(DescribedSource); ok {
+		return d.Description().Type
+	}
+	return UnknownSourceType
+}
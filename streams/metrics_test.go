@@ -0,0 +1,33 @@
+package streams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+// TestExpiryMetrics isn't parallel, since the counters are shared by all
+// Registries
+func TestExpiryMetrics(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(time.Minute), WithStreamTimeout(time.Hour))
+	created := suppliersCreated.Value(RandomSourceType)
+	timeout := suppliersExpired.Value(ExpiryTimeout)
+	closed := suppliersExpired.Value(ExpiryClosed)
+	deleted := suppliersExpired.Value(ExpiryDeleted)
+
+	r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	c.Advance(time.Minute)
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, _ := r.Open(id)
+	r.Close(sid)
+	id, _ = r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	r.Unregister(id)
+
+	assert.Equal(t, created+3, suppliersCreated.Value(RandomSourceType))
+	assert.Equal(t, timeout+1, suppliersExpired.Value(ExpiryTimeout))
+	assert.Equal(t, closed+1, suppliersExpired.Value(ExpiryClosed))
+	assert.Equal(t, deleted+1, suppliersExpired.Value(ExpiryDeleted))
+}
@@ -1,7 +1,9 @@
 package streams
 
 import (
+	"context"
 	"math/rand"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,41 +15,76 @@ type randomCharStreamSource struct {
 type basicUnregisteredCharStream struct {
 	channel chan Character
 	rand    *rand.Rand
-	done    chan bool
+	cancel  context.CancelFunc
+	// done is closed, when the generator has stopped and closed the channel
+	done chan struct{}
+	// position is the number of Characters piped into the channel. It must be
+	// accessed atomically
+	position uint64
 }
 
 // NewRandomCharStreamSource creates a StreamSource, which pipes the same
 // random sequence of Characters into each of its Instances. The Characters are
 // taken from the given charset. If the charset is nil or empty, nil is returned
 func NewRandomCharStreamSource(charset []Character) StreamSource {
+	return NewSeededRandomCharStreamSource(time.Now().UTC().UnixNano(), charset)
+}
+
+// NewSeededRandomCharStreamSource works like NewRandomCharStreamSource, but
+// uses the given seed. Thus, two StreamSources created with equal seeds and
+// charsets pipe the same sequence of Characters into their Instances
+func NewSeededRandomCharStreamSource(seed int64, charset []Character) StreamSource {
 	if charset == nil || len(charset) < 1 {
 		return nil
 	}
 	return &randomCharStreamSource{
-		seed:    time.Now().UTC().UnixNano(),
+		seed:    seed,
 		charset: charset,
 	}
 }
 
-func (r *randomCharStreamSource) Instance() UnregisteredStream {
+func (r *randomCharStreamSource) Description() SourceDescription {
+	charset := make([]rune, len(r.charset))
+	for i, c := range r.charset {
+		charset[i] = c.Rune()
+	}
+	return SourceDescription{
+		Type:    RandomSourceType,
+		Seed:    r.seed,
+		Charset: charset,
+	}
+}
+
+func (r *randomCharStreamSource) Instance(ctx context.Context) UnregisteredStream {
+	return r.InstanceAt(ctx, 0)
+}
+
+func (r *randomCharStreamSource) InstanceAt(ctx context.Context, position uint64) UnregisteredStream {
+	ctx, cancel := context.WithCancel(ctx)
 	b := &basicUnregisteredCharStream{
-		channel: make(chan Character),
-		rand:    rand.New(rand.NewSource(r.seed)),
-		done:    make(chan bool),
+		channel:  make(chan Character),
+		rand:     rand.New(rand.NewSource(r.seed)),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		position: position,
+	}
+	for i := uint64(0); i < position; i++ {
+		b.rand.Intn(len(r.charset))
 	}
-	// pipe random Characters into the channel, until Close() is called
+	// pipe random Characters into the channel, until ctx is done or Close() is
+	// called
 	go func() {
-	outer:
+		defer close(b.done)
+		defer close(b.channel)
 		for {
 			c := r.charset[b.rand.Intn(len(r.charset))]
 			select {
 			case b.channel <- c:
-			case <-b.done:
-				close(b.done)
-				break outer
+				atomic.AddUint64(&b.position, 1)
+			case <-ctx.Done():
+				return
 			}
 		}
-		close(b.channel)
 	}()
 	return b
 }
@@ -56,6 +93,13 @@ func (b *basicUnregisteredCharStream) Channel() <-chan Character {
 	return b.channel
 }
 
+func (b *basicUnregisteredCharStream) Position() uint64 {
+	return atomic.LoadUint64(&b.position)
+}
+
+// Close cancels the generator and waits until the channel is closed. It may be
+// called multiple times
 func (b *basicUnregisteredCharStream) Close() {
-	b.done <- true
+	b.cancel()
+	<-b.done
 }
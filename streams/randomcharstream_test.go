@@ -1,7 +1,9 @@
 package streams
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -10,7 +12,7 @@ type char rune
 
 func TestCloseFunction(t *testing.T) {
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	s := src.Instance()
+	s := src.Instance(context.Background())
 	c := s.Channel()
 	<-c
 	<-c
@@ -19,19 +21,34 @@ func TestCloseFunction(t *testing.T) {
 	s.Close()
 	_, ok := <-c
 	assert.False(t, ok)
+	// closing twice must neither block nor panic
+	s.Close()
+}
+
+func TestContextCancellation(t *testing.T) {
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	ctx, cancel := context.WithCancel(context.Background())
+	s := src.Instance(ctx)
+	c := s.Channel()
+	<-c
+	cancel()
+	select {
+	case <-consumed(c):
+	case <-time.After(time.Second):
+		t.Fatal("channel wasn't closed after the context was cancelled")
+	}
+	s.Close()
 }
 
 func TestEqualityOfInstances(t *testing.T) {
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	s0 := src.Instance()
-	s1 := src.Instance()
-	c0 := s0.Channel()
-	c1 := s1.Channel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c0 := src.Instance(ctx).Channel()
+	c1 := src.Instance(ctx).Channel()
 	for i := 0; i < 100; i++ {
 		assert.Equal(t, <-c0, <-c1)
 	}
-	s0.Close()
-	s1.Close()
 }
 
 // consume channels the given channel into a slice and returns it
@@ -45,6 +62,18 @@ func consume(c chan Character) (s []Character) {
 	}
 }
 
+// consumed drains the given channel and returns a channel, that is closed, once
+// the given channel is closed
+func consumed(c <-chan Character) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range c {
+		}
+		close(done)
+	}()
+	return done
+}
+
 func charslice(elements ...rune) (s []Character) {
 	s = make([]Character, len(elements))
 	for i, e := range elements {
@@ -0,0 +1,205 @@
+package streams
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redis client settings
+const (
+	redisPoolSize = 16
+	redisTimeout  = 5 * time.Second
+)
+
+// errRedisProtocol is returned, if the redis server sends a malformed reply
+var errRedisProtocol = errors.New("the redis server sent an invalid reply")
+
+// redisError is an error-reply sent by the redis server
+type redisError string
+
+// redisClient is a minimal client for the redis serialization protocol (RESP).
+// Replies are represented as string (simple and bulk strings), int64
+// (integers), []interface{} (arrays) and nil (null bulk strings and null
+// arrays). Error-replies are returned as redisError or, if part of an array,
+// stored as redisError in that array
+type redisClient struct {
+	address  string
+	password string
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newRedisClient(address, password string) *redisClient {
+	return &redisClient{
+		address:  address,
+		password: password,
+		pool:     make(chan *redisConn, redisPoolSize),
+	}
+}
+
+// do executes a single command on any connection
+func (c *redisClient) do(args ...string) (reply interface{}, err error) {
+	err = c.with(func(rc *redisConn) error {
+		reply, err = rc.do(args...)
+		return err
+	})
+	return
+}
+
+// with executes f on a single connection, which is not used by anyone else in
+// the meantime. Thus, f may use WATCH, MULTI and EXEC. If f returns a
+// redisError, the keys it WATCHed are released, before the connection is
+// reused
+func (c *redisClient) with(f func(rc *redisConn) error) error {
+	var rc *redisConn
+	select {
+	case rc = <-c.pool:
+	default:
+		conn, err := net.DialTimeout("tcp", c.address, redisTimeout)
+		if err != nil {
+			return err
+		}
+		rc = &redisConn{
+			conn: conn,
+			r:    bufio.NewReader(conn),
+			w:    bufio.NewWriter(conn),
+		}
+		if c.password != "" {
+			_, err = rc.do("AUTH", c.password)
+			if err != nil {
+				conn.Close()
+				return err
+			}
+		}
+	}
+	err := f(rc)
+	if _, ok := err.(redisError); err != nil && !ok {
+		// the connection's state is unknown
+		rc.conn.Close()
+		return err
+	}
+	if err != nil {
+		// f may have failed, while keys were WATCHed
+		_, uerr := rc.do("UNWATCH")
+		if uerr != nil {
+			rc.conn.Close()
+			return err
+		}
+	}
+	select {
+	case c.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+	return err
+}
+
+// do sends the given command and reads the reply
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(redisTimeout))
+	rc.w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		rc.w.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	err := rc.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// multi executes the given commands atomically using MULTI and EXEC. It
+// returns the replies of the commands or nil, if the transaction was aborted,
+// because a WATCHed key was modified
+func (rc *redisConn) multi(cmds ...[]string) ([]interface{}, error) {
+	_, err := rc.do("MULTI")
+	if err != nil {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		_, err = rc.do(cmd...)
+		if err != nil {
+			rc.do("DISCARD")
+			return nil, err
+		}
+	}
+	reply, err := rc.do("EXEC")
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	replies, ok := reply.([]interface{})
+	if !ok || len(replies) != len(cmds) {
+		return nil, errRedisProtocol
+	}
+	return replies, nil
+}
+
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisProtocol
+	}
+	t, line := line[0], line[1:len(line)-2]
+	switch t {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		i, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		return i, nil
+	case '$':
+		l, err := strconv.Atoi(line)
+		if err != nil || l < -1 {
+			return nil, errRedisProtocol
+		}
+		if l == -1 {
+			return nil, nil
+		}
+		b := make([]byte, l+2)
+		_, err = io.ReadFull(rc.r, b)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[:l]), nil
+	case '*':
+		l, err := strconv.Atoi(line)
+		if err != nil || l < -1 {
+			return nil, errRedisProtocol
+		}
+		if l == -1 {
+			return nil, nil
+		}
+		a := make([]interface{}, l)
+		for i := range a {
+			a[i], err = rc.read()
+			if e, ok := err.(redisError); ok {
+				a[i] = e
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	default:
+		return nil, errRedisProtocol
+	}
+}
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
@@ -0,0 +1,664 @@
+package streams
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+type redisBackend struct {
+	client *redisClient
+	prefix string
+	clock  clock.Clock
+}
+
+// redisRecord is the representation of a SupplierRecord stored in redis
+type redisRecord struct {
+	Description SourceDescription `json:"description"`
+	Code        string            `json:"code"`
+	Token       string            `json:"token,omitempty"`
+	Timeouts    Timeouts          `json:"timeouts"`
+	Created     time.Time         `json:"created"`
+	Timeout     time.Duration     `json:"timeout"`
+}
+
+// NewRedisBackend returns a Backend, that stores the registry's state in the
+// redis server at the given address. Thus, multiple processes can share the
+// same StreamSuppliers. All keys are prefixed with the given prefix. Timeouts
+// are implemented using redis' key-expiry. A StreamSupplier's keys expire at
+// its timeout or, if Streams were opened from it, when the last of them times
+// out. Thus, a StreamSupplier, that times out while connections are open, is
+// Draining as in the memory Backend, but the keys of processes, which crash,
+// don't leak. Additionally, the registered StreamSuppliers are indexed by the
+// expiry-time of their keys in a sorted set, so that they can be counted. The
+// Backend only supports DescribedSources. NewRedisBackend returns an error, if
+// the server can't be reached
+func NewRedisBackend(address, password, prefix string) (Backend, error) {
+	return NewRedisBackendWithClock(address, password, prefix, clock.Real)
+}
+
+// NewRedisBackendWithClock works like NewRedisBackend, but bases the
+// StreamSuppliers' expiry-times on the given Clock
+func NewRedisBackendWithClock(address, password, prefix string, c clock.Clock) (Backend, error) {
+	b := &redisBackend{
+		client: newRedisClient(address, password),
+		prefix: prefix,
+		clock:  c,
+	}
+	_, err := b.client.do("PING")
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *redisBackend) WriteSupplier(id int64, record SupplierRecord, timeout time.Duration) error {
+	d, ok := record.Source.(DescribedSource)
+	if !ok {
+		return ErrNotDescribable
+	}
+	payload, err := json.Marshal(redisRecord{
+		Description: d.Description(),
+		Code:        record.Code,
+		Token:       record.Token,
+		Timeouts:    record.Timeouts,
+		Created:     record.Created,
+		Timeout:     timeout,
+	})
+	if err != nil {
+		return err
+	}
+	ms := milliseconds(timeout)
+	sid := strconv.FormatInt(id, 10)
+	// aliases holds the keys of the share-code and the token. errsTaken holds
+	// the errors returned, if the respective key is taken
+	aliases := []string{b.codeKey(record.Code)}
+	errsTaken := []error{ErrCodeTaken}
+	if record.Token != "" {
+		aliases = append(aliases, b.tokenKey(record.Token))
+		errsTaken = append(errsTaken, ErrTokenTaken)
+	}
+	cmds := [][]string{
+		{"SET", b.supplierKey(id), string(payload), "PX", ms},
+		{"SET", b.deadlineKey(id), b.expiry(timeout), "PX", ms},
+		{"ZADD", b.suppliersKey(), b.expiry(timeout), sid},
+	}
+	for _, key := range aliases {
+		cmds = append(cmds, []string{"SET", key, sid, "PX", ms})
+	}
+	for {
+		var taken error
+		var replies []interface{}
+		err = b.client.with(func(rc *redisConn) error {
+			// optimistic locking: the transaction is aborted, if the
+			// share-code or token is taken by someone else in the meantime
+			_, err := rc.do(append([]string{"WATCH"}, aliases...)...)
+			if err != nil {
+				return err
+			}
+			for i, key := range aliases {
+				reply, err := rc.do("GET", key)
+				if err != nil {
+					return err
+				}
+				if reply != nil {
+					taken = errsTaken[i]
+					return unwatch(rc, nil)
+				}
+			}
+			replies, err = rc.multi(cmds...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if taken != nil {
+			return taken
+		}
+		if replies != nil {
+			return nil
+		}
+	}
+}
+
+func (b *redisBackend) ReadSupplier(id int64) (record SupplierRecord, ok bool, err error) {
+	r, ok, err := b.readRecord(id)
+	if err != nil || !ok {
+		return record, false, err
+	}
+	source, err := Rebuild(r.Description)
+	if err != nil {
+		return record, false, err
+	}
+	return SupplierRecord{
+		Source:   source,
+		Code:     r.Code,
+		Token:    r.Token,
+		Timeouts: r.Timeouts,
+		Created:  r.Created,
+	}, true, nil
+}
+
+func (b *redisBackend) ReadCode(code string) (id int64, ok bool, err error) {
+	return b.readID(b.codeKey(code))
+}
+
+func (b *redisBackend) ReadToken(token string) (id int64, ok bool, err error) {
+	return b.readID(b.tokenKey(token))
+}
+
+func (b *redisBackend) CountSuppliers() (n int, err error) {
+	var replies []interface{}
+	err = b.client.with(func(rc *redisConn) error {
+		replies, err = rc.multi(
+			[]string{"ZREMRANGEBYSCORE", b.suppliersKey(), "-inf", b.expiry(0)},
+			[]string{"ZCARD", b.suppliersKey()},
+		)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if replies == nil {
+		return 0, errRedisProtocol
+	}
+	pruned(replies[0])
+	count, ok := replies[1].(int64)
+	if !ok {
+		return 0, errRedisProtocol
+	}
+	return int(count), nil
+}
+
+func (b *redisBackend) ListSuppliers() (ids []int64, err error) {
+	var replies []interface{}
+	err = b.client.with(func(rc *redisConn) error {
+		replies, err = rc.multi(
+			[]string{"ZREMRANGEBYSCORE", b.suppliersKey(), "-inf", b.expiry(0)},
+			[]string{"ZRANGE", b.suppliersKey(), "0", "-1"},
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if replies == nil {
+		return nil, errRedisProtocol
+	}
+	pruned(replies[0])
+	members, ok := replies[1].([]interface{})
+	if !ok {
+		return nil, errRedisProtocol
+	}
+	for _, member := range members {
+		id, err := parseID(member)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// pruned counts the StreamSuppliers, that timed out, given the reply to
+// ZREMRANGEBYSCORE on the index
+func pruned(reply interface{}) {
+	if n, ok := reply.(int64); ok && n > 0 {
+		suppliersExpired.Add(float64(n), ExpiryTimeout)
+	}
+}
+
+func (b *redisBackend) Connect(id int64, limit int) error {
+	for {
+		var gone, limited, draining bool
+		var replies []interface{}
+		err := b.client.with(func(rc *redisConn) error {
+			// optimistic locking: the transaction is aborted, if the supplier
+			// or its connection-count is modified by someone else in the
+			// meantime, so that no connection is added to an expired supplier
+			s, ok, err := b.watch(rc, id)
+			if err != nil || !ok {
+				gone = err == nil
+				return err
+			}
+			now := b.clock.Now()
+			if s.state(now) == Draining {
+				draining = true
+				return unwatch(rc, nil)
+			}
+			if limit > 0 && s.connections >= int64(limit) {
+				limited = true
+				return unwatch(rc, nil)
+			}
+			deadline := now.Add(s.record.Timeout)
+			lease := later(s.lease, deadline)
+			replies, err = rc.multi(append(b.refresh(id, s, deadline, lease),
+				[]string{"INCR", b.connectionsKey(id)},
+				[]string{"PEXPIRE", b.connectionsKey(id), milliseconds(lease.Sub(now))},
+			)...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if gone {
+			return ErrNoSuchSupplier
+		}
+		if draining {
+			return &StateError{Op: "connect to", ID: id, State: Draining}
+		}
+		if limited {
+			return &LimitError{Limit: LimitStreamsPerSupplier, Max: limit}
+		}
+		if replies == nil {
+			continue
+		}
+		// the supplier expired, although it was WATCHed, which older redis
+		// servers permit
+		if replies[0] != int64(1) {
+			_, err = b.client.do("DEL", b.connectionsKey(id))
+			if err != nil {
+				return err
+			}
+			return ErrNoSuchSupplier
+		}
+		return nil
+	}
+}
+
+func (b *redisBackend) KeepAlive(id int64) error {
+	for {
+		var gone, draining bool
+		var replies []interface{}
+		err := b.client.with(func(rc *redisConn) error {
+			s, ok, err := b.watch(rc, id)
+			if err != nil || !ok {
+				gone = err == nil
+				return err
+			}
+			now := b.clock.Now()
+			if s.state(now) == Draining {
+				draining = true
+				return unwatch(rc, nil)
+			}
+			deadline := now.Add(s.record.Timeout)
+			replies, err = rc.multi(b.refresh(id, s, deadline, later(s.lease, deadline))...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if gone {
+			return ErrNoSuchSupplier
+		}
+		if draining {
+			return &StateError{Op: "keep alive", ID: id, State: Draining}
+		}
+		if replies == nil {
+			continue
+		}
+		if replies[0] != int64(1) {
+			return ErrNoSuchSupplier
+		}
+		return nil
+	}
+}
+
+// redisSupplier is the state of a StreamSupplier stored in redis
+type redisSupplier struct {
+	record      redisRecord
+	connections int64
+	// deadline is the time, when the StreamSupplier times out
+	deadline time.Time
+	// lease is the time, when the StreamSupplier's keys expire. It is later
+	// than the deadline, while Streams opened from it may still be open
+	lease time.Time
+}
+
+// state returns the StreamSupplier's State at the given time. Like in the
+// memory Backend, a StreamSupplier, that times out while connections are still
+// open, is Draining
+func (s *redisSupplier) state(now time.Time) State {
+	switch {
+	case s.connections == 0:
+		return Pending
+	case now.Before(s.deadline):
+		return Active
+	default:
+		return Draining
+	}
+}
+
+// watch WATCHes the keys of the StreamSupplier with the given id and reads its
+// state. If there is no such StreamSupplier, the keys are released again
+func (b *redisBackend) watch(rc *redisConn, id int64) (s redisSupplier, ok bool, err error) {
+	_, err = rc.do("WATCH", b.supplierKey(id), b.connectionsKey(id), b.deadlineKey(id))
+	if err != nil {
+		return s, false, err
+	}
+	s, ok, err = b.read(rc, id)
+	if err != nil || !ok {
+		return s, false, unwatch(rc, err)
+	}
+	return s, true, nil
+}
+
+// read reads the state of the StreamSupplier with the given id
+func (b *redisBackend) read(rc *redisConn, id int64) (s redisSupplier, ok bool, err error) {
+	reply, err := rc.do("GET", b.supplierKey(id))
+	if err != nil {
+		return s, false, err
+	}
+	s.record, ok, err = decodeRecord(reply)
+	if err != nil || !ok {
+		return s, false, err
+	}
+	reply, err = rc.do("GET", b.connectionsKey(id))
+	if err != nil {
+		return s, false, err
+	}
+	if reply != nil {
+		s.connections, err = parseID(reply)
+		if err != nil {
+			return s, false, err
+		}
+	}
+	reply, err = rc.do("GET", b.deadlineKey(id))
+	if err != nil || reply == nil {
+		return s, false, err
+	}
+	s.deadline, err = parseTime(reply)
+	if err != nil {
+		return s, false, err
+	}
+	reply, err = rc.do("ZSCORE", b.suppliersKey(), strconv.FormatInt(id, 10))
+	// the supplier expired since it was read
+	if err != nil || reply == nil {
+		return s, false, err
+	}
+	s.lease, err = parseTime(reply)
+	return s, err == nil, err
+}
+
+// refresh returns the commands, that set the deadline of the given supplier
+// and the expiry-time of its keys to the given lease. The first command's
+// reply is 1, if the supplier still exists
+func (b *redisBackend) refresh(id int64, s redisSupplier, deadline, lease time.Time) [][]string {
+	ms := milliseconds(lease.Sub(b.clock.Now()))
+	cmds := [][]string{
+		{"PEXPIRE", b.supplierKey(id), ms},
+		{"PEXPIRE", b.codeKey(s.record.Code), ms},
+		{"PEXPIRE", b.connectionsKey(id), ms},
+		{"SET", b.deadlineKey(id), formatTime(deadline), "PX", ms},
+		{"ZADD", b.suppliersKey(), "XX", formatTime(lease), strconv.FormatInt(id, 10)},
+	}
+	if s.record.Token != "" {
+		cmds = append(cmds, []string{"PEXPIRE", b.tokenKey(s.record.Token), ms})
+	}
+	return cmds
+}
+
+func (b *redisBackend) ReadStatus(id int64) (status SupplierStatus, ok bool, err error) {
+	var s redisSupplier
+	err = b.client.with(func(rc *redisConn) error {
+		s, ok, err = b.read(rc, id)
+		return err
+	})
+	if err != nil || !ok {
+		return status, false, err
+	}
+	return SupplierStatus{
+		State:       s.state(b.clock.Now()),
+		Connections: int(s.connections),
+		Expires:     s.deadline,
+	}, true, nil
+}
+
+func (b *redisBackend) DeleteSupplier(id int64) error {
+	r, ok, err := b.readRecord(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoSuchSupplier
+	}
+	var replies []interface{}
+	err = b.client.with(func(rc *redisConn) error {
+		replies, err = rc.multi(b.supplierKeys(id, r), []string{"ZREM", b.suppliersKey(), strconv.FormatInt(id, 10)})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the supplier expired or was deleted since it was read
+	if replies == nil || replies[1] != int64(1) {
+		return ErrNoSuchSupplier
+	}
+	suppliersExpired.Inc(ExpiryDeleted)
+	return nil
+}
+
+// supplierKeys returns a DEL command, that deletes all keys of the given
+// supplier
+func (b *redisBackend) supplierKeys(id int64, r redisRecord) []string {
+	keys := []string{"DEL", b.supplierKey(id), b.connectionsKey(id), b.deadlineKey(id), b.codeKey(r.Code)}
+	if r.Token != "" {
+		keys = append(keys, b.tokenKey(r.Token))
+	}
+	return keys
+}
+
+func (b *redisBackend) Disconnect(id int64) error {
+	for {
+		done := true
+		err := b.client.with(func(rc *redisConn) error {
+			// optimistic locking: the transaction is aborted, if the
+			// connection-count is modified by someone else in the meantime
+			_, err := rc.do("WATCH", b.connectionsKey(id))
+			if err != nil {
+				return err
+			}
+			reply, err := rc.do("GET", b.connectionsKey(id))
+			if err != nil {
+				return err
+			}
+			connections, err := parseID(reply)
+			if reply == nil || err != nil {
+				_, err = rc.do("UNWATCH")
+				return err
+			}
+			var replies []interface{}
+			last := connections <= 1
+			if !last {
+				replies, err = rc.multi([]string{"DECR", b.connectionsKey(id)})
+			} else {
+				reply, err = rc.do("GET", b.supplierKey(id))
+				if err != nil {
+					return err
+				}
+				keys := []string{"DEL", b.supplierKey(id), b.connectionsKey(id), b.deadlineKey(id)}
+				var r redisRecord
+				if s, ok := reply.(string); ok && json.Unmarshal([]byte(s), &r) == nil {
+					keys = b.supplierKeys(id, r)
+				}
+				replies, err = rc.multi(keys, []string{"ZREM", b.suppliersKey(), strconv.FormatInt(id, 10)})
+			}
+			done = replies != nil
+			if done && last && replies[1] == int64(1) {
+				suppliersExpired.Inc(ExpiryClosed)
+			}
+			return err
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// WriteStream extends the expiry-time of the supplier's keys, so that the
+// supplier is kept, as long as the Stream may be open
+func (b *redisBackend) WriteStream(id int64, supplierID int64, timeout time.Duration) error {
+	reference := []string{"SET", b.streamKey(id), strconv.FormatInt(supplierID, 10), "PX", milliseconds(timeout)}
+	for {
+		done := true
+		err := b.client.with(func(rc *redisConn) error {
+			s, ok, err := b.watch(rc, supplierID)
+			if err != nil {
+				return err
+			}
+			lease := b.clock.Now().Add(timeout)
+			if !ok || !lease.After(s.lease) {
+				if ok {
+					err = unwatch(rc, nil)
+				}
+				if err == nil {
+					_, err = rc.do(reference...)
+				}
+				return err
+			}
+			replies, err := rc.multi(append([][]string{reference}, b.refresh(supplierID, s, s.deadline, lease)...)...)
+			done = replies != nil
+			return err
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (b *redisBackend) DeleteStream(id int64) (supplierID int64, ok bool, err error) {
+	var replies []interface{}
+	err = b.client.with(func(rc *redisConn) error {
+		replies, err = rc.multi(
+			[]string{"GET", b.streamKey(id)},
+			[]string{"DEL", b.streamKey(id)},
+		)
+		return err
+	})
+	if err != nil || replies == nil || replies[0] == nil {
+		return 0, false, err
+	}
+	supplierID, err = parseID(replies[0])
+	return supplierID, err == nil, err
+}
+
+func (b *redisBackend) readRecord(id int64) (r redisRecord, ok bool, err error) {
+	reply, err := b.client.do("GET", b.supplierKey(id))
+	if err != nil {
+		return r, false, err
+	}
+	return decodeRecord(reply)
+}
+
+// decodeRecord decodes the reply to GET on a supplier's key
+func decodeRecord(reply interface{}) (r redisRecord, ok bool, err error) {
+	if reply == nil {
+		return r, false, nil
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return r, false, errRedisProtocol
+	}
+	err = json.Unmarshal([]byte(s), &r)
+	return r, err == nil, err
+}
+
+func (b *redisBackend) readID(key string) (id int64, ok bool, err error) {
+	reply, err := b.client.do("GET", key)
+	if err != nil || reply == nil {
+		return 0, false, err
+	}
+	id, err = parseID(reply)
+	return id, err == nil, err
+}
+
+func (b *redisBackend) supplierKey(id int64) string {
+	return b.prefix + "supplier:" + strconv.FormatInt(id, 10)
+}
+
+func (b *redisBackend) suppliersKey() string {
+	return b.prefix + "suppliers"
+}
+
+func (b *redisBackend) connectionsKey(id int64) string {
+	return b.prefix + "connections:" + strconv.FormatInt(id, 10)
+}
+
+func (b *redisBackend) deadlineKey(id int64) string {
+	return b.prefix + "deadline:" + strconv.FormatInt(id, 10)
+}
+
+func (b *redisBackend) streamKey(id int64) string {
+	return b.prefix + "stream:" + strconv.FormatInt(id, 10)
+}
+
+func (b *redisBackend) codeKey(code string) string {
+	return b.prefix + "code:" + code
+}
+
+func (b *redisBackend) tokenKey(token string) string {
+	return b.prefix + "token:" + token
+}
+
+// unwatch releases the keys WATCHed on the given connection and returns err
+func unwatch(rc *redisConn, err error) error {
+	_, uerr := rc.do("UNWATCH")
+	if err != nil {
+		return err
+	}
+	return uerr
+}
+
+func parseID(reply interface{}) (int64, error) {
+	s, ok := reply.(string)
+	if !ok {
+		return 0, errRedisProtocol
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// milliseconds formats the given duration as milliseconds. Since redis doesn't
+// accept expiry-times below one millisecond, those are rounded up
+func milliseconds(d time.Duration) string {
+	ms := int64(d / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+// expiry returns the unix-time in milliseconds, when a key expiring after d
+// expires. The time is taken from the Backend's Clock, i.e. it may differ
+// slightly from the redis server's clock
+func (b *redisBackend) expiry(d time.Duration) string {
+	return formatTime(b.clock.Now().Add(d))
+}
+
+// formatTime formats the given time as unix-time in milliseconds
+func formatTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// parseTime parses a unix-time in milliseconds as formatted by formatTime or
+// returned by ZSCORE
+func parseTime(reply interface{}) (time.Time, error) {
+	s, ok := reply.(string)
+	if !ok {
+		return time.Time{}, errRedisProtocol
+	}
+	ms, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, errRedisProtocol
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+}
+
+// later returns the later of the given times
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,609 @@
+package streams
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestRedisBackendSharesSuppliers(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	a, b := redisRegistry(t, r), redisRegistry(t, r)
+
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	id, err := a.Register(src)
+	assert.NoError(t, err)
+	code, ok := a.ShareCode(id)
+	assert.True(t, ok)
+	sid0, err := a.Open(id)
+	assert.NoError(t, err)
+
+	resolved, ok := b.Resolve(code)
+	assert.True(t, ok)
+	assert.Equal(t, id, resolved)
+	sid1, err := b.Open(id)
+	assert.NoError(t, err)
+	s, ok := b.Get(sid1)
+	assert.True(t, ok)
+	original := src.Instance(context.Background())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, (<-original.Channel()).Rune(), (<-s.Channel()).Rune())
+	}
+	original.Close()
+
+	a.Close(sid0)
+	sid2, err := a.Open(id)
+	assert.NoError(t, err)
+	b.Close(sid1)
+	a.Close(sid2)
+	_, err = b.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+}
+
+func TestRedisBackendUnregisterOnAllStreamsClosed(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	a, b := redisRegistry(t, r), redisRegistry(t, r)
+
+	id, _ := a.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	code, _ := a.ShareCode(id)
+	sid0, _ := a.Open(id)
+	sid1, _ := b.Open(id)
+	b.Close(sid1)
+	a.Close(sid0)
+
+	_, err := b.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	_, ok := b.Resolve(code)
+	assert.False(t, ok)
+}
+
+func TestRedisBackendUnregisterOnStreamSupplierTimeout(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	reg := redisRegistry(t, r, WithSupplierTimeout(50*time.Millisecond))
+
+	id, _ := reg.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	code, _ := reg.ShareCode(id)
+	r.clock.Advance(50 * time.Millisecond)
+	_, err := reg.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	_, ok := reg.Resolve(code)
+	assert.False(t, ok)
+	// no connection-count is left behind
+	r.m.Lock()
+	_, ok = r.values["test:connections:"+strconv.FormatInt(id, 10)]
+	r.m.Unlock()
+	assert.False(t, ok)
+}
+
+func TestRedisBackendTokens(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	a, b := redisRegistry(t, r), redisRegistry(t, r)
+
+	token, _ := Token(NewRandomCharStreamSource(charslice('a', 'b', 'c')), Timeouts{}, testKey)
+	id, err := a.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	again, err := b.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+}
+
+func TestRedisBackendSupplierOperations(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	a, b := redisRegistry(t, r), redisRegistry(t, r, WithSupplierTimeout(time.Minute))
+
+	id, _ := b.RegisterAs("", NewRandomCharStreamSource(charslice('a', 'b', 'c')), Timeouts{Idle: time.Minute})
+	sid, _ := a.Open(id)
+	info, err := b.Supplier(id)
+	assert.NoError(t, err)
+	assert.Equal(t, Active, info.State)
+	assert.Equal(t, 1, info.Connections)
+	assert.Equal(t, time.Minute, info.Timeouts.Idle)
+	assert.False(t, info.Created.IsZero())
+	assert.True(t, info.Expires.After(time.Now()))
+
+	r.clock.Advance(50 * time.Second)
+	assert.NoError(t, b.KeepAlive(id))
+	r.clock.Advance(50 * time.Second)
+	_, err = a.Supplier(id)
+	assert.NoError(t, err)
+
+	code, _ := a.ShareCode(id)
+	assert.NoError(t, b.Unregister(id))
+	_, err = a.Supplier(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	_, ok := a.Resolve(code)
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoSuchSupplier, b.Unregister(id))
+	assert.Equal(t, ErrNoSuchSupplier, a.KeepAlive(id))
+	// the Stream opened by the other Registry is still open
+	_, ok = a.Get(sid)
+	assert.True(t, ok)
+	a.Close(sid)
+}
+
+func TestRedisBackendListSuppliers(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	a, b := redisRegistry(t, r), redisRegistry(t, r, WithSupplierTimeout(time.Minute))
+
+	id0, _ := a.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	id1, _ := b.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	infos, err := a.Suppliers()
+	assert.NoError(t, err)
+	ids := make([]int64, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	assert.ElementsMatch(t, []int64{id0, id1}, ids)
+
+	r.clock.Advance(55 * time.Second)
+	infos, err = a.Suppliers()
+	assert.NoError(t, err)
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, id1, infos[0].ID)
+	}
+	// the index of expiry-times follows the same clock
+	n, err := a.backend.CountSuppliers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRedisBackendDrainingSupplierRefusesConnections(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	options := []Option{WithSupplierTimeout(time.Minute), WithStreamTimeout(time.Hour)}
+	a, b := redisRegistry(t, r, options...), redisRegistry(t, r, options...)
+
+	id, _ := a.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	code, _ := a.ShareCode(id)
+	sid, err := a.Open(id)
+	assert.NoError(t, err)
+	r.clock.Advance(time.Minute)
+
+	// the supplier outlives its timeout, while the stream is open
+	info, err := b.Supplier(id)
+	assert.NoError(t, err)
+	assert.Equal(t, Draining, info.State)
+	_, err = b.Open(id)
+	var stateErr *StateError
+	if assert.True(t, errors.As(err, &stateErr)) {
+		assert.Equal(t, Draining, stateErr.State)
+	}
+	assert.True(t, errors.As(b.KeepAlive(id), &stateErr))
+	resolved, ok := b.Resolve(code)
+	assert.True(t, ok)
+	assert.Equal(t, id, resolved)
+	_, ok = a.Get(sid)
+	assert.True(t, ok)
+
+	assert.NoError(t, a.Close(sid))
+	_, err = b.Supplier(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	_, ok = b.Resolve(code)
+	assert.False(t, ok)
+}
+
+func TestRedisBackendRequiresDescribedSource(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+
+	_, err := redisRegistry(t, r).Register(opaqueSource{})
+	assert.Equal(t, ErrNotDescribable, err)
+}
+
+func TestRedisBackendLimits(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	limits := WithLimits(Limits{Suppliers: 2, StreamsPerSupplier: 2})
+	a, b := redisRegistry(t, r, limits), redisRegistry(t, r, limits)
+
+	id, err := a.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.NoError(t, err)
+	_, err = b.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assert.NoError(t, err)
+	_, err = a.Register(NewRandomCharStreamSource(charslice('a', 'b')))
+	assertLimit(t, LimitSuppliers, err)
+
+	sid, err := a.Open(id)
+	assert.NoError(t, err)
+	_, err = b.Open(id)
+	assert.NoError(t, err)
+	_, err = b.Open(id)
+	assertLimit(t, LimitStreamsPerSupplier, err)
+	a.Close(sid)
+	_, err = b.Open(id)
+	assert.NoError(t, err)
+}
+
+func TestRedisBackendWriteSupplier(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	b, err := NewRedisBackendWithClock(r.Addr(), "", "test:", r.clock)
+	assert.NoError(t, err)
+	source := NewRandomCharStreamSource(charslice('a', 'b'))
+
+	assert.NoError(t, b.WriteSupplier(1, SupplierRecord{Source: source, Code: "a", Token: "t"}, time.Minute))
+	assert.Equal(t, ErrCodeTaken, b.WriteSupplier(2, SupplierRecord{Source: source, Code: "a"}, time.Minute))
+	assert.Equal(t, ErrTokenTaken, b.WriteSupplier(3, SupplierRecord{Source: source, Code: "b", Token: "t"}, time.Minute))
+	// nothing of the rejected suppliers is stored
+	for _, id := range []int64{2, 3} {
+		_, ok, err := b.ReadSupplier(id)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	}
+	_, ok, err := b.ReadCode("b")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	n, err := b.CountSuppliers()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRedisClientUnwatchesOnError(t *testing.T) {
+	t.Parallel()
+	r := newFakeRedis(t)
+	defer r.Close()
+	c := newRedisClient(r.Addr(), "")
+	c.with(func(rc *redisConn) error {
+		rc.do("WATCH", "key")
+		return redisError("ERR failed")
+	})
+	// the pooled connection must not watch the key anymore
+	_, err := newRedisClient(r.Addr(), "").do("SET", "key", "modified")
+	assert.NoError(t, err)
+	var replies []interface{}
+	assert.NoError(t, c.with(func(rc *redisConn) (err error) {
+		replies, err = rc.multi([]string{"SET", "key", "value"})
+		return
+	}))
+	assert.NotNil(t, replies)
+}
+
+type opaqueSource struct{}
+
+func (opaqueSource) Instance(ctx context.Context) UnregisteredStream {
+	return nil
+}
+
+// redisRegistry returns a Registry, that shares its state with all other
+// Registries connected to r. Its timeouts default to 50 seconds. The backend's
+// expiry-times are based on r's clock
+func redisRegistry(t *testing.T, r *fakeRedis, options ...Option) *Registry {
+	b, err := NewRedisBackendWithClock(r.Addr(), "", "test:", r.clock)
+	assert.NoError(t, err)
+	return NewRegistry(append([]Option{
+		WithBackend(b),
+		WithSupplierTimeout(50 * time.Second),
+		WithStreamTimeout(50 * time.Second),
+	}, options...)...)
+}
+
+// fakeRedis is an in-process stand-in for a redis server. It implements the
+// subset of commands used by the redis Backend. Keys expire by its Fake clock
+type fakeRedis struct {
+	listener net.Listener
+	clock    *clock.Fake
+	m        sync.Mutex
+	values   map[string]string
+	expiry   map[string]time.Time
+	zsets    map[string]map[string]float64
+	// versions is incremented on each modification of a key for WATCH
+	versions map[string]int64
+}
+
+type fakeRedisStatus string
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		listener: l,
+		clock:    clock.NewFake(time.Now()),
+		values:   make(map[string]string),
+		expiry:   make(map[string]time.Time),
+		zsets:    make(map[string]map[string]float64),
+		versions: make(map[string]int64),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) Close() {
+	f.listener.Close()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	watched := make(map[string]int64)
+	var queue [][]string
+	multi := false
+	for {
+		cmd, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(cmd[0])
+		var reply interface{}
+		switch {
+		case name == "MULTI":
+			multi = true
+			reply = fakeRedisStatus("OK")
+		case name == "DISCARD":
+			multi, queue, watched = false, nil, make(map[string]int64)
+			reply = fakeRedisStatus("OK")
+		case name == "EXEC":
+			f.m.Lock()
+			aborted := false
+			for k, v := range watched {
+				f.expire(k)
+				if f.versions[k] != v {
+					aborted = true
+				}
+			}
+			if aborted {
+				reply = []interface{}(nil)
+			} else {
+				replies := make([]interface{}, len(queue))
+				for i, c := range queue {
+					replies[i] = f.exec(c)
+				}
+				reply = replies
+			}
+			f.m.Unlock()
+			multi, queue, watched = false, nil, make(map[string]int64)
+		case multi:
+			queue = append(queue, cmd)
+			reply = fakeRedisStatus("QUEUED")
+		case name == "WATCH":
+			f.m.Lock()
+			for _, k := range cmd[1:] {
+				f.expire(k)
+				watched[k] = f.versions[k]
+			}
+			f.m.Unlock()
+			reply = fakeRedisStatus("OK")
+		case name == "UNWATCH":
+			watched = make(map[string]int64)
+			reply = fakeRedisStatus("OK")
+		default:
+			f.m.Lock()
+			reply = f.exec(cmd)
+			f.m.Unlock()
+		}
+		writeFakeRedisReply(w, reply)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// exec executes a single command. f.m must be locked
+func (f *fakeRedis) exec(cmd []string) interface{} {
+	for _, k := range cmd[1:] {
+		f.expire(k)
+	}
+	switch strings.ToUpper(cmd[0]) {
+	case "PING", "AUTH":
+		return fakeRedisStatus("OK")
+	case "GET":
+		v, ok := f.values[cmd[1]]
+		if !ok {
+			return nil
+		}
+		return v
+	case "SET":
+		var px time.Duration
+		for i := 3; i < len(cmd); i++ {
+			switch strings.ToUpper(cmd[i]) {
+			case "NX":
+				if _, ok := f.values[cmd[1]]; ok {
+					return nil
+				}
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(cmd[i])
+				px = time.Duration(ms) * time.Millisecond
+			}
+		}
+		f.set(cmd[1], cmd[2])
+		delete(f.expiry, cmd[1])
+		if px > 0 {
+			f.expiry[cmd[1]] = f.clock.Now().Add(px)
+		}
+		return fakeRedisStatus("OK")
+	case "DEL":
+		n := int64(0)
+		for _, k := range cmd[1:] {
+			if _, ok := f.values[k]; ok {
+				f.delete(k)
+				n++
+			}
+		}
+		return n
+	case "INCR", "DECR":
+		i, _ := strconv.ParseInt(f.values[cmd[1]], 10, 64)
+		if strings.ToUpper(cmd[0]) == "INCR" {
+			i++
+		} else {
+			i--
+		}
+		f.set(cmd[1], strconv.FormatInt(i, 10))
+		return i
+	case "ZADD":
+		xx := strings.ToUpper(cmd[2]) == "XX"
+		if xx {
+			cmd = append(cmd[:2], cmd[3:]...)
+		}
+		score, _ := strconv.ParseFloat(cmd[2], 64)
+		z := f.zsets[cmd[1]]
+		if z == nil {
+			z = make(map[string]float64)
+			f.zsets[cmd[1]] = z
+		}
+		_, exists := z[cmd[3]]
+		if xx && !exists {
+			return int64(0)
+		}
+		z[cmd[3]] = score
+		f.versions[cmd[1]]++
+		if exists {
+			return int64(0)
+		}
+		return int64(1)
+	case "ZREM":
+		if _, ok := f.zsets[cmd[1]][cmd[2]]; !ok {
+			return int64(0)
+		}
+		delete(f.zsets[cmd[1]], cmd[2])
+		f.versions[cmd[1]]++
+		return int64(1)
+	case "ZREMRANGEBYSCORE":
+		max, _ := strconv.ParseFloat(cmd[3], 64)
+		n := int64(0)
+		for m, score := range f.zsets[cmd[1]] {
+			if score <= max {
+				delete(f.zsets[cmd[1]], m)
+				n++
+			}
+		}
+		return n
+	case "ZSCORE":
+		score, ok := f.zsets[cmd[1]][cmd[2]]
+		if !ok {
+			return nil
+		}
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	case "ZRANGE":
+		members := make([]interface{}, 0, len(f.zsets[cmd[1]]))
+		for m := range f.zsets[cmd[1]] {
+			members = append(members, m)
+		}
+		return members
+	case "ZCARD":
+		return int64(len(f.zsets[cmd[1]]))
+	case "PEXPIRE":
+		if _, ok := f.values[cmd[1]]; !ok {
+			return int64(0)
+		}
+		ms, _ := strconv.Atoi(cmd[2])
+		f.expiry[cmd[1]] = f.clock.Now().Add(time.Duration(ms) * time.Millisecond)
+		f.versions[cmd[1]]++
+		return int64(1)
+	default:
+		return errFakeRedisUnknownCommand
+	}
+}
+
+var errFakeRedisUnknownCommand = redisError("ERR unknown command")
+
+func (f *fakeRedis) set(k, v string) {
+	f.values[k] = v
+	f.versions[k]++
+}
+
+func (f *fakeRedis) delete(k string) {
+	delete(f.values, k)
+	delete(f.expiry, k)
+	f.versions[k]++
+}
+
+// expire deletes the given key, if it is expired. f.m must be locked
+func (f *fakeRedis) expire(k string) {
+	if e, ok := f.expiry[k]; ok && !f.clock.Now().Before(e) {
+		f.delete(k)
+	}
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	cmd := make([]string, n)
+	for i := range cmd {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l+2)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, err
+		}
+		cmd[i] = string(b[:l])
+	}
+	return cmd, nil
+}
+
+func writeFakeRedisReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case fakeRedisStatus:
+		w.WriteString("+" + string(v) + "\r\n")
+	case redisError:
+		w.WriteString("-" + string(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []interface{}:
+		if v == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeFakeRedisReply(w, e)
+		}
+	}
+}
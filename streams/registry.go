@@ -0,0 +1,219 @@
+package streams
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/theMomax/notypo-backend/clock"
+	"github.com/theMomax/notypo-backend/config"
+)
+
+// Registry manages StreamSuppliers and the Streams opened from them. The
+// package-level functions operate on a default Registry, which is configured by
+// Setup. Independent Registries can be created with NewRegistry. All settings
+// are fixed, when the Registry is created. A Registry is safe for concurrent
+// use
+type Registry struct {
+	backend         Backend
+	supplierTimeout time.Duration
+	streamTimeout   time.Duration
+	idleTimeout     time.Duration
+	timeoutBounds   timeoutBounds
+	newID           func() int64
+	clock           clock.Clock
+	limits          Limits
+	quotas          *quotas
+	// janitor closes the Registry's Streams, when they time out
+	janitor *janitor
+	// drain is 1, if the Registry is in drain mode. It is accessed atomically
+	drain int32
+
+	// streams holds the Instances opened by this Registry. Their references
+	// to their StreamSupplier are stored in the Backend
+	streams [shardCount]streamShard
+}
+
+// shardCount is the number of shards, the maps of Streams and StreamSuppliers
+// are split into. Each shard has its own lock, so that concurrent operations
+// on different ids rarely contend
+const shardCount = 32
+
+// shardOf returns the index of the shard, that the given id belongs to
+func shardOf(id int64) int {
+	return int(uint64(id) % shardCount)
+}
+
+// streamShard holds the Streams, whose ids belong to the shard
+type streamShard struct {
+	streams map[int64]*streamWrapper
+	m       sync.RWMutex
+}
+
+// Option configures a Registry created by NewRegistry
+type Option func(*Registry)
+
+// WithBackend sets the Backend, which stores the Registry's state. By default,
+// each Registry uses its own memory-backend, which uses the Registry's Clock
+func WithBackend(b Backend) Option {
+	return func(r *Registry) {
+		r.backend = b
+	}
+}
+
+// default timeouts of a Registry
+const (
+	DefaultSupplierTimeout = time.Hour
+	DefaultStreamTimeout   = time.Hour
+)
+
+// WithSupplierTimeout sets the time, within which a registered StreamSupplier
+// has to be opened. By default, DefaultSupplierTimeout is used
+func WithSupplierTimeout(timeout time.Duration) Option {
+	return func(r *Registry) {
+		r.supplierTimeout = timeout
+	}
+}
+
+// WithStreamTimeout sets the time, after which an opened Stream is closed. By
+// default, DefaultStreamTimeout is used
+func WithStreamTimeout(timeout time.Duration) Option {
+	return func(r *Registry) {
+		r.streamTimeout = timeout
+	}
+}
+
+// WithIDGenerator sets the function, which generates the ids of
+// StreamSuppliers and Streams. It must be safe for concurrent use. By default,
+// random ids are generated
+func WithIDGenerator(newID func() int64) Option {
+	return func(r *Registry) {
+		r.newID = newID
+	}
+}
+
+// WithClock sets the Clock, which all of the Registry's timeouts are based on.
+// By default, clock.Real is used
+func WithClock(c clock.Clock) Option {
+	return func(r *Registry) {
+		r.clock = c
+	}
+}
+
+// WithConfig sets the Registry's timeouts, timeout bounds and Limits as
+// specified in config.StreamBase and config.Limits. The config is read, when
+// the Registry is created, so later changes don't affect the Registry. Options
+// following WithConfig override single settings
+func WithConfig() Option {
+	return func(r *Registry) {
+		if config.StreamBase != nil {
+			sb := config.StreamBase
+			r.supplierTimeout = sb.SupplierTimeout
+			r.streamTimeout = sb.StreamTimeout
+			r.idleTimeout = sb.IdleTimeout
+			r.timeoutBounds = timeoutBounds{
+				min: Timeouts{Lifetime: sb.MinStreamTimeout, Idle: sb.MinIdleTimeout},
+				max: Timeouts{Lifetime: sb.MaxStreamTimeout, Idle: sb.MaxIdleTimeout},
+			}
+		}
+		if config.Limits != nil {
+			r.limits = Limits{
+				Suppliers:          config.Limits.Suppliers,
+				Streams:            config.Limits.Streams,
+				StreamsPerSupplier: config.Limits.StreamsPerSupplier,
+				CharsetSize:        config.Limits.CharsetSize,
+				ClientSuppliers:    config.Limits.ClientSuppliers,
+				ClientStreams:      config.Limits.ClientStreams,
+			}
+		}
+	}
+}
+
+// NewRegistry creates a Registry configured by the given Options
+func NewRegistry(options ...Option) *Registry {
+	r := newRegistry(options...)
+	if r.backend == nil {
+		r.backend = NewMemoryBackendWithClock(r.clock)
+	}
+	return r
+}
+
+// newRegistry works like NewRegistry, but leaves the backend unset, unless
+// WithBackend is given
+func newRegistry(options ...Option) *Registry {
+	r := &Registry{
+		supplierTimeout: DefaultSupplierTimeout,
+		streamTimeout:   DefaultStreamTimeout,
+		newID:           rand.Int63,
+		clock:           clock.Real,
+		quotas:          newQuotas(),
+	}
+	for i := range r.streams {
+		r.streams[i].streams = make(map[int64]*streamWrapper)
+	}
+	for _, o := range options {
+		o(r)
+	}
+	r.janitor = newJanitor(r.clock)
+	return r
+}
+
+// defaultRegistry holds the Registry used by the package-level functions. It
+// is replaced as a whole by Setup
+var defaultRegistry atomic.Pointer[Registry]
+
+func init() {
+	rand.Seed(time.Now().UTC().UnixNano())
+	defaultRegistry.Store(NewRegistry())
+}
+
+// SupplierTimeout returns the time, within which a registered StreamSupplier
+// has to be opened
+func (r *Registry) SupplierTimeout() time.Duration {
+	return r.supplierTimeout
+}
+
+// StreamTimeout returns the time, after which an opened Stream is closed
+func (r *Registry) StreamTimeout() time.Duration {
+	return r.streamTimeout
+}
+
+func (r *Registry) readStream(id int64) (stream *streamWrapper, ok bool) {
+	shard := &r.streams[shardOf(id)]
+	shard.m.RLock()
+	stream, ok = shard.streams[id]
+	shard.m.RUnlock()
+	return
+}
+
+func (r *Registry) writeStream(id int64, stream *streamWrapper) {
+	shard := &r.streams[shardOf(id)]
+	shard.m.Lock()
+	shard.streams[id] = stream
+	shard.m.Unlock()
+}
+
+// eachStream calls f for each Stream opened by this Registry. f must not
+// modify the Registry's Streams
+func (r *Registry) eachStream(f func(*streamWrapper)) {
+	for i := range r.streams {
+		shard := &r.streams[i]
+		shard.m.RLock()
+		for _, s := range shard.streams {
+			f(s)
+		}
+		shard.m.RUnlock()
+	}
+}
+
+// takeStream deletes the Stream with the given id and returns it. Thus, only
+// one caller can obtain a specific Stream
+func (r *Registry) takeStream(id int64) (stream *streamWrapper, ok bool) {
+	shard := &r.streams[shardOf(id)]
+	shard.m.Lock()
+	stream, ok = shard.streams[id]
+	delete(shard.streams, id)
+	shard.m.Unlock()
+	return
+}
@@ -0,0 +1,53 @@
+package streams
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestIndependentRegistries(t *testing.T) {
+	t.Parallel()
+	a := NewRegistry(WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Second))
+	b := NewRegistry(WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Second))
+
+	id, err := a.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	assert.NoError(t, err)
+	code, _ := a.ShareCode(id)
+	_, ok := b.Resolve(code)
+	assert.False(t, ok)
+	_, err = b.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+
+	sid, err := a.Open(id)
+	assert.NoError(t, err)
+	_, ok = b.Get(sid)
+	assert.False(t, ok)
+	assert.Equal(t, ErrNoSuchStream, b.Close(sid))
+	assert.NoError(t, a.Close(sid))
+}
+
+func TestRegistryOptions(t *testing.T) {
+	t.Parallel()
+	var next int64
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(50*time.Second),
+		WithStreamTimeout(10*time.Millisecond),
+		WithIDGenerator(func() int64 {
+			return atomic.AddInt64(&next, 1)
+		}),
+	)
+
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	assert.Equal(t, int64(1), id)
+	sid, _ := r.Open(id)
+	assert.Equal(t, int64(2), sid)
+	c.Advance(10 * time.Millisecond)
+	_, ok := r.Get(sid)
+	assert.False(t, ok)
+}
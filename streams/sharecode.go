@@ -0,0 +1,85 @@
+package streams
+
+import (
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// shareCodeAttempts is the number of random share-codes, that are tried with a
+// certain amount of digits, before the amount of digits is increased
+const shareCodeAttempts = 16
+
+var shareCodeAdjectives = []string{
+	"able", "bold", "brave", "bright", "calm", "clever", "cool", "cosy",
+	"eager", "early", "fair", "fancy", "fast", "fine", "fluffy", "free",
+	"funny", "gentle", "glad", "golden", "good", "grand", "green", "happy",
+	"honest", "jolly", "kind", "lively", "lucky", "mellow", "merry", "mighty",
+	"neat", "nice", "noble", "polite", "proud", "quick", "quiet", "rapid",
+	"sharp", "shiny", "silly", "smart", "snowy", "sunny", "swift", "tidy",
+	"tiny", "wild", "wise", "witty", "young", "zesty",
+}
+
+var shareCodeAnimals = []string{
+	"badger", "bat", "bear", "beaver", "bee", "bison", "camel", "cat",
+	"crab", "crane", "crow", "deer", "dog", "dolphin", "duck", "eagle",
+	"ferret", "finch", "fox", "frog", "gecko", "goat", "goose", "hare",
+	"hawk", "hedgehog", "heron", "horse", "koala", "lemur", "lion", "llama",
+	"lynx", "moose", "mouse", "newt", "otter", "owl", "panda", "parrot",
+	"penguin", "pony", "rabbit", "raven", "robin", "seal", "sheep", "sloth",
+	"snail", "swan", "tiger", "turtle", "whale", "wolf", "yak", "zebra",
+}
+
+// Resolve resolves a share-code using the default Registry
+func Resolve(code string) (supplierID int64, ok bool) {
+	return defaultRegistry.Load().Resolve(code)
+}
+
+// Resolve returns the id of the StreamSupplier, that is registered under the
+// given share-code. Share-codes are case-insensitive. Resolve returns !ok, if
+// there is no such StreamSupplier
+func (r *Registry) Resolve(code string) (supplierID int64, ok bool) {
+	supplierID, ok, err := r.backend.ReadCode(normalizeShareCode(code))
+	if err != nil {
+		slog.Error("reading share-code failed", "error", err)
+	}
+	return
+}
+
+// ShareCode returns the share-code of a StreamSupplier registered with the
+// default Registry
+func ShareCode(supplierID int64) (code string, ok bool) {
+	return defaultRegistry.Load().ShareCode(supplierID)
+}
+
+// ShareCode returns the human-friendly share-code of the StreamSupplier with
+// the given id. ShareCode returns !ok, if there is no such StreamSupplier
+func (r *Registry) ShareCode(supplierID int64) (code string, ok bool) {
+	supl, ok, err := r.backend.ReadSupplier(supplierID)
+	if err != nil {
+		slog.Error("reading stream supplier failed", "supplier_id", supplierID, "error", err)
+	}
+	if !ok {
+		return "", false
+	}
+	return supl.Code, true
+}
+
+// generateShareCode returns a random share-code. It consists of two words and
+// a number (e.g. brave-otter-42). The range of the number grows with each
+// shareCodeAttempts attempts, so that a free share-code is found quickly, even
+// if many share-codes are in use
+func generateShareCode(attempt int) string {
+	digits := 100
+	for i := 0; i < attempt/shareCodeAttempts; i++ {
+		digits *= 10
+	}
+	return shareCodeAdjectives[rand.Intn(len(shareCodeAdjectives))] + "-" +
+		shareCodeAnimals[rand.Intn(len(shareCodeAnimals))] + "-" +
+		strconv.Itoa(rand.Intn(digits))
+}
+
+func normalizeShareCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -0,0 +1,275 @@
+package streams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errors
+var (
+	ErrNotPersistable  = errors.New("the registry backend doesn't support snapshots")
+	ErrInvalidSnapshot = errors.New("the given file is not a valid snapshot")
+)
+
+// snapshotVersion is the version of the snapshot-format written by
+// SaveSnapshot
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version   int                `json:"version"`
+	Created   time.Time          `json:"created"`
+	Suppliers []supplierSnapshot `json:"suppliers"`
+}
+
+type supplierSnapshot struct {
+	ID          int64             `json:"id"`
+	Code        string            `json:"code"`
+	Token       string            `json:"token,omitempty"`
+	Description SourceDescription `json:"description"`
+	Timeouts    Timeouts          `json:"timeouts"`
+	Created     time.Time         `json:"created"`
+	Timeout     time.Duration     `json:"timeout"`
+	Remaining   time.Duration     `json:"remaining"`
+	// Draining is set, if the StreamSupplier timed out, but its Streams are
+	// still open
+	Draining bool             `json:"draining,omitempty"`
+	Streams  []streamSnapshot `json:"streams,omitempty"`
+}
+
+type streamSnapshot struct {
+	ID        int64         `json:"id"`
+	Client    string        `json:"client,omitempty"`
+	Remaining time.Duration `json:"remaining"`
+	Position  uint64        `json:"position"`
+}
+
+// snapshotter is implemented by Backends, whose state is lost, when this
+// process exits
+type snapshotter interface {
+	// snapshot returns the state of all registered StreamSuppliers
+	snapshot() []supplierState
+	// restore registers a StreamSupplier in the given state
+	restore(state supplierState) error
+}
+
+// SaveSnapshot saves the state of the default Registry to the file at path
+func SaveSnapshot(path string, cursors bool) error {
+	return defaultRegistry.Load().SaveSnapshot(path, cursors)
+}
+
+// SaveSnapshot writes all registered StreamSuppliers and their remaining
+// timeouts to the file at path. If cursors is set, the Streams opened by this
+// Registry and their positions are included. Draining StreamSuppliers are only
+// saved together with their Streams. StreamSuppliers, that are not
+// DescribedSources, can't be saved and are skipped. ErrNotPersistable is
+// returned, if the Backend doesn't need to be persisted by this process
+func (r *Registry) SaveSnapshot(path string, cursors bool) error {
+	sn, ok := r.backend.(snapshotter)
+	if !ok {
+		return ErrNotPersistable
+	}
+	var opened map[int64][]streamSnapshot
+	if cursors {
+		opened = r.snapshotStreams()
+	}
+	s := snapshot{
+		Version: snapshotVersion,
+		Created: r.clock.Now().UTC(),
+	}
+	for _, state := range sn.snapshot() {
+		d, ok := state.record.Source.(DescribedSource)
+		draining := state.state == Draining || state.remaining <= 0
+		if !ok || (draining && len(opened[state.id]) == 0) {
+			continue
+		}
+		if draining {
+			state.remaining = 0
+		}
+		s.Suppliers = append(s.Suppliers, supplierSnapshot{
+			ID:          state.id,
+			Code:        state.record.Code,
+			Token:       state.record.Token,
+			Description: d.Description(),
+			Timeouts:    state.record.Timeouts,
+			Created:     state.record.Created,
+			Timeout:     state.timeout,
+			Remaining:   state.remaining,
+			Draining:    draining,
+			Streams:     opened[state.id],
+		})
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	// replace the old snapshot atomically
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// RestoreSnapshot restores the state of the default Registry from the file at
+// path
+func RestoreSnapshot(path string) error {
+	return defaultRegistry.Load().RestoreSnapshot(path)
+}
+
+// RestoreSnapshot registers the StreamSuppliers saved in the file at path. Their
+// timeouts continue with the remaining time saved in the snapshot, i.e. the
+// time this process wasn't running doesn't count. Streams are restored at
+// their saved positions, if the snapshot contains cursors. They count towards
+// the Registry's Limits like Streams opened by OpenAs. Draining
+// StreamSuppliers are restored as Draining. Nothing is restored, if there is
+// no file at path
+func (r *Registry) RestoreSnapshot(path string) error {
+	sn, ok := r.backend.(snapshotter)
+	if !ok {
+		return ErrNotPersistable
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var s snapshot
+	err = json.Unmarshal(b, &s)
+	if err != nil || s.Version != snapshotVersion {
+		return ErrInvalidSnapshot
+	}
+	for _, supl := range s.Suppliers {
+		source, err := Rebuild(supl.Description)
+		if err != nil {
+			slog.Warn("rebuilding stream supplier failed", "supplier_id", supl.ID, "error", err)
+			continue
+		}
+		resumable, ok := source.(ResumableSource)
+		if !ok {
+			supl.Streams = nil
+		}
+		state := Pending
+		if supl.Draining {
+			if len(supl.Streams) == 0 {
+				// there is nothing left to drain
+				continue
+			}
+			state = Draining
+		}
+		err = sn.restore(supplierState{
+			id: supl.ID,
+			record: SupplierRecord{
+				Source:   source,
+				Code:     supl.Code,
+				Token:    supl.Token,
+				Timeouts: supl.Timeouts,
+				Created:  supl.Created,
+			},
+			state:       state,
+			timeout:     supl.Timeout,
+			remaining:   supl.Remaining,
+			connections: len(supl.Streams),
+		})
+		if err != nil {
+			slog.Warn("restoring stream supplier failed", "supplier_id", supl.ID, "error", err)
+			continue
+		}
+		for _, strm := range supl.Streams {
+			r.restoreStream(resumable, supl.ID, supl.Timeouts, strm)
+		}
+	}
+	return nil
+}
+
+// PersistPeriodically periodically saves the state of the default Registry
+func PersistPeriodically(path string, interval time.Duration, cursors bool) (stop func()) {
+	return defaultRegistry.Load().PersistPeriodically(path, interval, cursors)
+}
+
+// PersistPeriodically calls SaveSnapshot every interval, until stop is called
+func (r *Registry) PersistPeriodically(path string, interval time.Duration, cursors bool) (stop func()) {
+	ticker := r.clock.NewTicker(interval)
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-ticker.C():
+				err := r.SaveSnapshot(path, cursors)
+				if err != nil {
+					slog.Error("saving snapshot failed", "path", path, "error", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// snapshotStreams returns the cursors of all Streams opened by this Registry,
+// grouped by their StreamSupplier's id
+func (r *Registry) snapshotStreams() map[int64][]streamSnapshot {
+	now := r.clock.Now()
+	opened := make(map[int64][]streamSnapshot)
+	r.eachStream(func(s *streamWrapper) {
+		p, ok := s.UnregisteredStream.(PositionedStream)
+		if !ok || !s.deadline.After(now) {
+			return
+		}
+		opened[s.supplierID] = append(opened[s.supplierID], streamSnapshot{
+			ID:        s.id,
+			Client:    s.client,
+			Remaining: s.deadline.Sub(now),
+			Position:  p.Position(),
+		})
+	})
+	return opened
+}
+
+// restoreStream reopens a Stream at its saved position. Its idle timeout starts
+// over. The StreamSupplier's connection, that was restored for the Stream, is
+// closed, if the Stream can't be restored
+func (r *Registry) restoreStream(source ResumableSource, supplierID int64, timeouts Timeouts, snapshot streamSnapshot) {
+	err := r.acquireStream(snapshot.Client)
+	if err != nil {
+		slog.Warn("restoring stream failed", "supplier_id", supplierID, "stream_id", snapshot.ID, "error", err)
+		r.backend.Disconnect(supplierID)
+		return
+	}
+	err = r.backend.WriteStream(snapshot.ID, supplierID, snapshot.Remaining)
+	if err != nil {
+		slog.Warn("restoring stream failed", "supplier_id", supplierID, "stream_id", snapshot.ID, "error", err)
+		r.backend.Disconnect(supplierID)
+		r.releaseStream(snapshot.Client)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.activate(&streamWrapper{
+		UnregisteredStream: source.InstanceAt(ctx, snapshot.Position),
+		id:                 snapshot.ID,
+		supplierID:         supplierID,
+		sourceType:         sourceType(source),
+		client:             snapshot.Client,
+		state:              Pending,
+		deadline:           r.clock.Now().Add(snapshot.Remaining),
+		idleTimeout:        r.timeouts(timeouts).Idle,
+		cancel:             cancel,
+	}, snapshot.Remaining)
+}
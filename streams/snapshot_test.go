@@ -0,0 +1,200 @@
+package streams
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestSnapshotRestoresSuppliers(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Second))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	id, _ := r.Register(src)
+	code, _ := r.ShareCode(id)
+	assert.NoError(t, r.SaveSnapshot(path, false))
+
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	resolved, ok := r.Resolve(code)
+	assert.True(t, ok)
+	assert.Equal(t, id, resolved)
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	s, _ := r.Get(sid)
+	original := src.Instance(context.Background())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, (<-original.Channel()).Rune(), (<-s.Channel()).Rune())
+	}
+	original.Close()
+	r.Close(sid)
+}
+
+func TestSnapshotRestoresCursors(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Second))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	id, _ := r.Register(src)
+	sid, _ := r.Open(id)
+	s, _ := r.Get(sid)
+	original := src.Instance(context.Background())
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, (<-original.Channel()).Rune(), (<-s.Channel()).Rune())
+	}
+	// the position is updated right after the Character was received
+	opened, _ := r.readStream(sid)
+	for opened.UnregisteredStream.(PositionedStream).Position() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, r.SaveSnapshot(path, true))
+
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	s, ok := r.Get(sid)
+	assert.True(t, ok)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, (<-original.Channel()).Rune(), (<-s.Channel()).Rune())
+	}
+	original.Close()
+
+	// the restored connection keeps the supplier alive
+	r.Close(sid)
+	time.Sleep(10 * time.Millisecond)
+	_, err := r.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+}
+
+func TestSnapshotRestoresRemainingTimeout(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(100*time.Millisecond), WithStreamTimeout(50*time.Second))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	c.Advance(60 * time.Millisecond)
+	assert.NoError(t, r.SaveSnapshot(path, false))
+
+	r = restart(r)
+	// the time, this process wasn't running, doesn't count
+	c.Advance(time.Hour)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	c.Advance(39 * time.Millisecond)
+	_, ok := r.ShareCode(id)
+	assert.True(t, ok)
+	c.Advance(time.Millisecond)
+	_, err := r.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+}
+
+func TestSnapshotRestoresDrainingSuppliers(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(100*time.Millisecond), WithStreamTimeout(50*time.Second))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	// without cursors, a Draining supplier has nothing left to drain
+	drained, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	r.Open(drained)
+	c.Advance(100 * time.Millisecond)
+	assert.NoError(t, r.SaveSnapshot(path, false))
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	_, ok, _ := r.backend.ReadStatus(drained)
+	assert.False(t, ok)
+
+	drained, _ = r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, _ := r.Open(drained)
+	c.Advance(100 * time.Millisecond)
+	assert.NoError(t, r.SaveSnapshot(path, true))
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	status, ok, _ := r.backend.ReadStatus(drained)
+	assert.True(t, ok)
+	assert.Equal(t, Draining, status.State)
+	assert.Equal(t, 1, status.Connections)
+	_, err := r.Open(drained)
+	var stateErr *StateError
+	assert.ErrorAs(t, err, &stateErr)
+	_, ok = r.Get(sid)
+	assert.True(t, ok)
+
+	// closing the restored Stream unregisters the supplier
+	r.Close(sid)
+	_, ok, _ = r.backend.ReadStatus(drained)
+	assert.False(t, ok)
+}
+
+func TestSnapshotRestoresQuotas(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithLimits(Limits{ClientStreams: 1}))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, err := r.OpenAs("client", id)
+	assert.NoError(t, err)
+	assert.NoError(t, r.SaveSnapshot(path, true))
+
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	other, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	_, err = r.OpenAs("client", other)
+	var limitErr *LimitError
+	assert.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, LimitClientStreams, limitErr.Limit)
+
+	// the restored Stream is released like an opened one
+	r.Close(sid)
+	sid, err = r.OpenAs("client", other)
+	assert.NoError(t, err)
+	r.Close(sid)
+}
+
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	t.Parallel()
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+	assert.NoError(t, NewRegistry().RestoreSnapshot(path))
+}
+
+func snapshotPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "snapshot.json")
+}
+
+// restart simulates a restart of this process by closing all Streams opened by
+// the given Registry without notifying its Backend. It returns a new Registry
+// with the same options, but a fresh Backend
+func restart(r *Registry) *Registry {
+	var ids []int64
+	r.eachStream(func(s *streamWrapper) {
+		ids = append(ids, s.id)
+	})
+	for _, id := range ids {
+		if s, ok := r.takeStream(id); ok {
+			s.close()
+		}
+	}
+	return NewRegistry(
+		WithClock(r.clock),
+		WithSupplierTimeout(r.supplierTimeout),
+		WithStreamTimeout(r.streamTimeout),
+		WithLimits(r.limits),
+	)
+}
@@ -1,18 +1,18 @@
 // Package streams contains the logic for managing and generating Streams. The
-// streambase.go file contains the rather generic management, while the other
-// files in this package contain implementations of StreamSources. A Stream is
-// a endless source of Characters, that automatically pipes those Characters
-// into a read-only channel
+// streambase.go and registry.go files contain the rather generic management,
+// while the other files in this package contain implementations of
+// StreamSources and Backends. A Stream is a endless source of Characters, that
+// automatically pipes those Characters into a read-only channel
 package streams
 
 import (
+	"context"
 	"errors"
-	"log"
-	"math/rand"
+	"log/slog"
 	"sync"
 	"time"
 
-	"github.com/theMomax/notypo-backend/config"
+	"github.com/theMomax/notypo-backend/clock"
 )
 
 // errors
@@ -30,8 +30,8 @@ type StreamSupplier interface {
 // StreamSource represents a source of Streams
 type StreamSource interface {
 	// Instance returns a Stream. Each Stream must generate the same output in
-	// the same order
-	Instance() UnregisteredStream
+	// the same order. The Stream is closed, when ctx is done
+	Instance(ctx context.Context) UnregisteredStream
 }
 
 // Stream is a wrapper for a registered channel of Characters. The
@@ -41,6 +41,22 @@ type Stream interface {
 	UnregisteredStream
 	// ID returns a unique identifier
 	ID() int64
+	// Deadline returns the time, when the Stream is closed, no matter its
+	// activity
+	Deadline() time.Time
+	// IdleTimeout returns the time, after which the Stream is closed, if
+	// Touch isn't called. Zero means, that the Stream doesn't time out due to
+	// inactivity
+	IdleTimeout() time.Duration
+	// IdleDeadline returns the time, when the Stream is closed, if Touch isn't
+	// called until then. It is the zero time, if IdleTimeout is zero
+	IdleDeadline() time.Time
+	// Touch records activity on the Stream, i.e. it postpones the
+	// IdleDeadline by IdleTimeout
+	Touch()
+	// Done returns a channel, that is closed, when the Stream is closed and
+	// its resources are released
+	Done() <-chan struct{}
 }
 
 // UnregisteredStream is a wrapper for a channel of Characters. The
@@ -49,205 +65,430 @@ type Stream interface {
 type UnregisteredStream interface {
 	// Channel returns the actual channel of Characters
 	Channel() <-chan Character
-	// Close closes Channel(). It may not panic, if called multiple times
+	// Close closes Channel() and releases all resources held by the Stream. It
+	// may not panic or block, if called multiple times
 	Close()
 }
 
+// ResumableSource is a StreamSource, whose Instances can start at any position
+// of the output
+type ResumableSource interface {
+	StreamSource
+	// InstanceAt returns an Instance, that skips the first position Characters
+	InstanceAt(ctx context.Context, position uint64) UnregisteredStream
+}
+
+// PositionedStream is an UnregisteredStream, that knows how many Characters
+// it piped into its Channel
+type PositionedStream interface {
+	UnregisteredStream
+	// Position returns the number of Characters piped into the Channel so far
+	Position() uint64
+}
+
 // Character is the required type for the input-streams
 type Character interface {
 	// Rune returns the character's utf-8 representation
 	Rune() rune
 }
 
-type streamSupplier struct {
-	StreamSource
-	id      int64
-	connect chan bool
-}
-
 type streamWrapper struct {
 	UnregisteredStream
 	id         int64
 	supplierID int64
+	// sourceType is the type of the StreamSupplier's StreamSource
+	sourceType string
+	// client is the client, whose quota the Stream counts towards
+	client string
+	// opened is the time, when the Stream was activated
+	opened time.Time
+	// deadline is the time, when the Stream is closed
+	deadline    time.Time
+	idleTimeout time.Duration
+	clock       clock.Clock
+	// cancel cancels the context of the Instance, so that its resources are
+	// released as soon as the registry drops the Stream
+	cancel context.CancelFunc
+	// done is closed, when the Stream is closed and the Instance is released
+	done chan struct{}
+
+	// m guards the following fields
+	m            sync.Mutex
+	state        State
+	timer        *task
+	idleDeadline time.Time
+	idleTimer    *task
 }
 
-var suppliers map[int64]*streamSupplier
-var suplm sync.RWMutex
+// Register registrates a StreamSource with the default Registry
+func Register(source StreamSource) (id int64, err error) {
+	return defaultRegistry.Load().Register(source)
+}
 
-var streams map[int64]*streamWrapper
-var strm sync.RWMutex
+// Register registrates a StreamSource, so that it is available via the returned
+// id as a StreamSupplier afterwards. Additionally, the StreamSupplier is
+// available via a human-friendly share-code (see ShareCode and Resolve). The
+// StreamSupplier is unregistered, when ether no Instance is requested from this
+// source within the Registry's SupplierTimeout, or at least one Instance has
+// been opened and all Instances were closed again since then. A *LimitError is
+// returned, if the Registry's Limits don't permit the registration. Any other
+// error is returned, if the Backend fails to store the StreamSource
+func (r *Registry) Register(source StreamSource) (id int64, err error) {
+	return r.RegisterAs("", source, Timeouts{})
+}
 
-func init() {
-	suppliers = make(map[int64]*streamSupplier)
-	suplm = sync.RWMutex{}
-	streams = make(map[int64]*streamWrapper)
-	strm = sync.RWMutex{}
-	rand.Seed(time.Now().UTC().UnixNano())
+// RegisterAs registrates a StreamSource on behalf of a client with the default
+// Registry
+func RegisterAs(client string, source StreamSource, timeouts Timeouts) (id int64, err error) {
+	return defaultRegistry.Load().RegisterAs(client, source, timeouts)
 }
 
-// Register registrates a StreamSource, so that it is available via the returned
-// id as a StreamSupplier afterwards. The StreamSupplier is unregistered, when
-// ether no Instance is requested from this source within
-// config.StreamBase.SupplierTimeout, or at least one Instance has been opened
-// and all Instances were closed again since then
-func Register(source StreamSource) (id int64) {
-	id = rand.Int63()
-	s := &streamSupplier{
-		StreamSource: source,
-		id:           id,
-		// controls deletion: true means and additional connection was openend,
-		// false means a connection was closed
-		connect: make(chan bool),
-	}
-	writeSupplier(id, s)
-	go manageUnregistration(s)
+// RegisterAs works like Register, but counts the StreamSupplier towards the
+// given client's quota and overrides the Registry's timeouts for the
+// StreamSupplier's Streams. An empty client has no quota. A *TimeoutError is
+// returned, if the Timeouts are out of the Registry's bounds. ErrDrainMode is
+// returned, if the Registry is in drain mode
+func (r *Registry) RegisterAs(client string, source StreamSource, timeouts Timeouts) (id int64, err error) {
+	if r.DrainMode() {
+		return 0, ErrDrainMode
+	}
+	err = r.CheckTimeouts(timeouts)
+	if err != nil {
+		return 0, err
+	}
+	err = r.CheckSource(source)
+	if err != nil {
+		return 0, err
+	}
+	err = r.checkSuppliers(client)
+	if err != nil {
+		return 0, err
+	}
+	id, err = r.register(source, "", timeouts)
+	if err == nil {
+		r.addSupplier(client, id)
+	}
 	return
 }
 
-// Open returns the id of a new Instance of the StreamSupplier with the given id
-// or returns an ErrNoSuchSupplier, if the id is invalid. The Stream is closed
-// at latest config.StreamBase.StreamTimeout after it was opened
-func Open(supplierID int64) (streamID int64, err error) {
-	defer func() {
-		err := recover()
-		if err != nil {
-			log.Println(err)
+// register stores the given StreamSource in the Backend without checking any
+// Limits or bounds. The given token may be empty
+func (r *Registry) register(source StreamSource, token string, timeouts Timeouts) (id int64, err error) {
+	for attempt := 0; ; attempt++ {
+		id = r.newID()
+		err = r.backend.WriteSupplier(id, SupplierRecord{
+			Source:   source,
+			Code:     generateShareCode(attempt),
+			Token:    token,
+			Timeouts: timeouts,
+			Created:  r.clock.Now(),
+		}, r.SupplierTimeout())
+		if err == nil {
+			suppliersCreated.Inc(sourceType(source))
+			slog.Debug("stream supplier registered", "supplier_id", id, "type", sourceType(source))
+		}
+		if err != ErrCodeTaken {
+			return
 		}
-	}()
-	supl := readSupplier(supplierID)
-	if supl == nil {
-		return 0, ErrNoSuchSupplier
 	}
-	streamID = rand.Int63()
-	s := &streamWrapper{
-		UnregisteredStream: supl.Instance(),
-		id:                 streamID,
-		supplierID:         supplierID,
+}
+
+// SupplierInfo describes a registered StreamSupplier
+type SupplierInfo struct {
+	SupplierStatus
+	ID   int64
+	Code string
+	// Description is nil, if the StreamSupplier isn't a DescribedSource
+	Description *SourceDescription
+	// Timeouts are the timeouts of the StreamSupplier's Streams, i.e. the
+	// StreamSupplier's Timeouts with the Registry's timeouts as defaults
+	Timeouts Timeouts
+	Created  time.Time
+	// Age is the time passed since the StreamSupplier was registered
+	Age time.Duration
+}
+
+// Supplier describes a StreamSupplier registered with the default Registry
+func Supplier(supplierID int64) (info SupplierInfo, err error) {
+	return defaultRegistry.Load().Supplier(supplierID)
+}
+
+// Supplier describes the StreamSupplier with the given id. It returns
+// ErrNoSuchSupplier, if the id is invalid
+func (r *Registry) Supplier(supplierID int64) (info SupplierInfo, err error) {
+	supl, ok, err := r.backend.ReadSupplier(supplierID)
+	if err != nil {
+		return info, err
+	}
+	if !ok {
+		return info, ErrNoSuchSupplier
+	}
+	status, ok, err := r.backend.ReadStatus(supplierID)
+	if err != nil {
+		return info, err
+	}
+	if !ok {
+		return info, ErrNoSuchSupplier
+	}
+	info = SupplierInfo{
+		SupplierStatus: status,
+		ID:             supplierID,
+		Code:           supl.Code,
+		Timeouts:       r.timeouts(supl.Timeouts),
+		Created:        supl.Created,
+		Age:            r.clock.Now().Sub(supl.Created),
 	}
-	writeStream(streamID, s)
-	// recover from send-to-closed-supl.connect-channel panic, in case the
-	// supplier was unregistered since the initial check
-	defer func() {
-		e := recover()
-		if e != nil {
-			err = ErrNoSuchSupplier
+	if d, ok := supl.Source.(DescribedSource); ok {
+		description := d.Description()
+		info.Description = &description
+	}
+	return info, nil
+}
+
+// KeepAlive postpones the timeout of a StreamSupplier registered with the
+// default Registry
+func KeepAlive(supplierID int64) error {
+	return defaultRegistry.Load().KeepAlive(supplierID)
+}
+
+// KeepAlive resets the timeout of the StreamSupplier with the given id, as if a
+// Stream was opened from it. It returns ErrNoSuchSupplier, if the id is invalid,
+// or a *StateError, if the StreamSupplier doesn't accept new connections
+func (r *Registry) KeepAlive(supplierID int64) error {
+	return r.backend.KeepAlive(supplierID)
+}
+
+// Unregister unregisters a StreamSupplier registered with the default Registry
+func Unregister(supplierID int64) error {
+	return defaultRegistry.Load().Unregister(supplierID)
+}
+
+// Unregister unregisters the StreamSupplier with the given id right away and
+// closes all Streams this Registry opened from it. Streams opened by other
+// processes sharing the same Backend are closed, when they time out. It returns
+// ErrNoSuchSupplier, if the id is invalid
+func (r *Registry) Unregister(supplierID int64) error {
+	err := r.backend.DeleteSupplier(supplierID)
+	if err != nil {
+		return err
+	}
+	var opened []int64
+	r.eachStream(func(s *streamWrapper) {
+		if s.supplierID == supplierID {
+			opened = append(opened, s.id)
 		}
-	}()
-	supl.connect <- true
-	// close on timeout
-	time.AfterFunc(config.StreamBase.StreamTimeout, func() {
-		Close(s.ID())
 	})
+	for _, id := range opened {
+		// the StreamSupplier is gone, so disconnecting from it fails
+		r.Close(id)
+	}
+	slog.Debug("stream supplier unregistered", "supplier_id", supplierID, "streams", len(opened))
+	return nil
+}
+
+// Open opens an Instance of a StreamSupplier registered with the default
+// Registry
+func Open(supplierID int64) (streamID int64, err error) {
+	return defaultRegistry.Load().Open(supplierID)
+}
+
+// Open returns the id of a new Instance of the StreamSupplier with the given id.
+// It returns ErrNoSuchSupplier, if the id is invalid, a *StateError, if the
+// StreamSupplier doesn't accept new connections, or a *LimitError, if the
+// Registry's Limits don't permit another Stream. The Stream is closed at latest
+// the Registry's StreamTimeout after it was opened, or earlier, if it isn't
+// touched within the Registry's IdleTimeout. The StreamSupplier's Timeouts
+// take precedence over the Registry's
+func (r *Registry) Open(supplierID int64) (streamID int64, err error) {
+	return r.OpenAs("", supplierID)
+}
+
+// OpenAs opens an Instance on behalf of a client with the default Registry
+func OpenAs(client string, supplierID int64) (streamID int64, err error) {
+	return defaultRegistry.Load().OpenAs(client, supplierID)
+}
+
+// OpenAs works like Open, but counts the Stream towards the given client's
+// quota until it is closed. An empty client has no quota
+func (r *Registry) OpenAs(client string, supplierID int64) (streamID int64, err error) {
+	supl, ok, err := r.backend.ReadSupplier(supplierID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrNoSuchSupplier
+	}
+	err = r.acquireStream(client)
+	if err != nil {
+		return 0, err
+	}
+	err = r.backend.Connect(supplierID, r.Limits().StreamsPerSupplier)
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		limitsExceeded.Inc(limitErr.Limit)
+	}
+	if err != nil {
+		r.releaseStream(client)
+		return 0, err
+	}
+	streamID = r.newID()
+	timeouts := r.timeouts(supl.Timeouts)
+	err = r.backend.WriteStream(streamID, supplierID, timeouts.Lifetime)
+	if err != nil {
+		r.backend.Disconnect(supplierID)
+		r.releaseStream(client)
+		return 0, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.activate(&streamWrapper{
+		UnregisteredStream: supl.Source.Instance(ctx),
+		id:                 streamID,
+		supplierID:         supplierID,
+		sourceType:         sourceType(supl.Source),
+		client:             client,
+		deadline:           r.clock.Now().Add(timeouts.Lifetime),
+		idleTimeout:        timeouts.Idle,
+		cancel:             cancel,
+		state:              Pending,
+	}, timeouts.Lifetime)
+	slog.Debug("stream opened", "stream_id", streamID, "supplier_id", supplierID, "client", client)
 	return
 }
 
-// Get returns the Stream with the given id. Get returns !ok if there is
-// no such stream
+// Get returns a Stream opened by the default Registry
 func Get(streamID int64) (stream Stream, ok bool) {
-	defer func() {
-		err := recover()
-		if err != nil {
-			log.Println(err)
-		}
-	}()
-	return readStream(streamID)
+	return defaultRegistry.Load().Get(streamID)
+}
+
+// Get returns the Stream with the given id. Get returns !ok if there is
+// no such Active Stream opened by this Registry
+func (r *Registry) Get(streamID int64) (stream Stream, ok bool) {
+	s, ok := r.readStream(streamID)
+	if !ok || s.State() != Active {
+		return nil, false
+	}
+	return s, true
 }
 
-// Close closes and deletes the Stream with the given id
-func Close(streamID int64) {
-	defer func() {
-		err := recover()
+// Close closes a Stream opened by the default Registry
+func Close(streamID int64) error {
+	return defaultRegistry.Load().Close(streamID)
+}
+
+// Close closes and deletes the Stream with the given id. If the Stream was
+// opened by another process sharing the same Backend, only the reference to its
+// StreamSupplier is deleted. ErrNoSuchStream is returned, if there is no such
+// Stream
+func (r *Registry) Close(streamID int64) error {
+	s, opened := r.takeStream(streamID)
+	if opened {
+		err := s.close()
 		if err != nil {
-			log.Println(err)
+			return err
 		}
-	}()
-	s, ok := readStream(streamID)
-	if ok && s != nil {
-		su := readSupplier(s.supplierID)
-		if su != nil {
-			su.connect <- false
+		r.releaseStream(s.client)
+		slog.Debug("stream closed", "stream_id", streamID, "supplier_id", s.supplierID)
+	}
+	supplierID, ok, err := r.backend.DeleteStream(streamID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if opened {
+			return nil
 		}
-		s.Close()
-		deleteStream(streamID)
+		return ErrNoSuchStream
 	}
+	return r.backend.Disconnect(supplierID)
 }
 
-func manageUnregistration(supplier *streamSupplier) {
-	defer func() {
-		err := recover()
-		if err != nil {
-			log.Println(err)
-		}
-	}()
-	connections := 0
-	timeout := time.After(config.StreamBase.SupplierTimeout)
-	for {
-		select {
-		case <-timeout:
-			close(supplier.connect)
-			deleteSupplier(supplier.ID())
-			return
-		case c := <-supplier.connect:
-			if c {
-				connections++
-				// reset timeout
-				timeout = time.After(config.StreamBase.SupplierTimeout)
-			} else {
-				connections--
-				if connections == 0 {
-					close(supplier.connect)
-					deleteSupplier(supplier.ID())
-					return
-				}
+// activate makes the given Pending Stream available via Get and closes it after
+// the given timeout, or after its idleTimeout, if it isn't touched
+func (r *Registry) activate(s *streamWrapper, timeout time.Duration) {
+	s.clock = r.clock
+	s.opened = r.clock.Now()
+	s.done = make(chan struct{})
+	s.m.Lock()
+	r.writeStream(s.id, s)
+	s.state = Active
+	s.timer = r.janitor.AfterFunc(timeout, func() {
+		r.Close(s.id)
+	})
+	if s.idleTimeout > 0 {
+		s.idleDeadline = r.clock.Now().Add(s.idleTimeout)
+		s.idleTimer = r.janitor.AfterFunc(s.idleTimeout, func() {
+			if s.idle() {
+				r.Close(s.id)
 			}
-		}
+		})
 	}
+	s.m.Unlock()
 }
 
-func readSupplier(id int64) (supplier *streamSupplier) {
-	suplm.RLock()
-	supplier = suppliers[id]
-	suplm.RUnlock()
-	return
+// close transitions the Stream to Closed and closes the underlying
+// UnregisteredStream. It returns a *StateError, if the Stream is Closed already
+func (s *streamWrapper) close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.state == Closed {
+		return &StateError{Op: "close", ID: s.id, State: s.state}
+	}
+	s.state = Closed
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+	}
+	s.cancel()
+	s.UnregisteredStream.Close()
+	close(s.done)
+	return nil
 }
 
-func writeSupplier(id int64, supplier *streamSupplier) {
-	suplm.Lock()
-	suppliers[id] = supplier
-	suplm.Unlock()
-	return
+// State returns the Stream's current State
+func (s *streamWrapper) State() State {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.state
 }
 
-func deleteSupplier(id int64) {
-	suplm.Lock()
-	delete(suppliers, id)
-	suplm.Unlock()
+func (s *streamWrapper) ID() int64 {
+	return s.id
 }
 
-func readStream(id int64) (stream *streamWrapper, ok bool) {
-	strm.RLock()
-	stream, ok = streams[id]
-	strm.RUnlock()
-	return
+func (s *streamWrapper) Deadline() time.Time {
+	return s.deadline
 }
 
-func writeStream(id int64, stream *streamWrapper) {
-	strm.Lock()
-	streams[id] = stream
-	strm.Unlock()
-	return
+func (s *streamWrapper) IdleTimeout() time.Duration {
+	return s.idleTimeout
 }
 
-func deleteStream(id int64) {
-	strm.Lock()
-	delete(streams, id)
-	strm.Unlock()
+func (s *streamWrapper) IdleDeadline() time.Time {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.idleDeadline
 }
 
-func (s *streamSupplier) ID() int64 {
-	return s.id
+func (s *streamWrapper) Touch() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.state != Active || s.idleTimer == nil {
+		return
+	}
+	s.idleDeadline = s.clock.Now().Add(s.idleTimeout)
+	s.idleTimer.Reset(s.idleTimeout)
 }
 
-func (s *streamWrapper) ID() int64 {
-	return s.id
+func (s *streamWrapper) Done() <-chan struct{} {
+	return s.done
+}
+
+// idle returns true, if the Stream's idleDeadline has passed, i.e. it wasn't
+// touched after its idleTimer had fired
+func (s *streamWrapper) idle() bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return !s.clock.Now().Before(s.idleDeadline)
 }
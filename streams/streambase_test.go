@@ -1,10 +1,12 @@
 package streams
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
 	"github.com/theMomax/notypo-backend/config"
 )
 
@@ -15,20 +17,25 @@ func init() {
 }
 
 func TestUnregisterOnStreamSupplierTimeout(t *testing.T) {
-	config.StreamBase.SupplierTimeout = 50 * time.Millisecond
-	config.StreamBase.StreamTimeout = 50 * time.Second
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(50*time.Millisecond), WithStreamTimeout(50*time.Second))
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	id := Register(src)
-	time.Sleep(60 * time.Millisecond)
-	_, err := Open(id)
+	id, _ := r.Register(src)
+	c.Advance(49 * time.Millisecond)
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	r.Close(sid)
+
+	id, _ = r.Register(src)
+	c.Advance(50 * time.Millisecond)
+	_, err = r.Open(id)
 	assert.Equal(t, ErrNoSuchSupplier, err)
 }
 
 func TestUnregisterOnAllStreamsClosed(t *testing.T) {
-	config.StreamBase.SupplierTimeout = 50 * time.Second
-	config.StreamBase.StreamTimeout = 50 * time.Second
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	id := Register(src)
+	id, _ := Register(src)
 	sid, _ := Open(id)
 	Close(sid)
 	_, err := Open(id)
@@ -36,23 +43,61 @@ func TestUnregisterOnAllStreamsClosed(t *testing.T) {
 }
 
 func TestStreamTimeout(t *testing.T) {
-	config.StreamBase.SupplierTimeout = 50 * time.Second
-	config.StreamBase.StreamTimeout = 50 * time.Millisecond
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(50*time.Second), WithStreamTimeout(50*time.Millisecond))
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	id := Register(src)
-	Open(id)
-	time.Sleep(60 * time.Millisecond)
-	_, err := Open(id)
+	id, _ := r.Register(src)
+	sid, _ := r.Open(id)
+	c.Advance(49 * time.Millisecond)
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+	c.Advance(time.Millisecond)
+	_, ok = r.Get(sid)
+	assert.False(t, ok)
+	_, err := r.Open(id)
 	assert.Equal(t, ErrNoSuchSupplier, err)
 }
 
 func TestStreamClosing(t *testing.T) {
-	config.StreamBase.SupplierTimeout = 50 * time.Second
-	config.StreamBase.StreamTimeout = 50 * time.Second
 	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
-	id := Register(src)
+	id, _ := Register(src)
 	sid, _ := Open(id)
 	Close(sid)
 	_, ok := Get(sid)
 	assert.False(t, ok)
 }
+
+func TestShareCodeResolvesToSupplier(t *testing.T) {
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	id, _ := Register(src)
+	code, ok := ShareCode(id)
+	assert.True(t, ok)
+	resolved, ok := Resolve(strings.ToUpper(code))
+	assert.True(t, ok)
+	assert.Equal(t, id, resolved)
+}
+
+func TestShareCodeReleasedOnUnregistration(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(50*time.Millisecond), WithStreamTimeout(50*time.Second))
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	id, _ := r.Register(src)
+	code, _ := r.ShareCode(id)
+	sid, _ := r.Open(id)
+	r.Close(sid)
+	_, ok := r.Resolve(code)
+	assert.False(t, ok)
+	_, ok = r.ShareCode(id)
+	assert.False(t, ok)
+
+	id, _ = r.Register(src)
+	code, _ = r.ShareCode(id)
+	c.Advance(49 * time.Millisecond)
+	_, ok = r.Resolve(code)
+	assert.True(t, ok)
+	c.Advance(time.Millisecond)
+	_, ok = r.Resolve(code)
+	assert.False(t, ok)
+}
@@ -0,0 +1,93 @@
+package streams
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestSupplierInfo(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(time.Minute),
+		WithStreamTimeout(time.Hour),
+		WithIdleTimeout(-1),
+	)
+	src := NewSeededRandomCharStreamSource(42, charslice('a', 'b', 'c'))
+	created := c.Now()
+	id, _ := r.RegisterAs("", src, Timeouts{Idle: time.Minute})
+	code, _ := r.ShareCode(id)
+
+	info, err := r.Supplier(id)
+	assert.NoError(t, err)
+	assert.Equal(t, id, info.ID)
+	assert.Equal(t, code, info.Code)
+	if assert.NotNil(t, info.Description) {
+		assert.Equal(t, int64(42), info.Description.Seed)
+		assert.Equal(t, []rune{'a', 'b', 'c'}, info.Description.Charset)
+	}
+	assert.Equal(t, Timeouts{Lifetime: time.Hour, Idle: time.Minute}, info.Timeouts)
+	assert.Equal(t, created, info.Created)
+	assert.Equal(t, created.Add(time.Minute), info.Expires)
+	assert.Equal(t, Pending, info.State)
+	assert.Zero(t, info.Connections)
+
+	c.Advance(time.Second)
+	sid, _ := r.Open(id)
+	info, _ = r.Supplier(id)
+	assert.Equal(t, Active, info.State)
+	assert.Equal(t, 1, info.Connections)
+	assert.Equal(t, c.Now().Add(time.Minute), info.Expires)
+	r.Close(sid)
+
+	_, err = r.Supplier(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+}
+
+func TestKeepAlive(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(WithClock(c), WithSupplierTimeout(time.Minute), WithStreamTimeout(time.Hour))
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+
+	c.Advance(50 * time.Second)
+	assert.NoError(t, r.KeepAlive(id))
+	c.Advance(50 * time.Second)
+	_, err := r.Supplier(id)
+	assert.NoError(t, err)
+	c.Advance(10 * time.Second)
+	_, err = r.Supplier(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	assert.Equal(t, ErrNoSuchSupplier, r.KeepAlive(id))
+}
+
+func TestUnregisterClosesStreams(t *testing.T) {
+	t.Parallel()
+	b := NewMemoryBackend().(*memoryBackend)
+	r := NewRegistry(WithBackend(b), WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour))
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	other, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid0, _ := r.Open(id)
+	sid1, _ := r.Open(id)
+	kept, _ := r.Open(other)
+	s, _ := r.Get(sid0)
+
+	assert.NoError(t, r.Unregister(id))
+	_, ok := r.Get(sid0)
+	assert.False(t, ok)
+	_, ok = r.Get(sid1)
+	assert.False(t, ok)
+	<-s.Done()
+	_, ok = r.Get(kept)
+	assert.True(t, ok)
+	_, err := r.Open(id)
+	assert.Equal(t, ErrNoSuchSupplier, err)
+	assert.Equal(t, ErrNoSuchSupplier, r.Unregister(id))
+
+	r.Close(kept)
+	assertEmpty(t, r, b)
+}
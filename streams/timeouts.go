@@ -0,0 +1,120 @@
+package streams
+
+import "time"
+
+// Timeouts override a Registry's timeouts for the Streams opened from a single
+// StreamSupplier. A zero value means, that the Registry's timeout is used
+type Timeouts struct {
+	// Lifetime overrides the Registry's StreamTimeout, i.e. the time after
+	// which a Stream is closed, no matter its activity
+	Lifetime time.Duration `json:"lifetime,omitempty"`
+	// Idle overrides the Registry's IdleTimeout, i.e. the time after which a
+	// Stream is closed, if Touch isn't called
+	Idle time.Duration `json:"idle,omitempty"`
+}
+
+// names of the timeouts as used in TimeoutErrors
+const (
+	TimeoutLifetime = "lifetime"
+	TimeoutIdle     = "idle_timeout"
+)
+
+// TimeoutError is returned, if a Timeouts' value is out of the Registry's
+// bounds
+type TimeoutError struct {
+	// Timeout is the name of the invalid timeout (e.g. TimeoutIdle)
+	Timeout string
+	// Min and Max are the bounds. Zero means unbounded
+	Min, Max time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	msg := "invalid " + e.Timeout + ": it must be positive"
+	if e.Min > 0 {
+		msg += ", at least " + e.Min.String()
+	}
+	if e.Max > 0 {
+		msg += ", at most " + e.Max.String()
+	}
+	return msg
+}
+
+type timeoutBounds struct {
+	min, max Timeouts
+}
+
+// WithIdleTimeout sets the time, after which an opened Stream is closed, if it
+// isn't touched. By default, or if timeout isn't positive, Streams don't time
+// out due to inactivity
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(r *Registry) {
+		r.idleTimeout = timeout
+	}
+}
+
+// WithTimeoutBounds sets the bounds for Timeouts passed to RegisterAs. A zero
+// value means unbounded. By default, Timeouts are unbounded
+func WithTimeoutBounds(min, max Timeouts) Option {
+	return func(r *Registry) {
+		r.timeoutBounds = timeoutBounds{min: min, max: max}
+	}
+}
+
+// IdleTimeout returns the time, after which an opened Stream is closed, if it
+// isn't touched. Zero means, that Streams never time out due to inactivity
+func (r *Registry) IdleTimeout() time.Duration {
+	if r.idleTimeout < 0 {
+		return 0
+	}
+	return r.idleTimeout
+}
+
+// TimeoutBounds returns the minimum and maximum Timeouts, that may be passed to
+// RegisterAs
+func (r *Registry) TimeoutBounds() (min, max Timeouts) {
+	return r.timeoutBounds.min, r.timeoutBounds.max
+}
+
+// CheckTimeouts checks Timeouts using the default Registry
+func CheckTimeouts(t Timeouts) error {
+	return defaultRegistry.Load().CheckTimeouts(t)
+}
+
+// CheckTimeouts returns a *TimeoutError, if one of the given Timeouts is
+// negative or out of the Registry's bounds. Zero values are always valid
+func (r *Registry) CheckTimeouts(t Timeouts) error {
+	min, max := r.TimeoutBounds()
+	if !within(t.Lifetime, min.Lifetime, max.Lifetime) {
+		return &TimeoutError{Timeout: TimeoutLifetime, Min: min.Lifetime, Max: max.Lifetime}
+	}
+	if !within(t.Idle, min.Idle, max.Idle) {
+		return &TimeoutError{Timeout: TimeoutIdle, Min: min.Idle, Max: max.Idle}
+	}
+	return nil
+}
+
+func within(d, min, max time.Duration) bool {
+	switch {
+	case d == 0:
+		return true
+	case d < 0:
+		return false
+	case min > 0 && d < min:
+		return false
+	case max > 0 && d > max:
+		return false
+	}
+	return true
+}
+
+// timeouts returns the given Timeouts with all zero values replaced by the
+// Registry's timeouts
+func (r *Registry) timeouts(t Timeouts) Timeouts {
+	if t.Lifetime == 0 {
+		t.Lifetime = r.StreamTimeout()
+	}
+	if t.Idle == 0 {
+		t.Idle = r.IdleTimeout()
+	}
+	return t
+}
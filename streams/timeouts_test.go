@@ -0,0 +1,172 @@
+package streams
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(time.Hour),
+		WithStreamTimeout(time.Hour),
+		WithIdleTimeout(time.Minute),
+	)
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	s, _ := r.Get(sid)
+	assert.Equal(t, c.Now().Add(time.Hour), s.Deadline())
+	assert.Equal(t, time.Minute, s.IdleTimeout())
+	assert.Equal(t, c.Now().Add(time.Minute), s.IdleDeadline())
+
+	c.Advance(50 * time.Second)
+	s.Touch()
+	assert.Equal(t, c.Now().Add(time.Minute), s.IdleDeadline())
+	c.Advance(50 * time.Second)
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+
+	c.Advance(10 * time.Second)
+	_, ok = r.Get(sid)
+	assert.False(t, ok)
+	select {
+	case <-s.Done():
+	default:
+		t.Error("Done wasn't closed")
+	}
+	// touching a closed Stream has no effect
+	s.Touch()
+	assert.Zero(t, r.janitor.Len())
+}
+
+func TestLifetimeDespiteActivity(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(time.Hour),
+		WithStreamTimeout(time.Hour),
+		WithIdleTimeout(time.Minute),
+	)
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, _ := r.Open(id)
+	s, _ := r.Get(sid)
+	for i := 0; i < 59; i++ {
+		c.Advance(time.Minute - time.Second)
+		s.Touch()
+	}
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+	c.Advance(time.Minute)
+	_, ok = r.Get(sid)
+	assert.False(t, ok)
+}
+
+func TestSupplierTimeouts(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(time.Hour),
+		WithStreamTimeout(time.Hour),
+		WithIdleTimeout(time.Minute),
+		WithTimeoutBounds(Timeouts{Idle: 10 * time.Second}, Timeouts{Lifetime: 2 * time.Hour, Idle: time.Hour}),
+	)
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c'))
+
+	var timeoutErr *TimeoutError
+	_, err := r.RegisterAs("", src, Timeouts{Lifetime: 3 * time.Hour})
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, TimeoutLifetime, timeoutErr.Timeout)
+	assert.Equal(t, 2*time.Hour, timeoutErr.Max)
+	_, err = r.RegisterAs("", src, Timeouts{Idle: time.Second})
+	assert.True(t, errors.As(err, &timeoutErr))
+	assert.Equal(t, TimeoutIdle, timeoutErr.Timeout)
+	_, err = r.RegisterAs("", src, Timeouts{Idle: -time.Minute})
+	assert.True(t, errors.As(err, &timeoutErr))
+
+	id, err := r.RegisterAs("", src, Timeouts{Idle: 20 * time.Second})
+	assert.NoError(t, err)
+	sid, _ := r.Open(id)
+	s, _ := r.Get(sid)
+	assert.Equal(t, c.Now().Add(time.Hour), s.Deadline())
+	assert.Equal(t, 20*time.Second, s.IdleTimeout())
+	c.Advance(20 * time.Second)
+	_, ok := r.Get(sid)
+	assert.False(t, ok)
+}
+
+func TestDisabledIdleTimeout(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Now())
+	r := NewRegistry(
+		WithClock(c),
+		WithSupplierTimeout(time.Hour),
+		WithStreamTimeout(time.Hour),
+		WithIdleTimeout(-1),
+	)
+	id, _ := r.Register(NewRandomCharStreamSource(charslice('a', 'b', 'c')))
+	sid, _ := r.Open(id)
+	s, _ := r.Get(sid)
+	assert.Zero(t, s.IdleTimeout())
+	assert.True(t, s.IdleDeadline().IsZero())
+	c.Advance(59 * time.Minute)
+	_, ok := r.Get(sid)
+	assert.True(t, ok)
+	r.Close(sid)
+}
+
+func TestTokenTimeouts(t *testing.T) {
+	t.Parallel()
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c'))
+	timeouts := Timeouts{Lifetime: 2 * time.Hour, Idle: 30 * time.Second}
+	token, err := Token(src, timeouts, testKey)
+	assert.NoError(t, err)
+	d, parsed, err := ParseToken(token, testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, timeouts, parsed)
+	assert.Equal(t, src.(DescribedSource).Description(), d)
+
+	// tokens without Timeouts keep their format
+	plain, _ := Token(src, Timeouts{}, testKey)
+	assert.NotEqual(t, token, plain)
+	_, parsed, err = ParseToken(plain, testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{}, parsed)
+
+	r := NewRegistry(WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour))
+	id, err := r.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	sid, _ := r.Open(id)
+	s, _ := r.Get(sid)
+	assert.Equal(t, 30*time.Second, s.IdleTimeout())
+	r.Close(sid)
+}
+
+func TestSnapshotRestoresTimeouts(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithSupplierTimeout(time.Hour), WithStreamTimeout(time.Hour))
+	path := snapshotPath(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	timeouts := Timeouts{Lifetime: 2 * time.Hour, Idle: 30 * time.Second}
+	id, _ := r.RegisterAs("", NewRandomCharStreamSource(charslice('a', 'b', 'c')), timeouts)
+	assert.NoError(t, r.SaveSnapshot(path, false))
+
+	r = restart(r)
+	assert.NoError(t, r.RestoreSnapshot(path))
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	s, _ := r.Get(sid)
+	assert.Equal(t, 30*time.Second, s.IdleTimeout())
+	r.Close(sid)
+}
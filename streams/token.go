@@ -0,0 +1,133 @@
+package streams
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// ErrInvalidToken is returned, if a token is malformed or wasn't signed with the
+// expected key
+var ErrInvalidToken = errors.New("the given token is invalid")
+
+// A token is the unpadded, url-safe base64-encoding of a payload followed by
+// the first tokenMACSize bytes of the payload's HMAC-SHA256. The payload is the
+// binary SourceDescription. Non-zero Timeouts precede it: the timeoutsMarker,
+// followed by the Lifetime and the Idle timeout in nanoseconds, each encoded
+// as varint
+
+// tokenMACSize is the number of bytes of the HMAC-SHA256, that are appended to
+// a token's payload
+const tokenMACSize = 16
+
+// timeoutsMarker precedes the Timeouts in a token's payload. It can't be
+// confused with the first byte of a SourceDescription, which is its version
+const timeoutsMarker byte = 0
+
+// Token returns a signed, url-safe token, which encodes the given source's
+// SourceDescription and Timeouts. Any process knowing the key can rebuild the
+// source from the token using ResolveToken. Token returns ErrNotDescribable, if
+// the source doesn't implement DescribedSource
+func Token(source StreamSource, timeouts Timeouts, key []byte) (token string, err error) {
+	d, ok := source.(DescribedSource)
+	if !ok {
+		return "", ErrNotDescribable
+	}
+	description, err := d.Description().MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	var payload []byte
+	if timeouts != (Timeouts{}) {
+		payload = append(payload, timeoutsMarker)
+		payload = appendVarint(payload, int64(timeouts.Lifetime))
+		payload = appendVarint(payload, int64(timeouts.Idle))
+	}
+	payload = append(payload, description...)
+	return base64.RawURLEncoding.EncodeToString(append(payload, sign(payload, key)...)), nil
+}
+
+// ParseToken verifies the given token's signature and returns the
+// SourceDescription and Timeouts encoded in it
+func ParseToken(token string, key []byte) (d SourceDescription, timeouts Timeouts, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) <= tokenMACSize {
+		return d, timeouts, ErrInvalidToken
+	}
+	payload, mac := b[:len(b)-tokenMACSize], b[len(b)-tokenMACSize:]
+	if !hmac.Equal(mac, sign(payload, key)) {
+		return d, timeouts, ErrInvalidToken
+	}
+	if payload[0] == timeoutsMarker {
+		var lifetime, idle int64
+		var ok bool
+		lifetime, payload, ok = readVarint(payload[1:])
+		if ok {
+			idle, payload, ok = readVarint(payload)
+		}
+		if !ok {
+			return d, timeouts, ErrInvalidToken
+		}
+		timeouts = Timeouts{Lifetime: time.Duration(lifetime), Idle: time.Duration(idle)}
+	}
+	if d.UnmarshalBinary(payload) != nil {
+		return d, timeouts, ErrInvalidToken
+	}
+	return d, timeouts, nil
+}
+
+// ResolveToken resolves a token using the default Registry
+func ResolveToken(token string, key []byte) (supplierID int64, err error) {
+	return defaultRegistry.Load().ResolveToken(token, key)
+}
+
+// ResolveToken returns the id of the StreamSupplier described by the given
+// token. If there is no such StreamSupplier registered, it is rebuilt from the
+// token and registered. The rebuilt StreamSupplier is unregistered under the
+// same conditions as any other StreamSupplier. A *LimitError is returned, if
+// the Registry's Limits don't permit rebuilding it, ErrDrainMode, if the
+// Registry is in drain mode. The Timeouts encoded in the token aren't checked,
+// since the token was signed by a trusted process.
+// The returned id is only valid within the Registry's Backend. Thus, processes
+// resolve the same token to different ids, unless they share their Backend.
+// The ids of Streams opened from the StreamSupplier are always local to the
+// process, that opened them
+func (r *Registry) ResolveToken(token string, key []byte) (supplierID int64, err error) {
+	d, timeouts, err := ParseToken(token, key)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		id, ok, err := r.backend.ReadToken(token)
+		if err != nil || ok {
+			return id, err
+		}
+		if r.DrainMode() {
+			return 0, ErrDrainMode
+		}
+		source, err := Rebuild(d)
+		if err != nil {
+			return 0, ErrInvalidToken
+		}
+		err = r.CheckSource(source)
+		if err == nil {
+			err = r.checkSuppliers("")
+		}
+		if err != nil {
+			return 0, err
+		}
+		supplierID, err = r.register(source, token, timeouts)
+		// retry, if the token was registered concurrently
+		if err != ErrTokenTaken {
+			return supplierID, err
+		}
+	}
+}
+
+func sign(payload, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(payload)
+	return h.Sum(nil)[:tokenMACSize]
+}
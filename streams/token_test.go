@@ -0,0 +1,67 @@
+package streams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theMomax/notypo-backend/clock"
+)
+
+var testKey = []byte("secret")
+
+func TestDescriptionRoundTrip(t *testing.T) {
+	d := SourceDescription{
+		Type:    RandomSourceType,
+		Seed:    -42,
+		Charset: []rune{'a', 'ä', '€', '😀'},
+	}
+	b, err := d.MarshalBinary()
+	assert.NoError(t, err)
+	var decoded SourceDescription
+	assert.NoError(t, decoded.UnmarshalBinary(b))
+	assert.Equal(t, d, decoded)
+	assert.Error(t, decoded.UnmarshalBinary(b[:len(b)-1]))
+}
+
+func TestTokenRejectsWrongKey(t *testing.T) {
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c'))
+	token, err := Token(src, Timeouts{}, testKey)
+	assert.NoError(t, err)
+	_, _, err = ParseToken(token, []byte("other"))
+	assert.Equal(t, ErrInvalidToken, err)
+	_, _, err = ParseToken(token[:len(token)-2], testKey)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = ResolveToken(token+"A", testKey)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestResolveTokenRebuildsSource(t *testing.T) {
+	t.Parallel()
+	r := NewRegistry(WithClock(clock.NewFake(time.Now())))
+	src := NewRandomCharStreamSource(charslice('a', 'b', 'c', 'd', 'e'))
+	token, err := Token(src, Timeouts{}, testKey)
+	assert.NoError(t, err)
+
+	id, err := r.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	again, err := r.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	sid, err := r.Open(id)
+	assert.NoError(t, err)
+	s, ok := r.Get(sid)
+	assert.True(t, ok)
+	original := src.Instance(context.Background())
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, (<-original.Channel()).Rune(), (<-s.Channel()).Rune())
+	}
+	original.Close()
+	r.Close(sid)
+
+	rebuilt, err := r.ResolveToken(token, testKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, rebuilt)
+}